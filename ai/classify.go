@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Classification - результат классификации транзакции
+type Classification struct {
+	Category   string   // Категория из списка допустимых
+	Confidence float64  // Уверенность модели от 0 до 1; 0, если модель её не указала
+	Merchant   string   // Продавец или сервис, если модель его распознала
+	Candidates []string // До трёх наиболее вероятных категорий, первая совпадает с Category
+}
+
+// maxCandidates - сколько вариантов категорий предлагать пользователю
+const maxCandidates = 3
+
+// minSimilarity - минимальная похожесть названия, при которой категория считается найденной
+const minSimilarity = 0.75
+
+// classificationResponse - ответ модели на запрос классификации
+type classificationResponse struct {
+	Category     string   `json:"category"`
+	Confidence   *float64 `json:"confidence"`
+	Merchant     string   `json:"merchant"`
+	Alternatives []string `json:"alternatives"`
+}
+
+// parseClassification разбирает ответ модели. Модели не всегда следуют формату, поэтому
+// кроме JSON принимается и просто название категории, в том числе с лишними словами
+// вроде "Категория: Продукты."
+func parseClassification(content string, categories []string) (*Classification, error) {
+	var resp classificationResponse
+	if raw, ok := extractJSON(content); !ok || json.Unmarshal([]byte(raw), &resp) != nil || resp.Category == "" {
+		resp = classificationResponse{Category: content}
+	}
+
+	category, ok := matchCategory(resp.Category, categories)
+	if !ok {
+		return nil, fmt.Errorf("модель вернула невалидную категорию: %s", resp.Category)
+	}
+
+	result := &Classification{
+		Category:   category,
+		Merchant:   strings.TrimSpace(resp.Merchant),
+		Candidates: []string{category},
+	}
+	// Без указанной уверенности ответ считается неуверенным: пусть категорию подтвердит пользователь
+	if resp.Confidence != nil {
+		result.Confidence = min(max(*resp.Confidence, 0), 1)
+	}
+	for _, alternative := range resp.Alternatives {
+		if len(result.Candidates) == maxCandidates {
+			break
+		}
+		if match, ok := matchCategory(alternative, categories); ok && !containsString(result.Candidates, match) {
+			result.Candidates = append(result.Candidates, match)
+		}
+	}
+	return result, nil
+}
+
+// extractJSON возвращает JSON-объект из ответа модели. Модели нередко оборачивают JSON
+// в ```json ... ``` или добавляют фразу перед ним, поэтому берётся содержимое от первой
+// открывающей до последней закрывающей фигурной скобки.
+func extractJSON(content string) (string, bool) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return "", false
+	}
+	return content[start : end+1], true
+}
+
+// matchCategory находит в списке категорию, соответствующую ответу модели:
+// сначала точное совпадение без учёта регистра и знаков препинания, затем вхождение
+// названия категории в ответ, затем похожесть по расстоянию Левенштейна
+func matchCategory(answer string, categories []string) (string, bool) {
+	normalized := normalizeName(answer)
+	if normalized == "" {
+		return "", false
+	}
+	for _, category := range categories {
+		if normalizeName(category) == normalized {
+			return category, true
+		}
+	}
+
+	// "Категория: продукты" - ищем самое длинное название, входящее в ответ
+	best := ""
+	for _, category := range categories {
+		if strings.Contains(normalized, normalizeName(category)) && len(category) > len(best) {
+			best = category
+		}
+	}
+	if best != "" {
+		return best, true
+	}
+
+	// Опечатки и другие формы слова: "Продукт", "Развлечение"
+	bestScore := 0.0
+	for _, category := range categories {
+		if score := similarity(normalized, normalizeName(category)); score > bestScore {
+			best, bestScore = category, score
+		}
+	}
+	return best, bestScore >= minSimilarity
+}
+
+// normalizeName приводит название к нижнему регистру, заменяет ё на е и убирает знаки препинания
+func normalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(name, "ё", "е"), "Ё", "Е")) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// similarity возвращает похожесть строк от 0 до 1 на основе расстояния Левенштейна
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein вычисляет редакционное расстояние между строками
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// containsString сообщает, есть ли строка в списке
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Параметры повторных попыток и автоматического выключателя
+const (
+	maxRetries       = 3                // Повторных попыток на одну модель
+	baseBackoff      = time.Second      // Пауза перед первой повторной попыткой, дальше удваивается
+	maxBackoff       = 30 * time.Second // Максимальная пауза между попытками
+	breakerThreshold = 5                // Неудачных вызовов подряд до выключения AI
+	breakerCooldown  = 2 * time.Minute  // На сколько AI выключается
+)
+
+// ErrCircuitOpen возвращается, когда после серии ошибок обращения к AI временно приостановлены
+var ErrCircuitOpen = errors.New("AI временно отключен после серии ошибок")
+
+// breaker - автоматический выключатель: после breakerThreshold неудачных вызовов подряд
+// обращения к AI пропускаются на breakerCooldown, чтобы не ждать заведомо упавший сервис
+var breaker struct {
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// breakerAllow сообщает, можно ли сейчас обращаться к AI
+func breakerAllow() bool {
+	breaker.Lock()
+	defer breaker.Unlock()
+	return time.Now().After(breaker.openUntil)
+}
+
+// breakerRecord учитывает результат вызова
+func breakerRecord(success bool) {
+	breaker.Lock()
+	defer breaker.Unlock()
+	if success {
+		breaker.failures = 0
+		return
+	}
+	breaker.failures++
+	if breaker.failures >= breakerThreshold {
+		breaker.openUntil = time.Now().Add(breakerCooldown)
+		breaker.failures = 0
+		log.Printf("ВНИМАНИЕ: %d неудачных обращений к AI подряд, AI отключен до %s", breakerThreshold, breaker.openUntil.Format("15:04:05"))
+	}
+}
+
+// apiError - ошибка ответа API с признаком того, стоит ли повторять запрос
+type apiError struct {
+	status     int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API вернуло ошибку (статус %d): %s", e.status, e.body)
+}
+
+// retryable сообщает, имеет ли смысл повторить запрос: при превышении лимитов и ошибках сервера
+func (e *apiError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status == http.StatusRequestTimeout || e.status >= 500
+}
+
+// chatCompletion отправляет системный и пользовательский промпты в OpenRouter и возвращает текст ответа модели.
+// Модели из списка пробуются по порядку; временные ошибки (429, 5xx, сетевые) повторяются
+// с экспоненциальной паузой с учётом заголовка Retry-After.
+func chatCompletion(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+	if !config.Enabled() {
+		return "", fmt.Errorf("API ключ для OpenRouter не установлен")
+	}
+	if !breakerAllow() {
+		log.Println("AI временно отключен, запрос не отправляется.")
+		recordSkipped()
+		return "", ErrCircuitOpen
+	}
+
+	messages := []AIMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}
+
+	started := time.Now()
+	content, err := completeWithFallback(ctx, messages)
+	recordCall(time.Since(started), err)
+	return content, err
+}
+
+// completeWithFallback пробует модели из списка по порядку, повторяя временные ошибки
+func completeWithFallback(ctx context.Context, messages []AIMessage) (string, error) {
+	var lastErr error
+	for _, model := range config.Models {
+		for attempt := 0; attempt <= maxRetries; attempt++ {
+			content, err := requestCompletion(ctx, model, messages)
+			if err == nil {
+				breakerRecord(true)
+				return content, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				breakerRecord(false)
+				return "", fmt.Errorf("запрос к AI прерван: %w", ctx.Err())
+			}
+
+			// Сетевые ошибки повторяем, ошибки API - только временные
+			delay := backoff(attempt)
+			var apiErr *apiError
+			if errors.As(err, &apiErr) {
+				if !apiErr.retryable() {
+					log.Printf("Модель %s вернула ошибку, которую нет смысла повторять: %v", model, err)
+					break
+				}
+				if apiErr.retryAfter > 0 {
+					delay = apiErr.retryAfter
+				}
+			}
+			if attempt == maxRetries {
+				break
+			}
+			if delay > maxBackoff {
+				log.Printf("Модель %s просит подождать %s, переходим к следующей модели.", model, delay)
+				break
+			}
+
+			log.Printf("Попытка %d для модели %s не удалась: %v. Повтор через %s", attempt+1, model, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				breakerRecord(false)
+				return "", fmt.Errorf("запрос к AI прерван: %w", ctx.Err())
+			}
+		}
+		log.Printf("Модель %s недоступна, пробуем следующую.", model)
+	}
+
+	breakerRecord(false)
+	return "", lastErr
+}
+
+// backoff возвращает паузу перед повторной попыткой: удваивается с каждой попыткой, со случайной добавкой
+func backoff(attempt int) time.Duration {
+	delay := baseBackoff << attempt
+	delay += time.Duration(rand.Int63n(int64(delay / 2)))
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// parseRetryAfter разбирает заголовок Retry-After: число секунд или HTTP-дату
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// requestCompletion выполняет одну попытку запроса к модели
+func requestCompletion(ctx context.Context, model string, messages []AIMessage) (string, error) {
+	// Создаем тело запроса
+	requestPayload := AIRequest{
+		Model:    model,
+		Messages: messages,
+	}
+
+	// Преобразование промта в JSON
+	requestBody, err := json.Marshal(requestPayload)
+	if err != nil {
+		log.Printf("Критическая ошибка при маршалинге JSON для OpenRouter запроса: %v", err)
+		return "", fmt.Errorf("ошибка при маршалинге JSON: %w", err)
+	}
+
+	// Создание HTTP-запроса
+	req, err := http.NewRequestWithContext(ctx, "POST", config.APIURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		log.Printf("Критическая ошибка при создании HTTP-запроса к OpenRouter: %v", err)
+		return "", fmt.Errorf("ошибка при создании запроса: %w", err)
+	}
+
+	// Установка заголовков
+	// Локальным OpenAI-совместимым серверам ключ обычно не нужен
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// OpenRouter рекомендует добавлять эти заголовки для идентификации вашего проекта
+	if config.Referer != "" {
+		req.Header.Set("HTTP-Referer", config.Referer)
+	}
+	if config.Title != "" {
+		req.Header.Set("X-Title", config.Title)
+	}
+
+	log.Printf("Отправка запроса к модели %s на URL: %s", model, config.APIURL)
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		log.Printf("Ошибка при отправке HTTP-запроса к OpenRouter: %v", err)
+		return "", fmt.Errorf("ошибка при отправке запроса: %w", err)
+	}
+	defer resp.Body.Close()
+	log.Printf("Получен ответ от OpenRouter API со статусом: %s", resp.Status)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Ошибка при чтении тела ответа от OpenRouter: %v", err)
+		return "", fmt.Errorf("ошибка при чтении ответа: %w", err)
+	}
+	log.Printf("Тело ответа от OpenRouter: %s", string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &apiError{
+			status:     resp.StatusCode,
+			body:       string(body),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	var aiResp AIResponse
+	if err := json.Unmarshal(body, &aiResp); err != nil {
+		log.Printf("Ошибка демаршалинга JSON ответа от OpenRouter: %v. Ответ: %s", err, string(body))
+		return "", fmt.Errorf("ошибка при демаршалинге JSON: %w. Ответ от API: %s", err, string(body))
+	}
+
+	if len(aiResp.Choices) == 0 || strings.TrimSpace(aiResp.Choices[0].Message.Content) == "" {
+		log.Println("Ответ от OpenRouter пустой или в некорректном формате.")
+		return "", fmt.Errorf("не удалось получить корректный ответ от API")
+	}
+	return strings.TrimSpace(aiResp.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Config - настройки обращения к AI. Все поля можно задать переменными окружения
+// (или в .env), поэтому модель и промпты меняются без пересборки бота.
+type Config struct {
+	APIKey            string   // OPENROUTER_API_KEY
+	APIURL            string   // AI_API_URL - адрес OpenAI-совместимого Chat Completions API
+	Models            []string // AI_MODELS - модели через запятую, пробуются по порядку
+	Referer           string   // AI_REFERER - заголовок HTTP-Referer для OpenRouter
+	Title             string   // AI_TITLE - заголовок X-Title для OpenRouter
+	PromptsDir        string   // AI_PROMPTS_DIR - каталог с шаблонами, заменяющими встроенные
+	ExtraInstructions string   // AI_EXTRA_INSTRUCTIONS - указания, добавляемые ко всем промптам
+}
+
+// Шаблоны промптов по умолчанию; файл с тем же именем в PromptsDir заменяет встроенный
+//
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// Имена шаблонов промптов
+const (
+	promptClassify = "classify.tmpl"
+	promptQuestion = "question.tmpl"
+	promptInsights = "insights.tmpl"
+)
+
+// promptData - данные, доступные в шаблонах промптов
+type promptData struct {
+	Categories []string // Список категорий
+	Today      string   // Текущая дата
+	Extra      string   // Дополнительные указания из настроек
+}
+
+var (
+	// Текущие настройки пакета
+	config = DefaultConfig()
+	// Загруженные шаблоны промптов: встроенные, пока Init не загрузит шаблоны из настроек
+	prompts = template.Must(loadPrompts(""))
+)
+
+// DefaultConfig возвращает настройки по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		APIURL: "https://openrouter.ai/api/v1/chat/completions",
+		Models: []string{
+			"mistralai/mistral-7b-instruct:free", // Используем надежную бесплатную модель от Mistral
+			"meta-llama/llama-3.1-8b-instruct:free",
+		},
+		Referer: "https://github.com/user/money-bot",
+		Title:   "Money Bot",
+	}
+}
+
+// Enabled сообщает, можно ли обращаться к AI: нужен ключ OpenRouter или свой адрес API.
+// OpenAI-совместимые серверы, запущенные локально, обычно работают без ключа.
+func (c Config) Enabled() bool {
+	return c.APIKey != "" || c.APIURL != DefaultConfig().APIURL
+}
+
+// ConfigFromEnv читает настройки из переменных окружения; незаданные поля получают значения по умолчанию
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.APIKey = os.Getenv("OPENROUTER_API_KEY")
+	if url := os.Getenv("AI_API_URL"); url != "" {
+		cfg.APIURL = url
+	}
+	if models := os.Getenv("AI_MODELS"); models != "" {
+		cfg.Models = nil
+		for _, model := range strings.Split(models, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				cfg.Models = append(cfg.Models, model)
+			}
+		}
+	}
+	if referer, ok := os.LookupEnv("AI_REFERER"); ok {
+		cfg.Referer = referer
+	}
+	if title, ok := os.LookupEnv("AI_TITLE"); ok {
+		cfg.Title = title
+	}
+	cfg.PromptsDir = os.Getenv("AI_PROMPTS_DIR")
+	cfg.ExtraInstructions = os.Getenv("AI_EXTRA_INSTRUCTIONS")
+	return cfg
+}
+
+// Init инициализирует пакет ai: сохраняет настройки и загружает шаблоны промптов.
+// Вызывается один раз при запуске, до первых обращений к AI.
+func Init(cfg Config) error {
+	if len(cfg.Models) == 0 {
+		return fmt.Errorf("не указано ни одной модели")
+	}
+	if cfg.APIURL == "" {
+		return fmt.Errorf("не указан адрес API")
+	}
+
+	loaded, err := loadPrompts(cfg.PromptsDir)
+	if err != nil {
+		return err
+	}
+	config = cfg
+	prompts = loaded
+	log.Printf("AI настроен: API %s, модели %s", cfg.APIURL, strings.Join(cfg.Models, ", "))
+	return nil
+}
+
+// loadPrompts загружает встроенные шаблоны и заменяет их файлами из каталога dir, если он задан
+func loadPrompts(dir string) (*template.Template, error) {
+	tmpl, err := template.ParseFS(defaultPrompts, "prompts/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора встроенных шаблонов промптов: %w", err)
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+
+	for _, name := range []string{promptClassify, promptQuestion, promptInsights} {
+		path := filepath.Join(dir, name)
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать шаблон %s: %w", path, err)
+		}
+		if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("ошибка разбора шаблона %s: %w", path, err)
+		}
+		log.Printf("Шаблон промпта %s загружен из %s", name, path)
+	}
+	return tmpl, nil
+}
+
+// renderPrompt подставляет данные в шаблон промпта, добавляя указания из настроек
+func renderPrompt(name string, data promptData) (string, error) {
+	var prompt strings.Builder
+	data.Extra = config.ExtraInstructions
+	if err := prompts.ExecuteTemplate(&prompt, name, data); err != nil {
+		return "", fmt.Errorf("ошибка подстановки в шаблон %s: %w", name, err)
+	}
+	return prompt.String(), nil
+}
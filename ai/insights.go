@@ -0,0 +1,24 @@
+package ai
+
+import (
+	"context"
+	"log"
+)
+
+// GenerateInsights пишет короткий обзор трат за месяц по заранее агрегированным данным.
+// На вход подаётся текстовая сводка, а не сырые транзакции: так промпт остаётся
+// компактным, а все расчёты выполняются на нашей стороне.
+func GenerateInsights(ctx context.Context, summary string) (string, error) {
+	log.Println("Генерация обзора трат за месяц через OpenRouter.")
+
+	systemPrompt, err := renderPrompt(promptInsights, promptData{})
+	if err != nil {
+		return "", err
+	}
+
+	content, err := chatCompletion(ctx, systemPrompt, summary)
+	if err != nil {
+		return "", err
+	}
+	return content, nil
+}
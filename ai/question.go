@@ -0,0 +1,37 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TranslateQuestion переводит вопрос о тратах на естественном языке в JSON-описание запроса.
+// Модель не пишет SQL: она только заполняет поля фиксированной структуры, которую затем
+// проверяет и выполняет пакет storage.
+func TranslateQuestion(ctx context.Context, question string, categories []string, now time.Time) (string, error) {
+	log.Printf("Перевод вопроса в структурированный запрос: \"%s\"", question)
+
+	systemPrompt, err := renderPrompt(promptQuestion, promptData{
+		Categories: categories,
+		Today:      now.Format("2006-01-02 (Monday)"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	userPrompt := fmt.Sprintf(`Вопрос: "%s"`, question)
+
+	content, err := chatCompletion(ctx, systemPrompt, userPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	query, ok := extractJSON(content)
+	if !ok {
+		return "", fmt.Errorf("модель не вернула JSON: %s", content)
+	}
+	log.Printf("Получен структурированный запрос: %s", query)
+	return query, nil
+}
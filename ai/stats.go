@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"sync"
+	"time"
+)
+
+// CallStats - статистика обращений к AI с момента запуска бота.
+// Обращение - один вызов классификации, вопроса или обзора, включая все его повторы и запасные модели.
+type CallStats struct {
+	Since        time.Time     // Когда начат подсчёт
+	Calls        int64         // Обращений, отправленных к API
+	Failures     int64         // Обращений, завершившихся ошибкой
+	Skipped      int64         // Обращений, не отправленных из-за автоматического выключателя
+	TotalLatency time.Duration // Суммарная длительность отправленных обращений
+	MaxLatency   time.Duration // Самое долгое обращение
+}
+
+// AverageLatency возвращает среднюю длительность обращения
+func (s CallStats) AverageLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+var stats = struct {
+	sync.Mutex
+	CallStats
+}{CallStats: CallStats{Since: time.Now()}}
+
+// Stats возвращает статистику обращений к AI
+func Stats() CallStats {
+	stats.Lock()
+	defer stats.Unlock()
+	return stats.CallStats
+}
+
+// recordCall учитывает отправленное обращение и его длительность
+func recordCall(latency time.Duration, err error) {
+	stats.Lock()
+	defer stats.Unlock()
+	stats.Calls++
+	if err != nil {
+		stats.Failures++
+	}
+	stats.TotalLatency += latency
+	stats.MaxLatency = max(stats.MaxLatency, latency)
+}
+
+// recordSkipped учитывает обращение, пропущенное выключателем
+func recordSkipped() {
+	stats.Lock()
+	defer stats.Unlock()
+	stats.Skipped++
+}
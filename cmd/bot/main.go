@@ -1,12 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"money-bot/ai"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"money-bot/internal/bot"
+	"money-bot/internal/receipt"
+	"money-bot/internal/speech"
 	"money-bot/internal/storage"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -31,12 +37,15 @@ func main() {
 	}
 	log.Println("TELEGRAM_BOT_TOKEN успешно загружен.")
 
-	openRouterAPIKey := os.Getenv("OPENROUTER_API_KEY")
-	if openRouterAPIKey == "" {
+	aiConfig := ai.ConfigFromEnv()
+	switch {
+	case aiConfig.APIKey != "":
+		log.Println("OPENROUTER_API_KEY успешно загружен.")
+	case aiConfig.Enabled():
+		log.Printf("OPENROUTER_API_KEY не задан, запросы к %s отправляются без ключа.", aiConfig.APIURL)
+	default:
 		// Можно сделать эту ошибку не фатальной, если AI не является основной функцией
 		log.Println("ВНИМАНИЕ: OPENROUTER_API_KEY не найден в .env file. Функция классификации будет использовать категорию 'Прочее'.")
-	} else {
-		log.Println("OPENROUTER_API_KEY успешно загружен.")
 	}
 
 	// 2. Инициализируем хранилище данных (базу)
@@ -54,11 +63,80 @@ func main() {
 	}
 	log.Println("Хранилище данных успешно инициализировано.")
 
-	// Инициализируем пакет AI с токеном
+	// Срок жизни кеша категорий можно переопределить, например CLASSIFICATION_CACHE_TTL=720h
+	if ttl := os.Getenv("CLASSIFICATION_CACHE_TTL"); ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Некорректное значение CLASSIFICATION_CACHE_TTL: %v", err)
+		}
+		dbStorage.SetClassificationCacheTTL(duration)
+		log.Printf("Срок жизни кеша категорий: %s", duration)
+	}
+
+	// Срок хранения удалённых транзакций в корзине, например TRASH_RETENTION=168h
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		duration, err := time.ParseDuration(retention)
+		if err != nil {
+			log.Fatalf("Некорректное значение TRASH_RETENTION: %v", err)
+		}
+		dbStorage.SetTrashRetention(duration)
+		log.Printf("Срок хранения удалённых транзакций: %s", duration)
+	}
+
+	// Инициализируем пакет AI: ключ, адрес API, модели и шаблоны промптов
 	log.Println("Инициализация пакета AI...")
-	ai.Init(openRouterAPIKey)
+	if err := ai.Init(aiConfig); err != nil {
+		log.Fatalf("Ошибка настройки пакета AI: %v", err)
+	}
 	log.Println("Пакет AI успешно инициализирован.")
 
+	// Сервис расшифровки чеков по позициям необязателен
+	var options bot.Options
+	if providerURL := os.Getenv("RECEIPT_PROVIDER_URL"); providerURL != "" {
+		options.ReceiptProvider = receipt.NewHTTPProvider(providerURL, os.Getenv("RECEIPT_PROVIDER_TOKEN"))
+		log.Printf("Расшифровка чеков включена: %s", providerURL)
+	} else {
+		log.Println("RECEIPT_PROVIDER_URL не задан, чеки будут сохраняться одной суммой.")
+	}
+
+	// Ежемесячные обзоры трат пишет AI, поэтому без настроенного AI они не рассылаются
+	options.MonthlyInsights = aiConfig.Enabled() && os.Getenv("MONTHLY_INSIGHTS") != "false"
+
+	// Распознавание голосовых сообщений необязательно. WHISPER_API_URL позволяет
+	// указать локальный whisper-сервер с OpenAI-совместимым API.
+	whisperURL, whisperKey := os.Getenv("WHISPER_API_URL"), os.Getenv("WHISPER_API_KEY")
+	if whisperURL != "" || whisperKey != "" {
+		options.Transcriber = speech.NewWhisperTranscriber(whisperURL, whisperKey, os.Getenv("WHISPER_MODEL"))
+		log.Println("Распознавание голосовых сообщений включено.")
+	} else {
+		log.Println("WHISPER_API_URL и WHISPER_API_KEY не заданы, голосовые сообщения обрабатываться не будут.")
+	}
+
+	// Доступ к боту: open - все, allowlist - только ALLOWED_USER_IDS и одобренные администраторами,
+	// invite - то же плюс вход по коду из INVITE_CODES командой /start <код>
+	options.Access.Mode, err = bot.ParseAccessMode(os.Getenv("ACCESS_MODE"))
+	if err != nil {
+		log.Fatalf("Некорректное значение ACCESS_MODE: %v", err)
+	}
+	if options.Access.Admins, err = parseUserIDs(os.Getenv("ADMIN_IDS")); err != nil {
+		log.Fatalf("Некорректное значение ADMIN_IDS: %v", err)
+	}
+	if options.Access.AllowedUsers, err = parseUserIDs(os.Getenv("ALLOWED_USER_IDS")); err != nil {
+		log.Fatalf("Некорректное значение ALLOWED_USER_IDS: %v", err)
+	}
+	for _, code := range strings.Split(os.Getenv("INVITE_CODES"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			options.Access.InviteCodes = append(options.Access.InviteCodes, code)
+		}
+	}
+	if options.Access.Mode == bot.AccessInvite && len(options.Access.InviteCodes) == 0 {
+		log.Fatal("ACCESS_MODE=invite требует хотя бы одного кода в INVITE_CODES")
+	}
+	if options.Access.Mode != bot.AccessOpen && len(options.Access.Admins) == 0 {
+		log.Println("ВНИМАНИЕ: ADMIN_IDS не задан, одобрять новых пользователей будет некому.")
+	}
+	log.Printf("Режим доступа: %s, администраторов: %d", options.Access.Mode, len(options.Access.Admins))
+
 	// 3. Создаем новый экземпляр нашего бота
 	log.Println("Создание экземпляра Telegram Bot API...")
 	tgBot, err := tgbotapi.NewBotAPI(botToken)
@@ -69,10 +147,26 @@ func main() {
 
 	// 4. Создаем наш собственный экземпляр бота, передавая ему токен и хранилище
 	log.Println("Создание кастомного экземпляра бота...")
-	myBot := bot.NewBot(tgBot, dbStorage)
+	myBot := bot.NewBot(tgBot, dbStorage, options)
 	log.Println("Кастомный экземпляр бота успешно создан.")
 
 	// 5. Запускаем бота
 	log.Println("Запуск основного цикла обработки сообщений...")
 	myBot.Run()
 }
+
+// parseUserIDs разбирает список Telegram ID через запятую
+func parseUserIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q не является Telegram ID", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"money-bot/internal/handlers"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// refuseInterval - как часто отвечать отказом одному и тому же пользователю без доступа
+	refuseInterval = time.Hour
+	// refusedPruneSize - размер карты отказов, после которого из неё убираются устаревшие отметки
+	refusedPruneSize = 1000
+)
+
+// AccessMode - кто может пользоваться ботом
+type AccessMode string
+
+const (
+	AccessOpen      AccessMode = "open"      // Все, кроме заблокированных
+	AccessAllowlist AccessMode = "allowlist" // Только пользователи из списка и одобренные администратором
+	AccessInvite    AccessMode = "invite"    // Как allowlist, плюс вход по коду приглашения: /start <код>
+)
+
+// AccessConfig - настройки доступа к боту
+type AccessConfig struct {
+	Mode         AccessMode
+	Admins       []int64  // Администраторы: всегда имеют доступ и управляют доступом остальных
+	AllowedUsers []int64  // Пользователи, допущенные настройками без решения администратора
+	InviteCodes  []string // Коды приглашения для режима AccessInvite
+}
+
+// ParseAccessMode разбирает режим доступа из настроек; пустая строка - AccessOpen
+func ParseAccessMode(value string) (AccessMode, error) {
+	switch mode := AccessMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return AccessOpen, nil
+	case AccessOpen, AccessAllowlist, AccessInvite:
+		return mode, nil
+	}
+	return "", fmt.Errorf("неизвестный режим доступа %q, допустимы open, allowlist и invite", value)
+}
+
+// authorize решает, обрабатывать ли обновление. Пользователю без доступа бот отвечает
+// отказом в личном чате или на нажатие кнопки, а сообщения в группах молча игнорирует.
+func (b *Bot) authorize(update tgbotapi.Update) bool {
+	user := update.SentFrom()
+	if user == nil {
+		return true
+	}
+	granted, blocked := b.checkAccess(user.ID)
+	if granted {
+		return true
+	}
+	if blocked {
+		log.Printf("Обновление от заблокированного пользователя %d отклонено", user.ID)
+		return false
+	}
+
+	access := b.options.Access
+	if access.Mode == AccessInvite && update.Message != nil && update.Message.Command() == "start" {
+		if code := strings.TrimSpace(update.Message.CommandArguments()); code != "" && slices.Contains(access.InviteCodes, code) {
+			approved := &storage.BotUser{UserID: user.ID, Name: handlers.MemberName(user), Status: storage.AccessApproved, InviteCode: code}
+			if err := b.storage.SetAccess(approved); err != nil {
+				log.Printf("Ошибка при сохранении доступа пользователя %d по приглашению: %v", user.ID, err)
+				return false
+			}
+			log.Printf("Пользователь %d получил доступ по коду приглашения", user.ID)
+			return true
+		}
+	}
+
+	log.Printf("Обновление от пользователя %d без доступа отклонено", user.ID)
+	if b.shouldRefuse(user.ID, time.Now()) {
+		b.refuse(update, user)
+	}
+	return false
+}
+
+// hasAccess сообщает, может ли пользователь пользоваться ботом, так же, как решает authorize.
+// По нему плановые задачи и рассылка выбирают, кому писать.
+func (b *Bot) hasAccess(userID int64) bool {
+	granted, _ := b.checkAccess(userID)
+	return granted
+}
+
+// checkAccess решает, есть ли у пользователя доступ по настройкам и решению администратора.
+// Вторым значением сообщает, что пользователь заблокирован: ему не помогает и код приглашения.
+func (b *Bot) checkAccess(userID int64) (granted, blocked bool) {
+	access := b.options.Access
+	if slices.Contains(access.Admins, userID) {
+		return true, false
+	}
+	allowed := slices.Contains(access.AllowedUsers, userID)
+
+	stored, err := b.storage.GetBotUser(userID)
+	if err != nil {
+		// Без базы неизвестно, кто заблокирован или одобрен: пускаем только тех, кого допускают настройки
+		log.Printf("Ошибка при проверке доступа пользователя %d: %v", userID, err)
+		return access.Mode == AccessOpen || allowed, false
+	}
+	if stored != nil && stored.Status == storage.AccessBlocked {
+		return false, true
+	}
+	return access.Mode == AccessOpen || allowed || stored != nil && stored.Status == storage.AccessApproved, false
+}
+
+// shouldRefuse сообщает, пора ли снова ответить пользователю отказом. Отвечаем не чаще
+// раза в refuseInterval, чтобы поток сообщений без доступа не нагружал базу и Telegram.
+func (b *Bot) shouldRefuse(userID int64, now time.Time) bool {
+	if last, ok := b.refusedAt[userID]; ok && now.Sub(last) < refuseInterval {
+		return false
+	}
+	b.refusedAt[userID] = now
+	if len(b.refusedAt) > refusedPruneSize {
+		for id, at := range b.refusedAt {
+			if now.Sub(at) >= refuseInterval {
+				delete(b.refusedAt, id)
+			}
+		}
+	}
+	return true
+}
+
+// refuse запоминает пользователя без доступа, сообщает администраторам о новом запросе
+// и объясняет пользователю, как получить доступ. Вызывается в цикле Run, не чаще
+// refuseInterval для одного пользователя.
+func (b *Bot) refuse(update tgbotapi.Update, user *tgbotapi.User) {
+	first, err := b.storage.RequestAccess(user.ID, handlers.MemberName(user))
+	if err != nil {
+		log.Printf("Ошибка при сохранении запроса доступа пользователя %d: %v", user.ID, err)
+	}
+	if first {
+		for _, admin := range b.options.Access.Admins {
+			b.sendText(admin, fmt.Sprintf("🔐 Запрос доступа: %s (ID: %d).\nОткрыть: /approve %d\nЗаблокировать: /block %d",
+				handlers.MemberName(user), user.ID, user.ID, user.ID))
+		}
+	}
+
+	text := fmt.Sprintf("Доступ к боту ограничен. Попросите администратора открыть его, ваш ID: %d.", user.ID)
+	if b.options.Access.Mode == AccessInvite {
+		text = fmt.Sprintf("Бот работает по приглашениям. Отправьте /start и код приглашения или попросите администратора открыть доступ, ваш ID: %d.", user.ID)
+	}
+	switch {
+	case update.CallbackQuery != nil:
+		if _, err := b.api.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "Доступ к боту ограничен.")); err != nil {
+			log.Printf("Ошибка при ответе на нажатие кнопки: %v", err)
+		}
+	case update.Message != nil && !handlers.IsGroupChat(update.Message):
+		b.sendText(update.Message.Chat.ID, text)
+	}
+}
@@ -1,28 +1,47 @@
 package bot
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	"money-bot/ai"
 	"money-bot/internal/handlers" // Импортируем наши хендлеры
+	"money-bot/internal/receipt"
+	"money-bot/internal/speech"
 	"money-bot/internal/storage"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// classifyTimeout - сколько ждать классификации транзакции, прежде чем сохранить её с категорией по умолчанию
+const classifyTimeout = 45 * time.Second
+
 // Bot структура содержит ссылку на API и другие зависимости
 type Bot struct {
 	api        *tgbotapi.BotAPI
 	storage    *storage.Storage // Добавляем поле для хранилища
 	categories []string         // Добавляем поле для категорий
+	// Категории доходов по умолчанию; пользователь может заменить их своими командой /sources
+	incomeCategories []string
+	options          Options
+	// Когда пользователям без доступа последний раз отвечали отказом; используется только в цикле Run
+	refusedAt map[int64]time.Time
+}
+
+// Options - необязательные внешние сервисы и настройки бота
+type Options struct {
+	ReceiptProvider receipt.Provider   // Расшифровка чеков по позициям; nil - чек сохраняется одной суммой
+	Transcriber     speech.Transcriber // Распознавание голосовых сообщений; nil - голосовые не обрабатываются
+	MonthlyInsights bool               // Рассылать обзоры трат первого числа каждого месяца
+	Access          AccessConfig       // Кто может пользоваться ботом
 }
 
 // NewBot создает новый экземпляр бота
-func NewBot(api *tgbotapi.BotAPI, s *storage.Storage) *Bot {
+func NewBot(api *tgbotapi.BotAPI, s *storage.Storage, options Options) *Bot {
 	// В будущем этот список можно будет загружать из файла конфигурации или базы данных
 	defaultCategories := []string{
 		"Автомобиль",           // Бензин, страховка, ремонт
@@ -43,10 +62,22 @@ func NewBot(api *tgbotapi.BotAPI, s *storage.Storage) *Bot {
 		"Уход за собой",    // Косметика, парикмахерская, спа
 		"Прочее",           // Другие расходы
 	}
+	defaultIncomeCategories := []string{
+		"Зарплата",
+		"Фриланс",            // Подработка, заказы
+		"Кэшбэк",             // Кэшбэк и бонусы банка
+		"Подарки и переводы", // Деньги в подарок, переводы от близких
+		"Проценты",           // Проценты по вкладам, дивиденды
+		"Возвраты",           // Возврат покупок и налоговый вычет
+		handlers.IncomeFallbackCategory,
+	}
 	return &Bot{
-		api:        api,
-		storage:    s,
-		categories: defaultCategories,
+		api:              api,
+		storage:          s,
+		categories:       defaultCategories,
+		incomeCategories: defaultIncomeCategories,
+		options:          options,
+		refusedAt:        make(map[int64]time.Time),
 	}
 }
 
@@ -57,142 +88,415 @@ func (b *Bot) Run() {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
+	go b.runScheduler()
+	go b.runReclassifier()
+
 	updates := b.api.GetUpdatesChan(u)
 	log.Println("Начинаем прослушивание обновлений...")
 
+	// Обновления разных чатов обрабатываются параллельно, чтобы долгий запрос к AI
+	// в одном чате не задерживал остальных; обновления одного чата - строго по порядку.
+	dispatcher := newDispatcher(b.handleUpdate)
 	for update := range updates {
 		log.Printf("Получено новое обновление. UpdateID: %d", update.UpdateID)
 
-		if update.Message == nil {
-			log.Println("Обновление не содержит сообщения, пропускаем.")
+		// Пользователи без доступа не доходят ни до одного обработчика
+		if !b.authorize(update) {
 			continue
 		}
 
-		log.Printf("Получено сообщение от пользователя %s (ID: %d) в чате %d: \"%s\"", update.Message.From.UserName, update.Message.From.ID, update.Message.Chat.ID, update.Message.Text)
-
-		// блок обработки команд от бота
-		if update.Message.IsCommand() {
-			command := update.Message.Command()
-			log.Printf("Сообщение является командой: /%s", command)
-			switch command {
-			case "start":
-				handlers.HandleStart(b.api, update)
-			case "today":
-				handlers.HandleReport(b.api, update, b.storage, "today")
-			case "week":
-				handlers.HandleReport(b.api, update, b.storage, "week")
-			case "month":
-				handlers.HandleReport(b.api, update, b.storage, "month")
-			case "export":
-				handlers.HandleExport(b.api, update, b.storage)
-			case "clear_last", "clearlast": // Принимаем оба варианта
-				handlers.HandleClearLast(b.api, update, b.storage)
-			case "clear_today", "cleartoday": // Принимаем оба варианта
-				handlers.HandleClearToday(b.api, update, b.storage)
-			default:
-				log.Printf("Неизвестная команда: /%s", command)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Я не знаю такой команды.")
-				if _, err := b.api.Send(msg); err != nil {
-					log.Printf("Ошибка при отправке сообщения о неизвестной команде: %v", err)
-				}
-			}
+		// Нажатия на кнопки обрабатываются в очереди того же чата, что и сообщения
+		if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+			dispatcher.dispatch(update.CallbackQuery.Message.Chat.ID, update)
+			continue
+		}
+		if update.Message == nil {
+			log.Println("Обновление не содержит сообщения, пропускаем.")
 			continue
 		}
+		dispatcher.dispatch(update.Message.Chat.ID, update)
+	}
+}
 
-		// Используем регулярное выражение для поиска числа в начале сообщения
-		log.Println("Сообщение не является командой, попытка обработать как транзакцию.")
-		// этот код предназначен для извлечения числа в начале текстового сообщения
-		re := regexp.MustCompile(`^-?\d+(\.\d+)?`)
-		matches := re.FindStringSubmatch(update.Message.Text)
-
-		if len(matches) > 0 {
-			log.Printf("Найдено число в сообщении: %s", matches[0])
-			amount, err := strconv.ParseFloat(matches[0], 64)
-			if err != nil {
-				log.Printf("Критическая ошибка: не удалось спарсить число '%s' после проверки регулярным выражением: %v", matches[0], err)
-				continue
-			}
+// handleUpdate обрабатывает одно входящее сообщение или нажатие на кнопку
+func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		b.handleCallback(update.CallbackQuery)
+		return
+	}
 
-			comment := strings.TrimSpace(strings.Replace(update.Message.Text, matches[0], "", 1))
-			log.Printf("Извлечена сумма: %.2f, комментарий: \"%s\"", amount, comment)
-
-			// === Изменения начинаются здесь ===
-			var category string
-			if amount < 0 { // Это расход, определяем категорию
-				if comment != "" {
-					log.Printf("Комментарий не пустой, начинаем классификацию транзакции...")
-					// Вызываем нашу функцию для классификации
-					category, err = ai.ClassifyTransaction(comment, b.categories)
-					if err != nil {
-						log.Printf("Ошибка при классификации транзакции: %v", err)
-						category = "Прочее" // Если произошла ошибка, используем категорию по умолчанию
-						log.Println("Установлена категория по умолчанию: 'Прочее'")
-					} else {
-						log.Printf("Транзакция успешно классифицирована. Категория: %s", category)
-					}
-				} else {
-					category = "Прочее" // Категория по умолчанию, если комментария нет
-					log.Println("Комментарий пустой, установлена категория по умолчанию: 'Прочее'")
-				}
-			} else {
-				// Для доходов устанавливаем категорию "Доход" без анализа
-				category = "Доход"
-				log.Printf("Транзакция является доходом, установлена категория: '%s'", category)
-			}
+	log.Printf("Получено сообщение от пользователя %s (ID: %d) в чате %d: \"%s\"", update.Message.From.UserName, update.Message.From.ID, update.Message.Chat.ID, update.Message.Text)
+
+	// Файл резервной копии, присланный с подписью /restore
+	if update.Message.Document != nil {
+		if command, args := captionCommand(update.Message.Caption); command == "restore" {
+			log.Println("Получен документ с подписью /restore, запускаем восстановление.")
+			handlers.HandleRestore(b.api, update, b.storage, update.Message.Document, args)
+			return
+		}
+	}
 
-			// Передаем категорию в функцию saveTransaction
-			log.Println("Вызов функции сохранения транзакции...")
-			b.saveTransaction(update, amount, comment, category)
+	// Фото кассового чека с QR-кодом
+	if handlers.IsReceiptImage(update.Message) {
+		log.Println("Сообщение содержит изображение, ищем QR-код чека.")
+		handlers.HandleReceiptPhoto(b.api, update, b.storage, b.options.ReceiptProvider, b.categories)
+		return
+	}
 
-		} else {
-			log.Printf("Сообщение не соответствует формату транзакции. Отправка подсказки пользователю.")
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Пожалуйста, введите число (например, 1000 или -500 на кофе).")
+	// Голосовое сообщение: распознаём речь и обрабатываем как текст
+	if update.Message.Voice != nil {
+		b.handleVoice(update)
+		return
+	}
+
+	// блок обработки команд от бота
+	if update.Message.IsCommand() {
+		command := update.Message.Command()
+		log.Printf("Сообщение является командой: /%s", command)
+		switch command {
+		case "start":
+			handlers.HandleStart(b.api, update)
+		case "today":
+			handlers.HandleReport(b.api, update, b.storage, "today", b.queryCategories(update.Message.From.ID))
+		case "week":
+			handlers.HandleReport(b.api, update, b.storage, "week", b.queryCategories(update.Message.From.ID))
+		case "month":
+			handlers.HandleReport(b.api, update, b.storage, "month", b.queryCategories(update.Message.From.ID))
+		case "report":
+			handlers.HandleReport(b.api, update, b.storage, update.Message.CommandArguments(), b.queryCategories(update.Message.From.ID))
+		case "tags":
+			handlers.HandleTags(b.api, update, b.storage, b.queryCategories(update.Message.From.ID))
+		case "find":
+			handlers.HandleFind(b.api, update, b.storage, b.queryCategories(update.Message.From.ID))
+		case "export":
+			handlers.HandleExport(b.api, update, b.storage, b.queryCategories(update.Message.From.ID))
+		case "ask":
+			handlers.HandleAsk(b.api, update, b.storage, b.queryCategories(update.Message.From.ID), update.Message.CommandArguments())
+		case "sources":
+			handlers.HandleIncomeCategories(b.api, update, b.storage, b.incomeCategories)
+		case "recategorize":
+			handlers.HandleRecategorize(b.api, update, b.storage, b.categories)
+		case "insights":
+			handlers.HandleInsights(b.api, update, b.storage)
+		case "backup":
+			handlers.HandleBackup(b.api, update, b.storage)
+		case "restore":
+			// Команда может быть ответом на сообщение с файлом резервной копии
+			var document *tgbotapi.Document
+			if update.Message.ReplyToMessage != nil {
+				document = update.Message.ReplyToMessage.Document
+			}
+			handlers.HandleRestore(b.api, update, b.storage, document, update.Message.CommandArguments())
+		case "members":
+			handlers.HandleMembers(b.api, update, b.storage)
+		case "invite":
+			handlers.HandleInvite(b.api, update, b.storage)
+		case "remove":
+			handlers.HandleRemoveMember(b.api, update, b.storage)
+		case "debts":
+			handlers.HandleDebts(b.api, update, b.storage)
+		case "settle":
+			handlers.HandleSettle(b.api, update, b.storage)
+		case "goal", "goals":
+			handlers.HandleGoal(b.api, update, b.storage)
+		case "lend":
+			handlers.HandleLend(b.api, update, b.storage)
+		case "borrow":
+			handlers.HandleBorrow(b.api, update, b.storage)
+		case "repay":
+			handlers.HandleRepay(b.api, update, b.storage)
+		case "loans":
+			handlers.HandleLoans(b.api, update, b.storage)
+		case "clear_last", "clearlast": // Принимаем оба варианта
+			handlers.HandleClearLast(b.api, update, b.storage)
+		case "clear_today", "cleartoday": // Принимаем оба варианта
+			handlers.HandleClearToday(b.api, update, b.storage)
+		case "delete":
+			handlers.HandleDelete(b.api, update, b.storage, b.queryCategories(update.Message.From.ID))
+		case "undo":
+			handlers.HandleUndo(b.api, update, b.storage)
+		case "trash":
+			handlers.HandleTrash(b.api, update, b.storage)
+		case "history":
+			handlers.HandleHistory(b.api, update, b.storage)
+		case "audit":
+			handlers.HandleAuditExport(b.api, update, b.storage)
+		case "approve":
+			handlers.HandleApprove(b.api, update, b.storage, b.options.Access.Admins)
+		case "block":
+			handlers.HandleBlock(b.api, update, b.storage, b.options.Access.Admins)
+		case "users":
+			handlers.HandleUsers(b.api, update, b.storage, b.options.Access.Admins)
+		case "admin":
+			handlers.HandleAdmin(b.api, update, b.storage, b.options.Access.Admins, b.hasAccess)
+		default:
+			log.Printf("Неизвестная команда: /%s", command)
+			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Я не знаю такой команды.")
 			if _, err := b.api.Send(msg); err != nil {
-				log.Printf("Ошибка при отправке подсказки: %v", err)
+				log.Printf("Ошибка при отправке сообщения о неизвестной команде: %v", err)
 			}
 		}
+		return
 	}
+
+	// Текст, скопированный из QR-кода чека
+	if receipt.LooksLikeQR(update.Message.Text) {
+		log.Println("Сообщение похоже на содержимое QR-кода чека.")
+		handlers.HandleReceiptText(b.api, update, b.storage, update.Message.Text, b.options.ReceiptProvider, b.categories)
+		return
+	}
+
+	log.Println("Сообщение не является командой, попытка обработать как транзакцию.")
+	b.handleTransactionText(update, update.Message.Text)
 }
 
-// saveTransaction сохраняет транзакцию в базе данных
-func (b *Bot) saveTransaction(update tgbotapi.Update, amount float64, comment, category string) {
-	log.Printf("Подготовка к сохранению транзакции: UserID=%d, Amount=%.2f, Comment='%s', Category='%s'", update.Message.From.ID, amount, comment, category)
+// handleTransactionText разбирает текст вида "ЧИСЛО КОММЕНТАРИЙ", определяет категорию и сохраняет транзакцию
+func (b *Bot) handleTransactionText(update tgbotapi.Update, text string) {
+	amount, comment, ok := parseTransaction(text)
+	// В группе люди переписываются между собой: отвечаем только на сообщения с суммой
+	if !ok && handlers.IsGroupChat(update.Message) {
+		log.Println("Сообщение в группе не похоже на транзакцию, пропускаем.")
+		return
+	}
+	if !ok && isQuestion(text) {
+		log.Println("Сообщение похоже на вопрос, передаём его в /ask.")
+		handlers.HandleAsk(b.api, update, b.storage, b.queryCategories(update.Message.From.ID), text)
+		return
+	}
+	if !ok {
+		log.Printf("Сообщение не соответствует формату транзакции. Отправка подсказки пользователю.")
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Пожалуйста, введите число (например, 1000 или -500 на кофе).")
+		if _, err := b.api.Send(msg); err != nil {
+			log.Printf("Ошибка при отправке подсказки: %v", err)
+		}
+		return
+	}
+	log.Printf("Извлечена сумма: %.2f, комментарий: \"%s\"", amount, comment)
+
+	// В группе транзакция попадает в общую книгу, если у автора есть право её пополнять
+	scope, ok := handlers.ChatScope(b.api, update.Message, b.storage, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Ответ на запрос изменения транзакции из результатов /find
+	if update.Message.ReplyToMessage != nil && b.handleEditReply(update, scope, amount, comment) {
+		return
+	}
+
+	// Сумма с тегом цели накоплений - это взнос в цель, а не расход
+	if !scope.IsLedger() && handlers.HandleGoalContribution(b.api, update, b.storage, amount, comment) {
+		return
+	}
+
+	// Доход в ответ на сообщение о покупке - это возврат по ней
+	if amount > 0 && update.Message.ReplyToMessage != nil && b.handleRefundReply(update, scope, amount, comment) {
+		return
+	}
+
+	// В общей книге расход можно разделить с участниками, упомянув их: "-3000 ужин @anna @oleg"
+	var splits []storage.Split
+	if scope.IsLedger() {
+		var shares []handlers.SplitShare
+		if comment, shares = handlers.ParseSplit(comment); len(shares) > 0 {
+			if amount >= 0 {
+				b.sendText(update.Message.Chat.ID, "Разделить с участниками можно только расход.")
+				return
+			}
+			var err error
+			if splits, err = handlers.ResolveSplit(b.storage, scope.LedgerID, update.Message.From.ID, -amount, shares); err != nil {
+				log.Printf("Не удалось разделить расход: %v", err)
+				b.sendText(update.Message.Chat.ID, fmt.Sprintf("Не удалось разделить расход: %v.\nПример: -3000 ужин @anna @oleg=1000 или -3000 ужин @anna=40%%", err))
+				return
+			}
+			log.Printf("Расход разделён на %d долей", len(splits))
+		}
+	}
+
+	// Теги отделяются от комментария, чтобы не мешать классификации
+	comment, tags := handlers.ParseTags(comment)
+
 	transaction := &storage.Transaction{
 		UserID:          update.Message.From.ID,
+		LedgerID:        scope.LedgerID,
 		Amount:          amount,
 		Comment:         comment,
-		Category:        category, // Убедитесь, что поле Category добавлено в структуру storage.Transaction
 		TransactionDate: time.Now(),
+		Splits:          splits,
+		Tags:            tags,
 	}
-
-	if err := b.storage.SaveTransaction(transaction); err != nil {
-		log.Printf("Ошибка при сохранении транзакции в БД: %v", err)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Произошла ошибка при сохранении транзакции. Попробуйте еще раз.")
-		if _, err := b.api.Send(msg); err != nil {
-			log.Printf("Ошибка при отправке сообщения об ошибке сохранения: %v", err)
+	// Расходы и доходы классифицируются по своим спискам категорий
+	categories, fallback := b.categories, "Прочее"
+	if amount > 0 {
+		categories, fallback = b.userIncomeCategories(transaction.UserID), handlers.IncomeFallbackCategory
+	}
+	transaction.Category = fallback
+	// Варианты категорий, если классификатор не уверен
+	var candidates []string
+	// Классификацию не удалось выполнить, её нужно повторить позже
+	pending := false
+	// Доход похож на возврат: предложим выбрать покупку, по которой он получен
+	refund := amount > 0 && isRefundComment(comment)
+	if refund {
+		if slices.Contains(categories, refundCategory) {
+			transaction.Category = refundCategory
 		}
-	} else {
-		log.Printf("Транзакция успешно сохранена в БД. ID транзакции: %d", transaction.ID)
-		var responseText string
-		if amount > 0 {
-			responseText = "✅ Доход успешно сохранён!"
+		log.Printf("Доход похож на возврат, установлена категория '%s'", transaction.Category)
+	} else if comment != "" {
+		log.Printf("Комментарий не пустой, начинаем классификацию транзакции...")
+		// Вызываем нашу функцию для классификации
+		ctx, cancel := context.WithTimeout(context.Background(), classifyTimeout)
+		classification, err := handlers.ClassifyComment(ctx, b.storage, transaction.UserID, comment, categories)
+		cancel()
+		if err != nil {
+			log.Printf("Ошибка при классификации транзакции: %v", err)
+			// Пока AI недоступен, используем категорию по умолчанию и повторим классификацию позже
+			pending = true
+			log.Printf("Установлена категория по умолчанию: '%s', транзакция будет классифицирована повторно", fallback)
 		} else {
-			responseText = "✅ Расход успешно сохранён!"
+			log.Printf("Транзакция успешно классифицирована. Категория: %s, уверенность: %.2f", classification.Category, classification.Confidence)
+			transaction.Category = classification.Category
+			transaction.Merchant = classification.Merchant
+			if classification.Confidence < handlers.LowConfidence {
+				candidates = categoryChoices(classification.Candidates, categories)
+				log.Printf("Уверенность ниже %.2f, предложим пользователю выбрать из %v", handlers.LowConfidence, candidates)
+			}
 		}
-		// Добавляем сумму в ответ для наглядности
-		responseText += "\nСумма: " + strconv.FormatFloat(amount, 'f', 2, 64)
+	} else {
+		log.Printf("Комментарий пустой, установлена категория по умолчанию: '%s'", fallback)
+	}
+
+	log.Println("Вызов функции сохранения транзакции...")
+	if !b.saveTransaction(update, transaction) {
+		return
+	}
 
-		if comment != "" {
-			responseText += "\nКомментарий: " + comment
+	var (
+		note     string
+		keyboard *tgbotapi.InlineKeyboardMarkup
+	)
+	switch {
+	case pending:
+		if err := b.storage.AddPendingClassification(transaction.ID, transaction.UserID, update.Message.Chat.ID); err != nil {
+			log.Printf("Ошибка при постановке транзакции %d в очередь классификации: %v", transaction.ID, err)
+		}
+		note = "⏳ AI сейчас недоступен, категорию определю позже и сообщу."
+	case len(candidates) > 0:
+		markup := categoryKeyboard(transaction.ID, candidates)
+		note, keyboard = "🤔 Не уверен в категории. Выберите подходящую:", &markup
+	case refund:
+		if markup := b.refundKeyboard(transaction); markup != nil {
+			note, keyboard = "↩️ Похоже на возврат. За какую покупку? Тогда сумма уменьшит расходы этой покупки, а не попадёт в доходы.", markup
+		}
+	}
+	if len(splits) > 0 {
+		splitNote := handlers.SplitNote(b.storage, scope.LedgerID, splits)
+		if note != "" {
+			splitNote += "\n\n" + note
 		}
+		note = splitNote
+	}
+	b.sendConfirmation(update, transaction, note, keyboard)
+}
 
-		// === Добавляем категорию в ответное сообщение ===
-		responseText += "\nКатегория: " + category
+// queryCategories возвращает все категории пользователя, расходов и доходов: по ним задаются вопросы
+// и к их написанию приводятся категории в фильтрах команд
+func (b *Bot) queryCategories(userID int64) []string {
+	return append(append([]string{}, b.categories...), b.userIncomeCategories(userID)...)
+}
 
-		log.Printf("Отправка подтверждения пользователю: \"%s\"", responseText)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, responseText)
-		if _, err := b.api.Send(msg); err != nil {
-			log.Printf("Ошибка при отправке подтверждения о сохранении: %v", err)
-		}
+// userIncomeCategories возвращает категории доходов пользователя
+func (b *Bot) userIncomeCategories(userID int64) []string {
+	return handlers.UserIncomeCategories(b.storage, userID, b.incomeCategories)
+}
+
+// categoriesFor возвращает список категорий, подходящий для транзакции с суммой amount
+func (b *Bot) categoriesFor(userID int64, amount float64) []string {
+	if amount > 0 {
+		return b.userIncomeCategories(userID)
+	}
+	return b.categories
+}
+
+// captionCommand извлекает команду и её аргументы из подписи к файлу.
+// Telegram не помечает подписи как команды, поэтому разбираем текст сами.
+func captionCommand(caption string) (string, string) {
+	caption = strings.TrimSpace(caption)
+	if !strings.HasPrefix(caption, "/") {
+		return "", ""
+	}
+	command, args, _ := strings.Cut(caption[1:], " ")
+	// Отбрасываем упоминание бота: /restore@money_bot
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(args)
+}
+
+// saveTransaction сохраняет транзакцию в базе данных. Возвращает true, если транзакция сохранена;
+// иначе пользователь получает сообщение об ошибке.
+func (b *Bot) saveTransaction(update tgbotapi.Update, transaction *storage.Transaction) bool {
+	log.Printf("Подготовка к сохранению транзакции: UserID=%d, Amount=%.2f, Comment='%s', Category='%s'", transaction.UserID, transaction.Amount, transaction.Comment, transaction.Category)
+
+	if err := b.storage.SaveTransaction(transaction); err != nil {
+		log.Printf("Ошибка при сохранении транзакции в БД: %v", err)
+		b.sendText(update.Message.Chat.ID, "Произошла ошибка при сохранении транзакции. Попробуйте еще раз.")
+		return false
+	}
+	log.Printf("Транзакция успешно сохранена в БД. ID транзакции: %d", transaction.ID)
+	return true
+}
+
+// sendConfirmation отправляет подтверждение о сохранённой транзакции с необязательной припиской и кнопками.
+// Сообщение пользователя и подтверждение связываются с транзакцией, чтобы на них можно было ответить.
+func (b *Bot) sendConfirmation(update tgbotapi.Update, transaction *storage.Transaction, note string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, transactionConfirmation(transaction))
+	if note != "" {
+		msg.Text += "\n\n" + note
+	}
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	log.Printf("Отправка подтверждения пользователю: \"%s\"", msg.Text)
+	sent, err := b.api.Send(msg)
+	if err != nil {
+		log.Printf("Ошибка при отправке подтверждения о сохранении: %v", err)
+	}
+
+	b.linkMessage(update.Message.Chat.ID, update.Message.MessageID, transaction.ID)
+	if err == nil {
+		b.linkMessage(update.Message.Chat.ID, sent.MessageID, transaction.ID)
+	}
+}
+
+// linkMessage запоминает, что сообщение относится к транзакции
+func (b *Bot) linkMessage(chatID int64, messageID int, transactionID uint) {
+	if err := b.storage.SaveMessageLink(chatID, messageID, transactionID); err != nil {
+		log.Printf("Ошибка при сохранении связи сообщения %d с транзакцией %d: %v", messageID, transactionID, err)
+	}
+}
+
+// transactionConfirmation формирует текст подтверждения о сохранённой транзакции
+func transactionConfirmation(transaction *storage.Transaction) string {
+	var responseText string
+	if transaction.RefundOfID != nil {
+		responseText = "↩️ Возврат успешно сохранён!"
+	} else if transaction.Amount > 0 {
+		responseText = "✅ Доход успешно сохранён!"
+	} else {
+		responseText = "✅ Расход успешно сохранён!"
+	}
+	// Добавляем сумму в ответ для наглядности
+	responseText += "\nСумма: " + strconv.FormatFloat(transaction.Amount, 'f', 2, 64)
+
+	if transaction.Comment != "" {
+		responseText += "\nКомментарий: " + transaction.Comment
+	}
+	if transaction.Merchant != "" {
+		responseText += "\nПродавец: " + transaction.Merchant
+	}
+
+	responseText += "\nКатегория: " + transaction.Category
+	if len(transaction.Tags) > 0 {
+		responseText += "\nТеги: " + handlers.FormatTags(transaction)
 	}
+	return responseText
 }
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"money-bot/internal/handlers"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// callbackCategory - префикс данных кнопки выбора категории: cat:<ID транзакции>:<категория>
+const callbackCategory = "cat"
+
+// maxCallbackData - ограничение Telegram на размер данных inline-кнопки в байтах
+const maxCallbackData = 64
+
+// maxCategoryButtons - сколько категорий предлагать на выбор при неуверенной классификации
+const maxCategoryButtons = 3
+
+// categoryChoices дополняет варианты классификатора первыми категориями из списка,
+// чтобы пользователю было из чего выбрать, даже если модель не назвала альтернатив
+func categoryChoices(candidates, categories []string) []string {
+	choices := slices.Clone(candidates)
+	for _, category := range categories {
+		if len(choices) >= maxCategoryButtons {
+			break
+		}
+		if !slices.Contains(choices, category) {
+			choices = append(choices, category)
+		}
+	}
+	return choices
+}
+
+// categoryKeyboard создает кнопки выбора категории для сохранённой транзакции.
+// Категории, название которых не помещается в данные кнопки, пропускаются.
+func categoryKeyboard(transactionID uint, candidates []string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, category := range candidates {
+		data := fmt.Sprintf("%s:%d:%s", callbackCategory, transactionID, category)
+		if len(data) > maxCallbackData {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(category, data)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleCallback обрабатывает нажатие на inline-кнопку
+func (b *Bot) handleCallback(query *tgbotapi.CallbackQuery) {
+	log.Printf("Нажата кнопка пользователем %s (ID: %d): \"%s\"", query.From.UserName, query.From.ID, query.Data)
+
+	prefix, args, _ := strings.Cut(query.Data, ":")
+	switch prefix {
+	case callbackCategory:
+		b.handleCategoryCallback(query, args)
+	case callbackRefund:
+		b.handleRefundCallback(query, args)
+	case handlers.CallbackRecategorize:
+		handlers.HandleRecategorizeCallback(b.api, query, b.storage, args)
+	case handlers.CallbackFind:
+		handlers.HandleFindCallback(b.api, query, b.storage, args, b.queryCategories(query.From.ID))
+	case handlers.CallbackDelete:
+		handlers.HandleDeleteCallback(b.api, query, b.storage, args, b.queryCategories(query.From.ID))
+	case handlers.CallbackTrash:
+		handlers.HandleTrashCallback(b.api, query, b.storage, args)
+	case handlers.CallbackAdmin:
+		handlers.HandleAdminCallback(b.api, query, b.storage, b.options.Access.Admins, b.hasAccess, args)
+	default:
+		log.Printf("Неизвестные данные кнопки: %s", query.Data)
+		b.answerCallback(query, "Эта кнопка больше не работает.")
+	}
+}
+
+// handleCategoryCallback меняет категорию транзакции на выбранную пользователем.
+// Категория проверяется по текущему списку: расходов или доходов, в зависимости от транзакции.
+func (b *Bot) handleCategoryCallback(query *tgbotapi.CallbackQuery, args string) {
+	idText, category, _ := strings.Cut(args, ":")
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		log.Printf("Некорректный ID транзакции в кнопке: %s", args)
+		b.answerCallback(query, "Эта кнопка больше не работает.")
+		return
+	}
+
+	transaction, err := b.storage.GetTransaction(query.From.ID, uint(id))
+	if err != nil {
+		log.Printf("Ошибка при получении транзакции %d: %v", id, err)
+		b.answerCallback(query, "Не удалось изменить категорию: транзакция не найдена.")
+		return
+	}
+	if !slices.Contains(b.categoriesFor(query.From.ID, transaction.Amount), category) {
+		log.Printf("Категории '%s' нет в списке для транзакции %d", category, id)
+		b.answerCallback(query, "Такой категории больше нет.")
+		return
+	}
+
+	transaction, err = b.storage.UpdateTransactionCategory(query.From.ID, uint(id), category)
+	if err != nil {
+		log.Printf("Ошибка при смене категории транзакции %d: %v", id, err)
+		b.answerCallback(query, "Не удалось изменить категорию: транзакция не найдена.")
+		return
+	}
+	log.Printf("Категория транзакции %d изменена на '%s'", id, category)
+	// Запоминаем выбор пользователя, чтобы такой же комментарий больше не переспрашивать
+	if err := b.storage.SaveCachedClassification(query.From.ID, transaction.Comment, category, transaction.Merchant, 1); err != nil {
+		log.Printf("Ошибка при сохранении категории в кеш: %v", err)
+	}
+	b.answerCallback(query, "Категория: "+category)
+
+	// Обновляем подтверждение и убираем кнопки
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, transactionConfirmation(transaction))
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Ошибка при обновлении сообщения после выбора категории: %v", err)
+	}
+}
+
+// answerCallback отвечает на нажатие кнопки всплывающим уведомлением
+func (b *Bot) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Ошибка при ответе на нажатие кнопки: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dispatcher раздаёт обновления по очередям чатов: каждый чат обрабатывается
+// своей горутиной по порядку, а разные чаты - параллельно
+type dispatcher struct {
+	mu     sync.Mutex
+	queues map[int64][]tgbotapi.Update // Наличие ключа означает, что горутина чата запущена
+	handle func(tgbotapi.Update)
+}
+
+// newDispatcher создает диспетчер, вызывающий handle для каждого обновления
+func newDispatcher(handle func(tgbotapi.Update)) *dispatcher {
+	return &dispatcher{
+		queues: make(map[int64][]tgbotapi.Update),
+		handle: handle,
+	}
+}
+
+// dispatch ставит обновление в очередь чата и при необходимости запускает её обработку
+func (d *dispatcher) dispatch(chatID int64, update tgbotapi.Update) {
+	d.mu.Lock()
+	queue, running := d.queues[chatID]
+	d.queues[chatID] = append(queue, update)
+	d.mu.Unlock()
+
+	if !running {
+		go d.drain(chatID)
+	}
+}
+
+// drain обрабатывает очередь чата, пока она не опустеет
+func (d *dispatcher) drain(chatID int64) {
+	for {
+		d.mu.Lock()
+		queue := d.queues[chatID]
+		if len(queue) == 0 {
+			delete(d.queues, chatID)
+			d.mu.Unlock()
+			return
+		}
+		update := queue[0]
+		d.queues[chatID] = queue[1:]
+		d.mu.Unlock()
+
+		d.handle(update)
+	}
+}
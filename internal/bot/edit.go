@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+
+	"money-bot/internal/handlers"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// handleEditReply заменяет сумму и комментарий транзакции, если сообщение - ответ на запрос изменения из /find.
+// Возвращает false, если сообщение отвечает на что-то другое и его нужно обработать как обычно.
+func (b *Bot) handleEditReply(update tgbotapi.Update, scope storage.Scope, amount float64, comment string) bool {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	prompt, err := b.storage.GetEditPrompt(chatID, update.Message.ReplyToMessage.MessageID)
+	if err != nil {
+		log.Printf("Ошибка при поиске запроса на изменение по сообщению: %v", err)
+		return false
+	}
+	if prompt == nil {
+		return false
+	}
+	if prompt.UserID != userID {
+		b.sendText(chatID, "Изменить эту транзакцию может только тот, кто нажал кнопку изменения.")
+		return true
+	}
+	transaction, err := b.storage.GetScopedTransaction(scope, prompt.TransactionID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ошибка при получении транзакции %d: %v", prompt.TransactionID, err)
+		}
+		b.sendText(chatID, "Транзакция не найдена, возможно, она уже удалена.")
+		return true
+	}
+	if !handlers.CanModifyTransaction(b.storage, scope, userID, transaction) {
+		b.sendText(chatID, "Изменять чужие транзакции может только владелец общего бюджета.")
+		return true
+	}
+	log.Printf("Изменение транзакции %d: сумма %.2f, комментарий \"%s\"", transaction.ID, amount, comment)
+
+	// Доли участников и привязка возврата рассчитаны от суммы, поэтому её здесь не меняем
+	if amount != transaction.Amount && (len(transaction.Splits) > 0 || transaction.RefundOfID != nil) {
+		b.sendText(chatID, "Сумму разделённого расхода или возврата изменить нельзя: удалите транзакцию и запишите заново.")
+		return true
+	}
+	// Возвраты по покупке не могут превышать её сумму, а смена знака превратила бы её в доход
+	if amount != transaction.Amount {
+		refunded, err := b.storage.HasRefunds(transaction.ID)
+		if err != nil {
+			log.Printf("Ошибка при проверке возвратов по транзакции %d: %v", transaction.ID, err)
+			b.sendText(chatID, "Произошла ошибка при изменении транзакции. Попробуйте еще раз.")
+			return true
+		}
+		if refunded {
+			b.sendText(chatID, "По этой покупке записаны возвраты (возможно, в корзине), поэтому её сумму изменить нельзя. Изменить можно только комментарий.")
+			return true
+		}
+	}
+
+	comment, tags := handlers.ParseTags(comment)
+	signChanged := math.Signbit(amount) != math.Signbit(transaction.Amount)
+	if comment != transaction.Comment || signChanged {
+		b.reclassify(transaction, amount, comment, signChanged)
+	}
+	transaction.Amount = amount
+	transaction.Comment = comment
+	transaction.Tags = tags
+
+	if err := b.storage.As(userID).UpdateTransaction(transaction); err != nil {
+		log.Printf("Ошибка при изменении транзакции %d: %v", transaction.ID, err)
+		b.sendText(chatID, "Произошла ошибка при изменении транзакции. Попробуйте еще раз.")
+		return true
+	}
+	log.Printf("Транзакция %d изменена", transaction.ID)
+	b.sendConfirmation(update, transaction, "✏️ Транзакция изменена.", nil)
+	return true
+}
+
+// reclassify определяет категорию изменённой транзакции по новому комментарию. Если AI недоступен,
+// остаётся прежняя категория, а при смене расхода на доход и наоборот - категория по умолчанию.
+// Возврат остаётся в категории своей покупки.
+func (b *Bot) reclassify(transaction *storage.Transaction, amount float64, comment string, signChanged bool) {
+	if transaction.RefundOfID != nil {
+		return
+	}
+	categories, fallback := b.categories, "Прочее"
+	if amount > 0 {
+		categories, fallback = b.userIncomeCategories(transaction.UserID), handlers.IncomeFallbackCategory
+	}
+	if signChanged {
+		transaction.Category, transaction.Merchant = fallback, ""
+	}
+	if comment == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), classifyTimeout)
+	defer cancel()
+	classification, err := handlers.ClassifyComment(ctx, b.storage, transaction.UserID, comment, categories)
+	if err != nil {
+		log.Printf("Ошибка при классификации изменённой транзакции %d: %v", transaction.ID, err)
+		return
+	}
+	log.Printf("Изменённая транзакция %d классифицирована. Категория: %s", transaction.ID, classification.Category)
+	transaction.Category = classification.Category
+	transaction.Merchant = classification.Merchant
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"money-bot/internal/numwords"
+)
+
+// amountRe находит число в начале текстового сообщения
+var amountRe = regexp.MustCompile(`^-?\d+(\.\d+)?`)
+
+// Слова, обозначающие валюту, которые пишут или произносят после суммы
+var currencyWords = map[string]bool{
+	"рубль": true, "рубля": true, "рублей": true, "руб": true, "р": true, "₽": true,
+}
+
+// parseTransaction извлекает сумму и комментарий из текста вида "ЧИСЛО КОММЕНТАРИЙ".
+// Сумма может быть записана цифрами ("-500 такси"), словами ("-пятьсот такси",
+// "минус тысяча двести за свет") или смешанно ("-1,5 тыс продукты").
+// Нулевая сумма транзакцией не считается: у неё нет ни расхода, ни дохода.
+func parseTransaction(text string) (float64, string, bool) {
+	text = strings.TrimSpace(text)
+
+	// Знак суммы: минус перед числом или слово "минус"/"плюс"
+	sign := 1.0
+	unsigned := text
+	switch {
+	case strings.HasPrefix(unsigned, "-"):
+		sign = -1
+		unsigned = strings.TrimSpace(unsigned[1:])
+	case strings.HasPrefix(unsigned, "+"):
+		unsigned = strings.TrimSpace(unsigned[1:])
+	default:
+		first, rest, _ := strings.Cut(unsigned, " ")
+		switch strings.ToLower(strings.Trim(first, ",")) {
+		case "минус":
+			sign = -1
+			unsigned = rest
+		case "плюс":
+			unsigned = rest
+		}
+	}
+
+	if value, rest, ok := numwords.ParseLeading(unsigned); ok {
+		log.Printf("Найдено число в сообщении: %g", value)
+		if value == 0 {
+			return 0, "", false
+		}
+		return sign * value, trimCurrency(rest), true
+	}
+
+	// Число, слитное с комментарием: "-500кофе"
+	matches := amountRe.FindStringSubmatch(text)
+	if len(matches) == 0 {
+		return 0, "", false
+	}
+
+	// К числу может быть приклеено только слово: "1e5" или "12:30" суммой не считаются
+	first, _, _ := strings.Cut(text, " ")
+	glued := strings.TrimLeft(strings.TrimPrefix(first, matches[0]), ".,;:!?")
+	if glued != "" && !isWord(glued) && !currencyWords[strings.ToLower(glued)] {
+		log.Printf("После числа '%s' идёт '%s', сообщение не считается транзакцией", matches[0], glued)
+		return 0, "", false
+	}
+
+	log.Printf("Найдено число в сообщении: %s", matches[0])
+	amount, err := strconv.ParseFloat(matches[0], 64)
+	if err != nil {
+		log.Printf("Критическая ошибка: не удалось спарсить число '%s' после проверки регулярным выражением: %v", matches[0], err)
+		return 0, "", false
+	}
+	if amount == 0 {
+		return 0, "", false
+	}
+
+	comment := strings.TrimSpace(strings.Replace(text, matches[0], "", 1))
+	return amount, trimCurrency(comment), true
+}
+
+// isWord сообщает, что строка состоит только из букв
+func isWord(text string) bool {
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimCurrency убирает обозначение валюты в начале комментария: "рублей на кофе" -> "на кофе"
+func trimCurrency(comment string) string {
+	first, rest, _ := strings.Cut(comment, " ")
+	if currencyWords[strings.ToLower(strings.Trim(first, ".,"))] {
+		return strings.TrimSpace(rest)
+	}
+	return comment
+}
+
+// isQuestion сообщает, похож ли текст, не распознанный как транзакция, на вопрос о тратах
+func isQuestion(text string) bool {
+	return strings.HasSuffix(strings.TrimSpace(text), "?")
+}
+
+// normalizeSpokenText убирает из распознанной речи знаки препинания в конце фразы:
+// "Минус триста рублей на кофе." -> "Минус триста рублей на кофе"
+func normalizeSpokenText(text string) string {
+	return strings.TrimRight(strings.TrimSpace(text), ".!?")
+}
+
+// refundWords - начала слов, по которым доход распознаётся как возврат покупки
+var refundWords = []string{"возврат", "вернул", "refund"}
+
+// isRefundComment сообщает, похож ли комментарий к доходу на возврат покупки
+func isRefundComment(comment string) bool {
+	for _, word := range strings.Fields(strings.ToLower(comment)) {
+		for _, prefix := range refundWords {
+			if strings.HasPrefix(word, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
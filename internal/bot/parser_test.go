@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseTransaction(t *testing.T) {
+	tests := []struct {
+		text    string
+		amount  float64
+		comment string
+		wantOK  bool
+	}{
+		// Цифры
+		{"500 зарплата", 500, "зарплата", true},
+		{"-500 такси", -500, "такси", true},
+		{"+500 кэшбэк", 500, "кэшбэк", true},
+		{"- 500 такси", -500, "такси", true},
+		{"-99.90 кофе", -99.9, "кофе", true},
+		{"-300 рублей на кофе", -300, "на кофе", true},
+		{"-300 р. обед", -300, "обед", true},
+		{"-500кофе", -500, "кофе", true},
+		{"-500₽ кофе", -500, "кофе", true},
+
+		// Слова и знак словом
+		{"-пятьсот такси", -500, "такси", true},
+		{"минус тысяча двести за свет", -1200, "за свет", true},
+		{"Минус, триста рублей на кофе", -300, "на кофе", true},
+		{"тысяча двести за свет", 1200, "за свет", true},
+		{"плюс полторы тысячи подработка", 1500, "подработка", true},
+		{"-полторы тысячи продукты", -1500, "продукты", true},
+		{"минус две с половиной тысячи ремонт", -2500, "ремонт", true},
+		{"-две с половиной кофе", -2.5, "кофе", true},
+
+		// Смешанная запись
+		{"-1,5 тыс продукты", -1500, "продукты", true},
+		{"1,5 тыс подарок", 1500, "подарок", true},
+		{"минус 2 млн квартира", -2000000, "квартира", true},
+
+		// Нулевые суммы
+		{"ноль кофе", 0, "", false},
+		{"-0", 0, "", false},
+		{"+0 кофе", 0, "", false},
+		{"минус ноль", 0, "", false},
+		{"-0кофе", 0, "", false},
+		{"0.00 кофе", 0, "", false},
+
+		// Не транзакции
+		{"1e5 кофе", 0, "", false},
+		{"12:30 встреча", 0, "", false},
+		{"тысяча тысяча", 0, "", false},
+		{"кофе 500", 0, "", false},
+		{"привет", 0, "", false},
+		{"", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			amount, comment, ok := parseTransaction(tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("parseTransaction(%q) ok = %v, ожидалось %v", tt.text, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if math.Abs(amount-tt.amount) > 1e-9 || comment != tt.comment {
+				t.Errorf("parseTransaction(%q) = (%g, %q), ожидалось (%g, %q)", tt.text, amount, comment, tt.amount, tt.comment)
+			}
+		})
+	}
+}
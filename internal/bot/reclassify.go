@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"money-bot/ai"
+	"money-bot/internal/handlers"
+	"money-bot/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// reclassifyInterval - как часто проверять очередь неклассифицированных транзакций
+	reclassifyInterval = time.Minute
+	// reclassifyBatch - сколько транзакций из очереди обрабатывать за один проход
+	reclassifyBatch = 20
+	// reclassifyMaxAttempts - после стольких неудачных попыток транзакция остаётся в категории по умолчанию
+	reclassifyMaxAttempts = 12
+	// reclassifyBaseDelay и reclassifyMaxDelay ограничивают паузу между попытками, она удваивается с каждой неудачей
+	reclassifyBaseDelay = 5 * time.Minute
+	reclassifyMaxDelay  = 6 * time.Hour
+)
+
+// runReclassifier периодически повторяет классификацию транзакций, сохранённых, пока AI был недоступен
+func (b *Bot) runReclassifier() {
+	ticker := time.NewTicker(reclassifyInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.reclassifyPending(time.Now())
+	}
+}
+
+// reclassifyPending обрабатывает очередь и сообщает пользователям итоговые категории.
+// Результаты собираются по чатам, чтобы чек из многих позиций не порождал десятки сообщений.
+func (b *Bot) reclassifyPending(now time.Time) {
+	pending, err := b.storage.GetDuePendingClassifications(now, reclassifyBatch)
+	if err != nil {
+		log.Printf("Ошибка при чтении очереди классификации: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+	log.Printf("Повторная классификация: в очереди %d транзакций", len(pending))
+
+	resolved := make(map[int64][]string)
+	var chatOrder []int64
+	report := func(chatID int64, line string) {
+		if _, ok := resolved[chatID]; !ok {
+			chatOrder = append(chatOrder, chatID)
+		}
+		resolved[chatID] = append(resolved[chatID], line)
+	}
+
+	for i := range pending {
+		p := &pending[i]
+		transaction, err := b.storage.GetTransaction(p.UserID, p.TransactionID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Транзакцию уже удалили, классифицировать нечего
+			log.Printf("Транзакция %d удалена, убираем её из очереди классификации", p.TransactionID)
+			if err := b.storage.DeletePendingClassification(p); err != nil {
+				log.Printf("Ошибка при удалении из очереди классификации: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("Ошибка при чтении транзакции %d: %v", p.TransactionID, err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), classifyTimeout)
+		classification, err := handlers.ClassifyComment(ctx, b.storage, p.UserID, transaction.Comment, b.categoriesFor(p.UserID, transaction.Amount))
+		cancel()
+		if err != nil {
+			b.postponeReclassification(p, transaction, now, err, report)
+			if errors.Is(err, ai.ErrCircuitOpen) {
+				// AI выключен, остальные транзакции проверим в следующий раз
+				break
+			}
+			continue
+		}
+
+		if err := b.storage.ResolvePendingClassification(p, classification.Category, classification.Merchant); err != nil {
+			log.Printf("Ошибка при сохранении категории транзакции %d: %v", p.TransactionID, err)
+			continue
+		}
+		log.Printf("Транзакция %d классифицирована повторно: %s", p.TransactionID, classification.Category)
+		report(p.ChatID, fmt.Sprintf("%.2f %s → %s", transaction.Amount, transaction.Comment, classification.Category))
+	}
+
+	for _, chatID := range chatOrder {
+		b.sendText(chatID, "🔄 Категории определены:\n"+strings.Join(resolved[chatID], "\n"))
+	}
+}
+
+// postponeReclassification откладывает следующую попытку, а после reclassifyMaxAttempts
+// убирает транзакцию из очереди, оставляя категорию по умолчанию
+func (b *Bot) postponeReclassification(p *storage.PendingClassification, transaction *storage.Transaction, now time.Time, cause error, report func(int64, string)) {
+	if p.Attempts+1 >= reclassifyMaxAttempts {
+		log.Printf("Не удалось классифицировать транзакцию %d за %d попыток: %v", p.TransactionID, reclassifyMaxAttempts, cause)
+		if err := b.storage.DeletePendingClassification(p); err != nil {
+			log.Printf("Ошибка при удалении из очереди классификации: %v", err)
+			return
+		}
+		report(p.ChatID, fmt.Sprintf("%.2f %s → %s (не удалось определить)", transaction.Amount, transaction.Comment, transaction.Category))
+		return
+	}
+
+	delay := reclassifyBaseDelay << p.Attempts
+	if delay > reclassifyMaxDelay || delay <= 0 {
+		delay = reclassifyMaxDelay
+	}
+	log.Printf("Повторная классификация транзакции %d не удалась: %v. Следующая попытка через %s", p.TransactionID, cause, delay)
+	if err := b.storage.PostponePendingClassification(p, now.Add(delay)); err != nil {
+		log.Printf("Ошибка при переносе попытки классификации: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// callbackRefund - префикс данных кнопки выбора покупки: rf:<ID возврата>:<ID покупки>
+	callbackRefund = "rf"
+	// refundCategory - категория доходов для возвратов, пока не выбрана покупка
+	refundCategory = "Возвраты"
+	// refundLookback - за какой период предлагать покупки для привязки возврата
+	refundLookback = 90 * 24 * time.Hour
+	// refundChoices - сколько покупок предлагать на выбор
+	refundChoices = 5
+)
+
+// handleRefundReply сохраняет доход, присланный в ответ на сообщение о покупке, как возврат по ней.
+// Возвращает false, если сообщение не относится к расходу и доход нужно обработать как обычно.
+func (b *Bot) handleRefundReply(update tgbotapi.Update, scope storage.Scope, amount float64, comment string) bool {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	expense, err := b.storage.GetTransactionByMessage(scope, chatID, update.Message.ReplyToMessage.MessageID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ошибка при поиске транзакции по сообщению: %v", err)
+		}
+		return false
+	}
+	if expense.Amount >= 0 {
+		return false
+	}
+	log.Printf("Доход %.2f - ответ на сообщение о покупке %d, сохраняем как возврат", amount, expense.ID)
+
+	if comment == "" {
+		comment = "Возврат: " + expense.Comment
+	}
+	refund := &storage.Transaction{
+		UserID:          userID,
+		LedgerID:        scope.LedgerID,
+		Amount:          amount,
+		Comment:         comment,
+		TransactionDate: time.Now(),
+	}
+	if _, err := b.storage.SaveRefund(refund, expense.ID); err != nil {
+		log.Printf("Ошибка при сохранении возврата по покупке %d: %v", expense.ID, err)
+		if errors.Is(err, storage.ErrRefundTooLarge) {
+			b.sendText(chatID, "Сумма возвратов по этой покупке получается больше самой покупки. Проверьте сумму.")
+		} else {
+			b.sendText(chatID, "Произошла ошибка при сохранении возврата. Попробуйте еще раз.")
+		}
+		return true
+	}
+	log.Printf("Возврат сохранён. ID транзакции: %d, покупка: %d", refund.ID, expense.ID)
+	b.sendConfirmation(update, refund, refundNote(expense), nil)
+	return true
+}
+
+// refundKeyboard предлагает недавние покупки, к которым можно привязать возврат.
+// Выше в списке покупки, комментарий которых пересекается с комментарием возврата.
+func (b *Bot) refundKeyboard(refund *storage.Transaction) *tgbotapi.InlineKeyboardMarkup {
+	expenses, err := b.storage.GetRecentExpenses(storage.ScopeOf(refund), time.Now().Add(-refundLookback), 50)
+	if err != nil {
+		log.Printf("Ошибка при получении покупок для привязки возврата: %v", err)
+		return nil
+	}
+	// Возврат не может быть больше покупки
+	matching := expenses[:0]
+	for _, expense := range expenses {
+		if -expense.Amount >= refund.Amount {
+			matching = append(matching, expense)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+
+	words := strings.Fields(strings.ToLower(refund.Comment))
+	score := func(tr storage.Transaction) int {
+		comment := strings.ToLower(tr.Comment)
+		n := 0
+		for _, word := range words {
+			if utf8.RuneCountInString(word) > 3 && !isRefundComment(word) && strings.Contains(comment, word) {
+				n++
+			}
+		}
+		return n
+	}
+	// Покупки упорядочены от новых к старым, при равном совпадении сохраняем этот порядок
+	sort.SliceStable(matching, func(i, j int) bool { return score(matching[i]) > score(matching[j]) })
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, expense := range matching {
+		if i == refundChoices {
+			break
+		}
+		label := fmt.Sprintf("%s %.2f %s", expense.TransactionDate.Format("02.01"), expense.Amount, expense.Comment)
+		if utf8.RuneCountInString(label) > 40 {
+			label = string([]rune(label)[:39]) + "…"
+		}
+		data := fmt.Sprintf("%s:%d:%d", callbackRefund, refund.ID, expense.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, data)))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// handleRefundCallback привязывает сохранённый доход к выбранной покупке
+func (b *Bot) handleRefundCallback(query *tgbotapi.CallbackQuery, args string) {
+	refundText, expenseText, _ := strings.Cut(args, ":")
+	refundID, err1 := strconv.ParseUint(refundText, 10, 64)
+	expenseID, err2 := strconv.ParseUint(expenseText, 10, 64)
+	if err1 != nil || err2 != nil {
+		log.Printf("Некорректные данные кнопки возврата: %s", args)
+		b.answerCallback(query, "Эта кнопка больше не работает.")
+		return
+	}
+
+	refund, expense, err := b.storage.MarkRefund(query.From.ID, uint(refundID), uint(expenseID))
+	if err != nil {
+		log.Printf("Ошибка при привязке возврата %d к покупке %d: %v", refundID, expenseID, err)
+		switch {
+		case errors.Is(err, storage.ErrRefundTooLarge):
+			b.answerCallback(query, "Сумма возвратов больше суммы покупки.")
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			b.answerCallback(query, "Транзакция не найдена.")
+		default:
+			b.answerCallback(query, "Не удалось сохранить возврат.")
+		}
+		return
+	}
+	log.Printf("Доход %d привязан как возврат к покупке %d", refund.ID, expense.ID)
+	b.answerCallback(query, "Возврат привязан к покупке")
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, transactionConfirmation(refund)+"\n\n"+refundNote(expense))
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Ошибка при обновлении сообщения после привязки возврата: %v", err)
+	}
+}
+
+// refundNote описывает покупку, по которой получен возврат
+func refundNote(expense *storage.Transaction) string {
+	return fmt.Sprintf("Покупка: %s %.2f %s\nСумма уменьшит расходы категории «%s» и не попадёт в доходы.",
+		expense.TransactionDate.Format("02.01.2006"), expense.Amount, expense.Comment, expense.Category)
+}
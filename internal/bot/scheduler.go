@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"money-bot/internal/handlers"
+	"money-bot/internal/storage"
+)
+
+const (
+	// schedulerInterval - как часто проверять, не пора ли выполнить плановые задачи
+	schedulerInterval = time.Hour
+	// insightsHour - час первого числа месяца, начиная с которого рассылаются обзоры за прошлый месяц
+	insightsHour = 10
+	// insightsTimeout - сколько ждать AI при подготовке одного обзора
+	insightsTimeout = 2 * time.Minute
+	// loanRemindersHour - час, начиная с которого отправляются напоминания о сроках долгов
+	loanRemindersHour = 10
+)
+
+// runScheduler периодически выполняет плановые задачи бота
+func (b *Bot) runScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		if b.options.MonthlyInsights {
+			b.sendMonthlyInsights(time.Now())
+		}
+		b.sendLoanReminders(time.Now())
+		b.purgeTrash(time.Now())
+		<-ticker.C
+	}
+}
+
+// sendMonthlyInsights первого числа месяца отправляет каждому пользователю с доступом к боту обзор трат за прошлый месяц.
+// Отправленные обзоры отмечаются в базе, поэтому перезапуск бота не приводит к повторной рассылке.
+func (b *Bot) sendMonthlyInsights(now time.Time) {
+	if now.Day() != 1 || now.Hour() < insightsHour {
+		return
+	}
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	month := monthStart.Format("2006-01")
+
+	userIDs, err := b.storage.GetUserIDs()
+	if err != nil {
+		log.Printf("Ошибка при получении списка пользователей для рассылки обзоров: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		// Пользователь без доступа не получает от бота ничего, в том числе обзоров
+		if !b.hasAccess(userID) {
+			continue
+		}
+		sent, err := b.storage.IsInsightSent(userID, month)
+		if err != nil {
+			log.Printf("Ошибка при проверке отправки обзора UserID %d: %v", userID, err)
+			continue
+		}
+		if sent {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), insightsTimeout)
+		text, err := handlers.BuildMonthlyInsights(ctx, b.storage, storage.PersonalScope(userID), monthStart)
+		cancel()
+		if err != nil {
+			// Не отмечаем обзор отправленным: попробуем снова при следующей проверке
+			log.Printf("Ошибка при построении обзора за %s для UserID %d: %v", month, userID, err)
+			continue
+		}
+
+		// В личном чате его идентификатор совпадает с идентификатором пользователя.
+		// Недоставленный обзор не отмечаем: попробуем снова при следующей проверке.
+		if err := b.sendText(userID, text); err != nil {
+			continue
+		}
+		if err := b.storage.MarkInsightSent(userID, month); err != nil {
+			log.Printf("Ошибка при отметке отправки обзора UserID %d: %v", userID, err)
+		}
+		log.Printf("Обзор трат за %s отправлен пользователю %d", month, userID)
+	}
+}
+
+// sendLoanReminders напоминает пользователям с доступом к боту о долгах, срок возврата которых
+// наступает завтра или уже прошёл.
+// Ночью напоминания не отправляются, чтобы не будить пользователей.
+func (b *Bot) sendLoanReminders(now time.Time) {
+	if now.Hour() < loanRemindersHour {
+		return
+	}
+	loans, err := b.storage.GetLoansToRemind(now)
+	if err != nil {
+		log.Printf("Ошибка при получении долгов для напоминаний: %v", err)
+		return
+	}
+	for i := range loans {
+		loan := &loans[i]
+		if !b.hasAccess(loan.UserID) {
+			continue
+		}
+		// Долги личные, а в личном чате его идентификатор совпадает с идентификатором пользователя.
+		// Недоставленное напоминание не отмечаем, чтобы отправить его при следующей проверке.
+		if err := b.sendText(loan.UserID, handlers.LoanReminder(loan)); err != nil {
+			continue
+		}
+		if err := b.storage.MarkLoanReminded(loan.ID, now); err != nil {
+			log.Printf("Ошибка при отметке напоминания о долге %d: %v", loan.ID, err)
+		}
+		log.Printf("Напоминание о долге %d отправлено пользователю %d", loan.ID, loan.UserID)
+	}
+}
+
+// purgeTrash окончательно удаляет транзакции, срок хранения которых в корзине истёк
+func (b *Bot) purgeTrash(now time.Time) {
+	purged, err := b.storage.PurgeTrash(now)
+	if err != nil {
+		log.Printf("Ошибка при очистке корзины: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Из корзины окончательно удалено транзакций: %d", purged)
+	}
+}
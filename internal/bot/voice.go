@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"money-bot/internal/handlers"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// maxVoiceSize - максимальный размер голосового сообщения
+	maxVoiceSize = 20 << 20
+	// transcribeTimeout - сколько ждать результата распознавания речи
+	transcribeTimeout = 60 * time.Second
+)
+
+// handleVoice распознаёт голосовое сообщение и обрабатывает текст как обычную транзакцию
+func (b *Bot) handleVoice(update tgbotapi.Update) {
+	log.Printf("Обработка голосового сообщения от пользователя %s (ID: %d), длительность %d с", update.Message.From.UserName, update.Message.From.ID, update.Message.Voice.Duration)
+
+	// В группе голосовые сообщения - переписка участников: распознавать и пересказывать их в чат не нужно
+	if handlers.IsGroupChat(update.Message) {
+		log.Println("Голосовое сообщение в группе, пропускаем.")
+		return
+	}
+
+	if b.options.Transcriber == nil {
+		log.Println("Распознавание речи не настроено, голосовое сообщение пропущено.")
+		b.sendText(update.Message.Chat.ID, "Распознавание голосовых сообщений не настроено.")
+		return
+	}
+
+	audio, err := handlers.DownloadFile(b.api, update.Message.Voice.FileID, maxVoiceSize)
+	if err != nil {
+		log.Printf("Ошибка при скачивании голосового сообщения: %v", err)
+		b.sendText(update.Message.Chat.ID, "Не удалось скачать голосовое сообщение.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcribeTimeout)
+	defer cancel()
+	text, err := b.options.Transcriber.Transcribe(ctx, audio, "voice.ogg")
+	if err != nil {
+		log.Printf("Ошибка при распознавании речи: %v", err)
+		b.sendText(update.Message.Chat.ID, "Не удалось распознать голосовое сообщение. Попробуйте еще раз или напишите текстом.")
+		return
+	}
+	log.Printf("Распознан текст голосового сообщения: \"%s\"", text)
+	b.sendText(update.Message.Chat.ID, "🎙 "+text)
+
+	b.handleTransactionText(update, normalizeSpokenText(text))
+}
+
+// sendText отправляет простое текстовое сообщение, логирует и возвращает ошибку отправки
+func (b *Bot) sendText(chatID int64, text string) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	_, err := b.api.Send(msg)
+	if err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// usersLimit - сколько пользователей показывать в /users
+const usersLimit = 50
+
+// accessLabels - статусы доступа для списка пользователей
+var accessLabels = map[string]string{
+	storage.AccessPending:  "⏳ ждёт решения",
+	storage.AccessApproved: "✅ допущен",
+	storage.AccessBlocked:  "⛔ заблокирован",
+}
+
+// AdminOnly проверяет, что команду отправил администратор бота. Остальным бот отвечает,
+// что команда не найдена, чтобы не раскрывать административные команды.
+func AdminOnly(bot *tgbotapi.BotAPI, message *tgbotapi.Message, admins []int64) bool {
+	if !slices.Contains(admins, message.From.ID) {
+		log.Printf("Пользователь %d не администратор, команда /%s отклонена", message.From.ID, message.Command())
+		sendText(bot, message.Chat.ID, "Я не знаю такой команды.")
+		return false
+	}
+	return true
+}
+
+// HandleApprove открывает пользователю доступ к боту: /approve <ID> или ответом на его сообщение
+func HandleApprove(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, admins []int64) {
+	log.Printf("Обработка команды /approve от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !AdminOnly(bot, update.Message, admins) {
+		return
+	}
+	userID, name, ok := accessTarget(bot, update.Message)
+	if !ok {
+		return
+	}
+
+	user := &storage.BotUser{UserID: userID, Name: name, Status: storage.AccessApproved, DecidedBy: update.Message.From.ID}
+	if err := s.SetAccess(user); err != nil {
+		log.Printf("Ошибка при открытии доступа пользователю %d: %v", userID, err)
+		sendText(bot, update.Message.Chat.ID, "Не удалось открыть доступ.")
+		return
+	}
+	log.Printf("Администратор %d открыл доступ пользователю %d", update.Message.From.ID, userID)
+	sendText(bot, update.Message.Chat.ID, fmt.Sprintf("✅ Пользователю %d открыт доступ.", userID))
+	sendText(bot, userID, "✅ Вам открыт доступ к боту. Список команд: /start")
+}
+
+// HandleBlock закрывает пользователю доступ к боту: /block <ID> или ответом на его сообщение.
+// Данные пользователя остаются в базе, /approve возвращает доступ.
+func HandleBlock(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, admins []int64) {
+	log.Printf("Обработка команды /block от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !AdminOnly(bot, update.Message, admins) {
+		return
+	}
+	userID, name, ok := accessTarget(bot, update.Message)
+	if !ok {
+		return
+	}
+	if slices.Contains(admins, userID) {
+		sendText(bot, update.Message.Chat.ID, "Администратора заблокировать нельзя: сначала уберите его из ADMIN_IDS.")
+		return
+	}
+
+	user := &storage.BotUser{UserID: userID, Name: name, Status: storage.AccessBlocked, DecidedBy: update.Message.From.ID}
+	if err := s.SetAccess(user); err != nil {
+		log.Printf("Ошибка при блокировке пользователя %d: %v", userID, err)
+		sendText(bot, update.Message.Chat.ID, "Не удалось заблокировать пользователя.")
+		return
+	}
+	log.Printf("Администратор %d заблокировал пользователя %d", update.Message.From.ID, userID)
+	sendText(bot, update.Message.Chat.ID, fmt.Sprintf("⛔ Пользователь %d заблокирован. Вернуть доступ: /approve %d", userID, userID))
+}
+
+// accessTarget определяет пользователя для /approve и /block: по ID в аргументах
+// или по автору сообщения, на которое ответили
+func accessTarget(bot *tgbotapi.BotAPI, message *tgbotapi.Message) (int64, string, bool) {
+	if args := strings.TrimSpace(message.CommandArguments()); args != "" {
+		userID, err := strconv.ParseInt(args, 10, 64)
+		if err != nil || userID <= 0 {
+			sendText(bot, message.Chat.ID, fmt.Sprintf("Укажите числовой ID пользователя, например: /%s 123456789.", message.Command()))
+			return 0, "", false
+		}
+		return userID, "", true
+	}
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && !reply.From.IsBot {
+		return reply.From.ID, MemberName(reply.From), true
+	}
+	sendText(bot, message.Chat.ID, fmt.Sprintf("Укажите ID пользователя (/%s 123456789) или ответьте командой на его сообщение.", message.Command()))
+	return 0, "", false
+}
+
+// HandleUsers показывает администратору пользователей, о доступе которых есть решение
+// или которые его ждут: /users, /users pending, /users blocked
+func HandleUsers(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, admins []int64) {
+	log.Printf("Обработка команды /users от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !AdminOnly(bot, update.Message, admins) {
+		return
+	}
+	status := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if _, ok := accessLabels[status]; status != "" && !ok {
+		sendText(bot, update.Message.Chat.ID, "Фильтр списка: pending, approved или blocked. Без фильтра показываются все.")
+		return
+	}
+
+	users, err := s.GetBotUsers(status)
+	if err != nil {
+		log.Printf("Ошибка при получении списка пользователей: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при получении списка пользователей.")
+		return
+	}
+	if len(users) == 0 {
+		sendText(bot, update.Message.Chat.ID, "Список пуст.")
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("👥 Пользователи: %d\n", len(users)))
+	if len(users) > usersLimit {
+		text.WriteString(fmt.Sprintf("Показаны последние %d, уточните список фильтром: /users pending\n", usersLimit))
+		users = users[:usersLimit]
+	}
+	for _, user := range users {
+		name := user.Name
+		if name == "" {
+			name = "без имени"
+		}
+		text.WriteString(fmt.Sprintf("\n%s (ID: %d) - %s с %s", name, user.UserID, accessLabels[user.Status], user.UpdatedAt.Format("02.01.2006")))
+		if user.InviteCode != "" && user.Status == storage.AccessApproved {
+			text.WriteString(", по приглашению")
+		}
+	}
+	sendText(bot, update.Message.Chat.ID, text.String())
+}
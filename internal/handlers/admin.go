@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"money-bot/ai"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// CallbackAdmin - префикс данных кнопок администратора: ad:b - отправить рассылку,
+	// ad:p:<ID> - удалить данные пользователя, ad:y:<ID> - подтвердить удаление, ad:n - отмена
+	CallbackAdmin = "ad"
+	// adminStatsDays - за сколько последних дней показывать активность в /admin stats
+	adminStatsDays = 7
+	// broadcastInterval - пауза между сообщениями рассылки: Telegram разрешает ботам
+	// около 30 сообщений в секунду, рассылка идёт медленнее, чтобы не мешать остальной работе
+	broadcastInterval = 50 * time.Millisecond
+)
+
+// adminUsage - подсказка по командам администратора
+const adminUsage = "Команды администратора:\n" +
+	"/admin stats - статистика бота\n" +
+	"/admin broadcast текст - сообщение всем пользователям\n" +
+	"/admin user ID - сведения о пользователе и удаление его данных"
+
+// broadcasting не даёт запустить вторую рассылку, пока идёт первая
+var broadcasting atomic.Bool
+
+// HandleAdmin обрабатывает команды администратора бота: /admin stats, /admin broadcast, /admin user.
+// hasAccess решает, у кого из пользователей есть доступ к боту: остальным рассылка не отправляется.
+func HandleAdmin(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, admins []int64, hasAccess func(userID int64) bool) {
+	log.Printf("Обработка команды /admin от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !AdminOnly(bot, update.Message, admins) {
+		return
+	}
+	action, rest := adminArgs(update.Message)
+	switch action {
+	case "stats":
+		adminStats(bot, update.Message, s)
+	case "broadcast":
+		confirmBroadcast(bot, update.Message, s, rest, hasAccess)
+	case "user":
+		adminUser(bot, update.Message, s, rest)
+	default:
+		sendText(bot, update.Message.Chat.ID, adminUsage)
+	}
+}
+
+// adminArgs делит аргументы /admin на действие и остальной текст, сохраняя в нём переносы строк
+func adminArgs(message *tgbotapi.Message) (string, string) {
+	args := strings.TrimSpace(message.CommandArguments())
+	end := strings.IndexFunc(args, unicode.IsSpace)
+	if end < 0 {
+		return strings.ToLower(args), ""
+	}
+	return strings.ToLower(args[:end]), strings.TrimSpace(args[end:])
+}
+
+// adminStats показывает пользователей, активность по дням, обращения к AI и размер базы
+func adminStats(bot *tgbotapi.BotAPI, message *tgbotapi.Message, s *storage.Storage) {
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-adminStatsDays+1, 0, 0, 0, 0, now.Location())
+	stats, err := s.GetAdminStats(since)
+	if err != nil {
+		log.Printf("Ошибка при сборе статистики бота: %v", err)
+		sendText(bot, message.Chat.ID, "Ошибка при сборе статистики.")
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("📊 Статистика бота\n\n")
+	text.WriteString(fmt.Sprintf("Пользователи: %d, активны за %d дней: %d\n", stats.Users, adminStatsDays, stats.ActiveUsers))
+	text.WriteString(fmt.Sprintf("Доступ: ждут решения %d, допущены %d, заблокированы %d\n",
+		stats.Access[storage.AccessPending], stats.Access[storage.AccessApproved], stats.Access[storage.AccessBlocked]))
+	text.WriteString(fmt.Sprintf("Общие книги: %d\n", stats.Ledgers))
+	text.WriteString(fmt.Sprintf("Транзакции: %d, в корзине: %d\n", stats.Transactions, stats.Trash))
+
+	text.WriteString("\nНовые транзакции по дням:\n")
+	perDay := make(map[string]int64, len(stats.PerDay))
+	for _, day := range stats.PerDay {
+		perDay[day.Day] = day.Count
+	}
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		text.WriteString(fmt.Sprintf("%s - %d\n", day.Format("02.01"), perDay[day.Format("2006-01-02")]))
+	}
+
+	calls := ai.Stats()
+	text.WriteString(fmt.Sprintf("\nAI с %s:\n", calls.Since.Format("02.01.2006 15:04")))
+	text.WriteString(fmt.Sprintf("обращений %d, ошибок %d", calls.Calls, calls.Failures))
+	if calls.Calls > 0 {
+		text.WriteString(fmt.Sprintf(" (%.0f%%)", float64(calls.Failures)/float64(calls.Calls)*100))
+	}
+	text.WriteString(fmt.Sprintf(", пропущено после серии ошибок %d\n", calls.Skipped))
+	if calls.Calls > 0 {
+		text.WriteString(fmt.Sprintf("время ответа: среднее %s, максимальное %s\n",
+			calls.AverageLatency().Round(time.Millisecond), calls.MaxLatency.Round(time.Millisecond)))
+	}
+
+	text.WriteString(fmt.Sprintf("\nРазмер базы данных: %s", formatBytes(stats.DBSize)))
+	sendText(bot, message.Chat.ID, text.String())
+}
+
+// formatBytes записывает размер в байтах в удобных единицах: 1.5 МБ
+func formatBytes(size int64) string {
+	units := []string{"Б", "КБ", "МБ", "ГБ"}
+	value, unit := float64(size), 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[0])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// confirmBroadcast показывает текст рассылки и число получателей и ждёт подтверждения.
+// Сообщение отправляется ответом на команду: по ней кнопка восстанавливает текст рассылки.
+func confirmBroadcast(bot *tgbotapi.BotAPI, message *tgbotapi.Message, s *storage.Storage, text string, hasAccess func(userID int64) bool) {
+	if text == "" {
+		sendText(bot, message.Chat.ID, "Укажите текст рассылки: /admin broadcast Бот обновился, смотрите /start")
+		return
+	}
+	recipients, err := broadcastRecipients(s, hasAccess)
+	if err != nil {
+		log.Printf("Ошибка при получении получателей рассылки: %v", err)
+		sendText(bot, message.Chat.ID, "Ошибка при получении списка получателей.")
+		return
+	}
+	if len(recipients) == 0 {
+		sendText(bot, message.Chat.ID, "Рассылать некому: пользователей пока нет.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("📣 Разослать это сообщение %d пользователям?\n\n%s", len(recipients), text))
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📣 Отправить", CallbackAdmin+":b"),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", CallbackAdmin+":n"),
+	))
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке подтверждения рассылки: %v", err)
+	}
+}
+
+// broadcast рассылает сообщение получателям с паузой между сообщениями и сообщает администратору итог.
+// Если Telegram просит подождать, сообщение отправляется повторно после паузы.
+func broadcast(bot *tgbotapi.BotAPI, chatID int64, text string, recipients []int64) {
+	defer broadcasting.Store(false)
+	var delivered, failed int
+	for _, userID := range recipients {
+		time.Sleep(broadcastInterval)
+		_, err := bot.Send(tgbotapi.NewMessage(userID, text))
+		var tgErr *tgbotapi.Error
+		if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+			log.Printf("Telegram ограничил рассылку, пауза %d с", tgErr.RetryAfter)
+			time.Sleep(time.Duration(tgErr.RetryAfter) * time.Second)
+			_, err = bot.Send(tgbotapi.NewMessage(userID, text))
+		}
+		if err != nil {
+			// Чаще всего пользователь остановил бота
+			log.Printf("Не удалось отправить рассылку пользователю %d: %v", userID, err)
+			failed++
+			continue
+		}
+		delivered++
+	}
+	log.Printf("Рассылка завершена: доставлено %d, ошибок %d", delivered, failed)
+	sendText(bot, chatID, fmt.Sprintf("📣 Рассылка завершена: доставлено %d из %d, не доставлено %d.", delivered, len(recipients), failed))
+}
+
+// adminUser показывает сведения о пользователе и кнопку удаления его данных
+func adminUser(bot *tgbotapi.BotAPI, message *tgbotapi.Message, s *storage.Storage, args string) {
+	userID, err := strconv.ParseInt(args, 10, 64)
+	if err != nil || userID <= 0 {
+		sendText(bot, message.Chat.ID, "Укажите числовой ID пользователя: /admin user 123456789")
+		return
+	}
+	summary, err := s.GetUserSummary(userID)
+	if err != nil {
+		log.Printf("Ошибка при получении сведений о пользователе %d: %v", userID, err)
+		sendText(bot, message.Chat.ID, "Ошибка при получении сведений о пользователе.")
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("👤 Пользователь %d\n\n", userID))
+	if summary.Access != nil {
+		if summary.Access.Name != "" {
+			text.WriteString(fmt.Sprintf("Имя: %s\n", summary.Access.Name))
+		}
+		text.WriteString(fmt.Sprintf("Доступ: %s с %s\n", accessLabels[summary.Access.Status], summary.Access.UpdatedAt.Format("02.01.2006")))
+	} else {
+		text.WriteString("Доступ: решения нет\n")
+	}
+	text.WriteString(fmt.Sprintf("Личные транзакции: %d, в корзине: %d\n", summary.Transactions, summary.Trash))
+	text.WriteString(fmt.Sprintf("Транзакции в общих книгах: %d, книг: %d\n", summary.LedgerTransactions, summary.Ledgers))
+	text.WriteString(fmt.Sprintf("Категории доходов: %d, цели: %d, долги: %d\n", summary.Categories, summary.Goals, summary.Loans))
+	if summary.FirstTransaction != nil {
+		text.WriteString(fmt.Sprintf("Первая транзакция: %s, последняя: %s\n",
+			summary.FirstTransaction.Format("02.01.2006"), summary.LastTransaction.Format("02.01.2006")))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, strings.TrimSpace(text.String()))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить личные данные", fmt.Sprintf("%s:p:%d", CallbackAdmin, userID)),
+	))
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке сведений о пользователе: %v", err)
+	}
+}
+
+// HandleAdminCallback обрабатывает кнопки администратора: рассылку и удаление данных пользователя.
+// Права администратора проверяются заново при каждом нажатии.
+func HandleAdminCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, admins []int64, hasAccess func(userID int64) bool, args string) {
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	if !slices.Contains(admins, query.From.ID) {
+		answerCallback(bot, query, "Эта кнопка доступна только администратору.")
+		return
+	}
+
+	action, idText, _ := strings.Cut(args, ":")
+	switch action {
+	case "n":
+		answerCallback(bot, query, "Отменено")
+		editText(bot, chatID, messageID, "Отменено.", nil)
+	case "b":
+		command := query.Message.ReplyToMessage
+		if command == nil || !command.IsCommand() {
+			answerCallback(bot, query, "Эта кнопка больше не работает.")
+			return
+		}
+		if _, text := adminArgs(command); text != "" {
+			startBroadcast(bot, query, s, text, hasAccess)
+			return
+		}
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+	case "p", "y":
+		userID, err := strconv.ParseInt(idText, 10, 64)
+		if err != nil {
+			log.Printf("Некорректные данные кнопки администратора: %s", args)
+			answerCallback(bot, query, "Эта кнопка больше не работает.")
+			return
+		}
+		if action == "p" {
+			answerCallback(bot, query, "")
+			markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить безвозвратно", fmt.Sprintf("%s:y:%d", CallbackAdmin, userID)),
+				tgbotapi.NewInlineKeyboardButtonData("Отмена", CallbackAdmin+":n"),
+			))
+			editText(bot, chatID, messageID, fmt.Sprintf("Удалить личные данные пользователя %d?\n\n"+
+				"Транзакции, корзина, чеки, категории, цели и долги удалятся без возможности восстановления. "+
+				"Из журнала изменений сотрутся суммы и комментарии, останутся только действия и их время. "+
+				"Транзакции в общих книгах и решение о доступе останутся.", userID), &markup)
+			return
+		}
+		purged, err := s.As(query.From.ID).PurgeUser(userID)
+		if err != nil {
+			log.Printf("Ошибка при удалении данных пользователя %d: %v", userID, err)
+			answerCallback(bot, query, "Не удалось удалить данные.")
+			return
+		}
+		log.Printf("Администратор %d удалил данные пользователя %d, транзакций: %d", query.From.ID, userID, purged)
+		answerCallback(bot, query, "Данные удалены")
+		editText(bot, chatID, messageID, fmt.Sprintf("🗑 Личные данные пользователя %d удалены, транзакций: %d.", userID, purged), nil)
+	default:
+		log.Printf("Некорректные данные кнопки администратора: %s", args)
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+	}
+}
+
+// broadcastRecipients возвращает получателей рассылки, у которых сейчас есть доступ к боту.
+// Хранилище уже исключает заблокированных, а в закрытых режимах доступа отсеиваются и те,
+// кто писал боту, но так и не получил одобрения.
+func broadcastRecipients(s *storage.Storage, hasAccess func(userID int64) bool) ([]int64, error) {
+	recipients, err := s.GetBroadcastRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(recipients, func(userID int64) bool { return !hasAccess(userID) }), nil
+}
+
+// startBroadcast запускает рассылку в фоне, чтобы она не задерживала другие сообщения этого чата
+func startBroadcast(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, text string, hasAccess func(userID int64) bool) {
+	if !broadcasting.CompareAndSwap(false, true) {
+		answerCallback(bot, query, "Рассылка уже идёт, дождитесь её окончания.")
+		return
+	}
+	recipients, err := broadcastRecipients(s, hasAccess)
+	if err != nil {
+		broadcasting.Store(false)
+		log.Printf("Ошибка при получении получателей рассылки: %v", err)
+		answerCallback(bot, query, "Ошибка при получении списка получателей.")
+		return
+	}
+	log.Printf("Администратор %d начал рассылку %d пользователям", query.From.ID, len(recipients))
+	answerCallback(bot, query, "Рассылка начата")
+	editText(bot, query.Message.Chat.ID, query.Message.MessageID,
+		fmt.Sprintf("📣 Рассылка %d пользователям начата, итог придёт отдельным сообщением.\n\n%s", len(recipients), text), nil)
+	go broadcast(bot, query.Message.Chat.ID, text, recipients)
+}
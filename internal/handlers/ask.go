@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"money-bot/ai"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleAsk отвечает на вопрос о тратах на естественном языке.
+// Языковая модель переводит вопрос в storage.SpendingQuery, который проверяется
+// и выполняется хранилищем; сама модель к базе доступа не имеет.
+func HandleAsk(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string, question string) {
+	log.Printf("Обработка вопроса от пользователя %s (ID: %d): \"%s\"", update.Message.From.UserName, update.Message.From.ID, question)
+
+	question = strings.TrimSpace(question)
+	if question == "" {
+		sendText(bot, update.Message.Chat.ID, "Задайте вопрос после команды, например: /ask сколько я потратил на такси в марте?")
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiTimeout)
+	defer cancel()
+	raw, err := ai.TranslateQuestion(ctx, question, categories, time.Now())
+	if err != nil {
+		log.Printf("Ошибка при переводе вопроса в запрос: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Не получилось понять вопрос. Попробуйте сформулировать иначе.")
+		return
+	}
+
+	var query storage.SpendingQuery
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		log.Printf("Модель вернула запрос неверного формата: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Не получилось понять вопрос. Попробуйте сформулировать иначе.")
+		return
+	}
+	if err := query.Validate(categories); err != nil {
+		log.Printf("Запрос от модели не прошёл проверку: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Не получилось понять вопрос. Попробуйте сформулировать иначе.")
+		return
+	}
+	log.Printf("Выполнение запроса: %+v", query)
+
+	answer, err := s.RunSpendingQuery(scope, query)
+	if err != nil {
+		log.Printf("Ошибка при выполнении запроса: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при получении данных.")
+		return
+	}
+
+	sendText(bot, update.Message.Chat.ID, formatAnswer(answer))
+}
+
+// formatAnswer формирует текстовый ответ на вопрос
+func formatAnswer(answer *storage.SpendingAnswer) string {
+	var text strings.Builder
+	text.WriteString("🔎 " + describeQuery(answer) + "\n\n")
+
+	if answer.Count == 0 {
+		text.WriteString("Подходящих транзакций не найдено.")
+		return text.String()
+	}
+
+	// По всем транзакциям модуль суммы ничего не значит: доходы и расходы показываем
+	// отдельно, а итог - со знаком, как разницу между ними
+	all := answer.Query.Type == storage.TypeAll
+	switch {
+	case all && answer.Query.Metric == storage.MetricSum:
+		text.WriteString(fmt.Sprintf("Доходы: %.2f руб.\nРасходы: %.2f руб.\nИтого (доходы минус расходы): %+.2f руб. (%d транзакций)",
+			answer.Income, math.Abs(answer.Expense), answer.Total, answer.Count))
+	case all && answer.Query.Metric == storage.MetricCount:
+		text.WriteString(fmt.Sprintf("Количество транзакций: %d, доходы %.2f руб., расходы %.2f руб.", answer.Count, answer.Income, math.Abs(answer.Expense)))
+	case all && answer.Query.Metric == storage.MetricAverage:
+		text.WriteString(fmt.Sprintf("Средняя сумма с учётом знака: %+.2f руб. (по %d транзакциям)", answer.Average, answer.Count))
+	case answer.Query.Metric == storage.MetricSum:
+		text.WriteString(fmt.Sprintf("Итого: %.2f руб. (%d транзакций)", math.Abs(answer.Total), answer.Count))
+	case answer.Query.Metric == storage.MetricCount:
+		text.WriteString(fmt.Sprintf("Количество транзакций: %d на сумму %.2f руб.", answer.Count, math.Abs(answer.Total)))
+	case answer.Query.Metric == storage.MetricAverage:
+		text.WriteString(fmt.Sprintf("Средняя сумма: %.2f руб. (по %d транзакциям)", math.Abs(answer.Average), answer.Count))
+	default:
+		for i, tr := range answer.Transactions {
+			text.WriteString(fmt.Sprintf("%d. %s  %.2f  %s (%s)\n", i+1, tr.TransactionDate.Format("02.01.2006"), tr.Amount, tr.Comment, tr.Category))
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// describeQuery описывает, что именно было посчитано, чтобы пользователь мог проверить понимание вопроса
+func describeQuery(answer *storage.SpendingAnswer) string {
+	parts := []string{}
+	switch answer.Query.Type {
+	case storage.TypeExpense:
+		parts = append(parts, "расходы")
+	case storage.TypeIncome:
+		parts = append(parts, "доходы")
+	default:
+		parts = append(parts, "все транзакции")
+	}
+	if answer.Query.Category != "" {
+		parts = append(parts, "в категории «"+answer.Query.Category+"»")
+	}
+	if answer.Query.Search != "" {
+		parts = append(parts, "с «"+answer.Query.Search+"» в комментарии")
+	}
+	if !answer.From.IsZero() {
+		parts = append(parts, "с "+answer.From.Format("02.01.2006"))
+	}
+	if !answer.To.IsZero() {
+		parts = append(parts, "по "+answer.To.Format("02.01.2006"))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxBackupSize - максимальный размер принимаемого архива
+const maxBackupSize = 20 << 20
+
+// HandleBackup отправляет пользователю JSON-архив всех его данных
+func HandleBackup(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /backup от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	// Архив содержит личные данные, отправлять его в группу нельзя
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	backup, err := s.CreateBackup(update.Message.From.ID)
+	if err != nil {
+		log.Printf("Ошибка при создании архива для UserID %d: %v", update.Message.From.ID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при создании резервной копии.")
+		return
+	}
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		log.Printf("Ошибка при маршалинге архива в JSON: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при создании резервной копии.")
+		return
+	}
+
+	file := tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("money-bot_backup_%s.json", time.Now().Format("2006-01-02")),
+		Bytes: data,
+	}
+	doc := tgbotapi.NewDocument(update.Message.Chat.ID, file)
+	doc.Caption = fmt.Sprintf("Резервная копия: %d транзакций.\nЧтобы восстановить данные, отправьте этот файл с подписью /restore (слияние) или /restore replace (замена).", len(backup.Transactions))
+	log.Printf("Отправка архива пользователю %d: %d транзакций.", update.Message.From.ID, len(backup.Transactions))
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Ошибка при отправке архива: %v", err)
+	}
+}
+
+// HandleRestore восстанавливает данные из JSON-архива, присланного документом.
+// Режим задаётся аргументом: merge (по умолчанию) или replace.
+func HandleRestore(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, document *tgbotapi.Document, args string) {
+	log.Printf("Обработка восстановления из архива от пользователя %s (ID: %d), аргументы: '%s'", update.Message.From.UserName, update.Message.From.ID, args)
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	if document == nil {
+		sendText(bot, update.Message.Chat.ID, "Отправьте файл резервной копии с подписью /restore или ответьте командой /restore на сообщение с файлом.")
+		return
+	}
+
+	var replace bool
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "", "merge", "слияние":
+	case "replace", "замена":
+		replace = true
+	default:
+		sendText(bot, update.Message.Chat.ID, "Неизвестный режим восстановления. Используйте /restore merge или /restore replace.")
+		return
+	}
+
+	data, err := DownloadFile(bot, document.FileID, maxBackupSize)
+	if err != nil {
+		log.Printf("Ошибка при скачивании архива: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Не удалось скачать файл резервной копии.")
+		return
+	}
+
+	var backup storage.Backup
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&backup); err != nil {
+		log.Printf("Ошибка при разборе архива: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Файл не похож на резервную копию: не удалось разобрать JSON.")
+		return
+	}
+	if err := storage.ValidateBackup(&backup); err != nil {
+		log.Printf("Архив не прошёл проверку: %v", err)
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("Резервная копия не прошла проверку: %v.", err))
+		return
+	}
+
+	result, err := s.RestoreBackup(update.Message.From.ID, &backup, replace)
+	if err != nil {
+		sendText(bot, update.Message.Chat.ID, "Ошибка при восстановлении данных. Изменения не применены.")
+		return
+	}
+
+	responseText := fmt.Sprintf("✅ Данные восстановлены.\nДобавлено транзакций: %d", result.Restored)
+	if replace {
+		responseText += fmt.Sprintf("\nУдалено прежних транзакций: %d", result.Deleted)
+	} else {
+		responseText += fmt.Sprintf("\nПропущено дубликатов: %d", result.Skipped)
+	}
+	if result.Loans > 0 {
+		responseText += fmt.Sprintf("\nДобавлено долгов: %d", result.Loans)
+	}
+	if result.Goals > 0 {
+		responseText += fmt.Sprintf("\nДобавлено целей: %d", result.Goals)
+	}
+	log.Printf("Восстановление для UserID %d завершено: %+v", update.Message.From.ID, result)
+	sendText(bot, update.Message.Chat.ID, responseText)
+}
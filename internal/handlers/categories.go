@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// IncomeFallbackCategory - категория дохода по умолчанию, её нельзя удалить
+const IncomeFallbackCategory = "Доход"
+
+// maxCategoryName - максимальная длина названия категории: оно передаётся в данных
+// inline-кнопок, а они ограничены 64 байтами
+const maxCategoryName = 24
+
+// UserIncomeCategories возвращает категории доходов пользователя или список по умолчанию,
+// если пользователь ещё не менял категории
+func UserIncomeCategories(s *storage.Storage, userID int64, defaults []string) []string {
+	categories, err := s.GetCategories(userID, storage.CategoryIncome)
+	if err != nil {
+		log.Printf("Ошибка при получении категорий доходов UserID %d, используем список по умолчанию: %v", userID, err)
+		return defaults
+	}
+	if len(categories) == 0 {
+		return defaults
+	}
+	return categories
+}
+
+// HandleIncomeCategories показывает и изменяет категории доходов пользователя:
+//
+//	/sources                 - список категорий
+//	/sources add Фриланс     - добавить категорию
+//	/sources remove Фриланс  - удалить категорию
+func HandleIncomeCategories(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, defaults []string) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	log.Printf("Обработка команды /sources от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, userID, args)
+
+	action, name, _ := strings.Cut(args, " ")
+	name = strings.Trim(strings.TrimSpace(name), "\"")
+	switch strings.ToLower(action) {
+	case "":
+		categories := UserIncomeCategories(s, userID, defaults)
+		sendText(bot, chatID, "💰 Категории доходов:\n• "+strings.Join(categories, "\n• ")+
+			"\n\nДобавить: /sources add Название\nУдалить: /sources remove Название")
+		return
+	case "add", "добавить":
+		if name == "" {
+			sendText(bot, chatID, "Укажите название категории: /sources add Фриланс")
+			return
+		}
+		if utf8.RuneCountInString(name) > maxCategoryName {
+			sendText(bot, chatID, fmt.Sprintf("Название категории должно быть не длиннее %d символов.", maxCategoryName))
+			return
+		}
+		if !seedIncomeCategories(bot, chatID, s, userID, defaults) {
+			return
+		}
+		if err := s.AddCategory(userID, storage.CategoryIncome, name); err != nil {
+			if errors.Is(err, storage.ErrCategoryExists) {
+				sendText(bot, chatID, fmt.Sprintf("Категория «%s» уже есть.", name))
+				return
+			}
+			log.Printf("Ошибка при добавлении категории дохода: %v", err)
+			sendText(bot, chatID, "Ошибка при добавлении категории.")
+			return
+		}
+		log.Printf("UserID %d добавил категорию дохода '%s'", userID, name)
+		sendText(bot, chatID, fmt.Sprintf("✅ Категория доходов «%s» добавлена.", name))
+	case "remove", "delete", "удалить":
+		if name == "" {
+			sendText(bot, chatID, "Укажите название категории: /sources remove Фриланс")
+			return
+		}
+		if name == IncomeFallbackCategory {
+			sendText(bot, chatID, fmt.Sprintf("Категорию «%s» удалить нельзя: она используется, когда источник дохода не удалось определить.", IncomeFallbackCategory))
+			return
+		}
+		if !seedIncomeCategories(bot, chatID, s, userID, defaults) {
+			return
+		}
+		deleted, err := s.DeleteCategory(userID, storage.CategoryIncome, name)
+		if err != nil {
+			log.Printf("Ошибка при удалении категории дохода: %v", err)
+			sendText(bot, chatID, "Ошибка при удалении категории.")
+			return
+		}
+		if !deleted {
+			sendText(bot, chatID, fmt.Sprintf("Категории «%s» нет.", name))
+			return
+		}
+		log.Printf("UserID %d удалил категорию дохода '%s'", userID, name)
+		sendText(bot, chatID, fmt.Sprintf("🗑 Категория доходов «%s» удалена. Уже сохранённые доходы сохранили свою категорию.", name))
+	default:
+		sendText(bot, chatID, "Используйте /sources, /sources add Название или /sources remove Название.")
+	}
+}
+
+// seedIncomeCategories перед первым изменением копирует пользователю список категорий по умолчанию,
+// чтобы изменение применялось к полному списку, а не создавало его с нуля
+func seedIncomeCategories(bot *tgbotapi.BotAPI, chatID int64, s *storage.Storage, userID int64, defaults []string) bool {
+	categories, err := s.GetCategories(userID, storage.CategoryIncome)
+	if err == nil && len(categories) == 0 {
+		err = s.AddCategories(userID, storage.CategoryIncome, defaults)
+	}
+	if err != nil {
+		log.Printf("Ошибка при подготовке категорий доходов UserID %d: %v", userID, err)
+		sendText(bot, chatID, "Ошибка при изменении категорий.")
+		return false
+	}
+	return true
+}
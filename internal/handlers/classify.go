@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"money-bot/ai"
+	"money-bot/internal/storage"
+)
+
+// LowConfidence - уверенность классификатора, ниже которой категория не запоминается,
+// а пользователю предлагается выбрать её самому
+const LowConfidence = 0.6
+
+// ClassifyComment определяет категорию расхода по комментарию. Сначала категория ищется
+// в кеше ранее классифицированных комментариев пользователя, и только при промахе
+// вызывается AI. Уверенные ответы AI запоминаются в кеше.
+func ClassifyComment(ctx context.Context, s *storage.Storage, userID int64, comment string, categories []string) (*ai.Classification, error) {
+	cached, err := s.GetCachedClassification(userID, comment)
+	if err != nil {
+		// Кеш - только оптимизация, при ошибке обращаемся к AI
+		log.Printf("Ошибка при чтении кеша категорий: %v", err)
+	}
+	if cached != nil && containsCategory(categories, cached.Category) {
+		log.Printf("Категория для \"%s\" найдена в кеше: %s", comment, cached.Category)
+		return &ai.Classification{
+			Category:   cached.Category,
+			Confidence: cached.Confidence,
+			Merchant:   cached.Merchant,
+			Candidates: []string{cached.Category},
+		}, nil
+	}
+
+	classification, err := ai.ClassifyTransaction(ctx, comment, categories)
+	if err != nil {
+		return nil, err
+	}
+	if classification.Confidence >= LowConfidence {
+		if err := s.SaveCachedClassification(userID, comment, classification.Category, classification.Merchant, classification.Confidence); err != nil {
+			log.Printf("Ошибка при сохранении категории в кеш: %v", err)
+		}
+	}
+	return classification, nil
+}
+
+// containsCategory сообщает, есть ли категория в списке
+func containsCategory(categories []string, category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
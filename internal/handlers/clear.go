@@ -14,8 +14,12 @@ import (
 // HandleClearLast обрабатывает команду /clear_last
 func HandleClearLast(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
 	log.Printf("Обработка команды /clear_last от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
 
-	deletedTransaction, err := s.DeleteLastTransaction(update.Message.From.ID)
+	deletedTransaction, err := s.DeleteLastTransaction(scope, update.Message.From.ID)
 	if err != nil {
 		var responseText string
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -31,7 +35,7 @@ func HandleClearLast(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.St
 	}
 
 	responseText := fmt.Sprintf(
-		"✅ Последняя транзакция удалена:\n\nСумма: %.2f\nКомментарий: %s\nКатегория: %s",
+		"✅ Последняя транзакция удалена:\n\nСумма: %.2f\nКомментарий: %s\nКатегория: %s\n\nВернуть: /undo",
 		deletedTransaction.Amount,
 		deletedTransaction.Comment,
 		deletedTransaction.Category,
@@ -42,24 +46,13 @@ func HandleClearLast(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.St
 	log.Printf("Последняя транзакция для пользователя %d успешно удалена.", update.Message.From.ID)
 }
 
-// HandleClearToday обрабатывает команду /clear_today
+// HandleClearToday обрабатывает команду /clear_today: показывает транзакции автора за сегодня
+// и удаляет их после подтверждения кнопкой
 func HandleClearToday(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
 	log.Printf("Обработка команды /clear_today от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
-
-	count, err := s.DeleteTransactionsForToday(update.Message.From.ID)
-	if err != nil {
-		log.Printf("Ошибка при удалении транзакций за сегодня для UserID %d: %v", update.Message.From.ID, err)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Произошла ошибка при удалении транзакций.")
-		bot.Send(msg)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
 		return
 	}
-
-	responseText := "За сегодня не найдено транзакций для удаления."
-	if count > 0 {
-		responseText = fmt.Sprintf("✅ Удалено %d транзакций за сегодня.", count)
-	}
-
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, responseText)
-	bot.Send(msg)
-	log.Printf("Для пользователя %d удалено %d транзакций за сегодня.", update.Message.From.ID, count)
+	confirmDeletion(bot, update.Message, s, scope, nil)
 }
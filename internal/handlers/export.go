@@ -12,10 +12,26 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// HandleExport создает и отправляет CSV-файл с транзакциями
-func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+// HandleExport создает и отправляет CSV-файл с транзакциями.
+// Аргументы команды разбираются общей грамматикой фильтров: /export month category=Продукты expenses
+func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string) {
 	log.Printf("Начало обработки экспорта для пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
-	transactions, err := s.GetAllTransactions(update.Message.From.ID)
+	filter, err := ParseFilter(update.Message.CommandArguments(), categories)
+	if err != nil {
+		log.Printf("Ошибка разбора фильтра экспорта '%s': %v", update.Message.CommandArguments(), err)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Не удалось разобрать фильтр: %v.\nПример: /export month category=Продукты expenses", err))
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("Ошибка при отправке сообщения об ошибке фильтра: %v", err)
+		}
+		return
+	}
+
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	transactions, err := s.GetTransactionsByFilter(scope, filter.TransactionFilter)
 	if err != nil {
 		log.Printf("Ошибка при получении всех транзакций из БД для экспорта: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при получении данных для экспорта.")
@@ -27,7 +43,11 @@ func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 
 	if len(transactions) == 0 {
 		log.Printf("Нет транзакций для экспорта для UserID: %d", update.Message.From.ID)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Нет транзакций для экспорта.")
+		text := "Нет транзакций для экспорта."
+		if !filter.IsEmpty() {
+			text = "Нет транзакций, подходящих под фильтр."
+		}
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
 		if _, err := bot.Send(msg); err != nil {
 			log.Printf("Ошибка при отправке сообщения об отсутствии транзакций для экспорта: %v", err)
 		}
@@ -40,7 +60,7 @@ func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 	w := csv.NewWriter(&b)
 
 	// Записываем заголовок
-	header := []string{"ID", "Дата", "Сумма", "Комментарий", "Категория"}
+	header := []string{"ID", "Дата", "Сумма", "Комментарий", "Категория", "Возврат за", "Теги"}
 	if err := w.Write(header); err != nil {
 		log.Printf("Ошибка при записи заголовка в CSV: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при создании CSV-файла.")
@@ -58,6 +78,11 @@ func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 			fmt.Sprintf("%.2f", tr.Amount),
 			tr.Comment,
 			tr.Category,
+			"",
+			FormatTags(&tr),
+		}
+		if tr.RefundOfID != nil {
+			record[5] = fmt.Sprintf("%d", *tr.RefundOfID)
 		}
 		if err := w.Write(record); err != nil {
 			log.Printf("Ошибка при записи строки %d в CSV: %v", tr.ID, err)
@@ -81,7 +106,11 @@ func HandleExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 	log.Println("CSV-данные успешно сгенерированы.")
 
 	// Создаем и отправляем файл
+	// Имя файла отражает фильтр, чтобы выгрузки не путались между собой
 	fileName := fmt.Sprintf("transactions_%s.csv", time.Now().Format("2006-01-02"))
+	if !filter.IsEmpty() {
+		fileName = fmt.Sprintf("transactions_%s_%s.csv", filter.FileSuffix(), time.Now().Format("2006-01-02"))
+	}
 	log.Printf("Подготовка файла для отправки: %s", fileName)
 	file := tgbotapi.FileBytes{
 		Name:  fileName,
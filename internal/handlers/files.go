@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fileClient используется для скачивания файлов, присланных пользователями
+var fileClient = &http.Client{Timeout: time.Second * 60}
+
+// DownloadFile скачивает файл из Telegram по его FileID.
+// Файлы больше maxSize байт не скачиваются целиком и возвращают ошибку.
+func DownloadFile(bot *tgbotapi.BotAPI, fileID string, maxSize int64) ([]byte, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить ссылку на файл: %w", err)
+	}
+
+	resp, err := fileClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при скачивании файла: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер Telegram вернул статус %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении файла: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("файл больше %d байт", maxSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"money-bot/internal/storage"
+)
+
+// Filter - разобранные аргументы команд вида "/export month category=Продукты expenses".
+// Грамматика общая для отчётов и экспорта:
+//   - период: today/week/month/year (или сегодня/неделя/месяц/год);
+//   - диапазон дат: 2026-01-01 2026-06-30 (одна дата - один день);
+//   - категория: category=Продукты или category="Еда вне дома";
+//   - тип: expenses/incomes (или расходы/доходы);
+//   - теги: #командировка (можно несколько, нужны все сразу).
+type Filter struct {
+	storage.TransactionFilter
+	Period string   // Ключевое слово периода, если оно было указано
+	labels []string // Части фильтра в порядке разбора, для заголовков и имён файлов
+}
+
+// filterDateLayout - формат дат в аргументах команд
+const filterDateLayout = "2006-01-02"
+
+// ParseFilter разбирает аргументы команды в фильтр транзакций. Категория приводится
+// к написанию из списка categories: в базе категории сравниваются с учётом регистра.
+func ParseFilter(args string, categories []string) (Filter, error) {
+	var f Filter
+	tokens, err := splitArgs(args)
+	if err != nil {
+		return f, err
+	}
+
+	var dates []time.Time
+	for _, token := range tokens {
+		ok, err := f.parseToken(token, categories, &dates)
+		if err != nil {
+			return f, err
+		}
+		if !ok {
+			return f, fmt.Errorf("не удалось разобрать аргумент %q", token)
+		}
+	}
+
+	if len(dates) > 0 {
+		if err := f.setDates(dates); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// parseToken разбирает один аргумент фильтра; даты копятся в dates, пока не разобраны все аргументы.
+// Возвращает false, если аргумент не относится к грамматике фильтров.
+func (f *Filter) parseToken(token string, categories []string, dates *[]time.Time) (bool, error) {
+	lower := strings.ToLower(token)
+	switch {
+	case lower == "today" || lower == "сегодня":
+		return true, f.setPeriod("today", GetStartAndEndOfDay)
+	case lower == "week" || lower == "неделя":
+		return true, f.setPeriod("week", GetStartAndEndOfWeek)
+	case lower == "month" || lower == "месяц":
+		return true, f.setPeriod("month", GetStartAndEndOfMonth)
+	case lower == "year" || lower == "год":
+		return true, f.setPeriod("year", GetStartAndEndOfYear)
+	case lower == "expenses" || lower == "расходы":
+		return true, f.setType(storage.TypeExpense, "expenses")
+	case lower == "incomes" || lower == "income" || lower == "доходы":
+		return true, f.setType(storage.TypeIncome, "incomes")
+	case strings.HasPrefix(lower, "category=") || strings.HasPrefix(lower, "категория="):
+		if f.Category != "" {
+			return true, fmt.Errorf("категория указана несколько раз")
+		}
+		f.Category = strings.TrimSpace(token[strings.Index(token, "=")+1:])
+		if f.Category == "" {
+			return true, fmt.Errorf("не указано название категории")
+		}
+		f.Category = canonicalCategory(f.Category, categories)
+		f.labels = append(f.labels, f.Category)
+	case strings.HasPrefix(token, "#"):
+		tag := storage.NormalizeTag(token)
+		if tag == "" {
+			return true, fmt.Errorf("не указано название тега")
+		}
+		f.Tags = append(f.Tags, tag)
+		f.labels = append(f.labels, "#"+tag)
+	default:
+		date, err := time.ParseInLocation(filterDateLayout, token, time.Local)
+		if err != nil {
+			return false, nil
+		}
+		*dates = append(*dates, date)
+	}
+	return true, nil
+}
+
+// canonicalCategory возвращает название категории в написании из списка categories.
+// Категории нет в списке - например, её уже удалили - название остаётся как есть.
+func canonicalCategory(name string, categories []string) string {
+	for _, category := range categories {
+		if strings.EqualFold(category, name) {
+			return category
+		}
+	}
+	return name
+}
+
+// setPeriod устанавливает период по ключевому слову
+func (f *Filter) setPeriod(period string, bounds func() (time.Time, time.Time)) error {
+	if f.Period != "" {
+		return fmt.Errorf("период указан несколько раз")
+	}
+	f.Period = period
+	f.From, f.To = bounds()
+	f.labels = append(f.labels, period)
+	return nil
+}
+
+// setType устанавливает тип транзакций
+func (f *Filter) setType(t storage.TransactionType, label string) error {
+	if f.Type != storage.TypeAll {
+		return fmt.Errorf("тип транзакций указан несколько раз")
+	}
+	f.Type = t
+	f.labels = append(f.labels, label)
+	return nil
+}
+
+// setDates устанавливает период по одной или двум датам
+func (f *Filter) setDates(dates []time.Time) error {
+	if f.Period != "" {
+		return fmt.Errorf("нельзя одновременно указать период и даты")
+	}
+	if len(dates) > 2 {
+		return fmt.Errorf("можно указать не больше двух дат")
+	}
+	from, to := dates[0], dates[len(dates)-1]
+	if to.Before(from) {
+		return fmt.Errorf("дата окончания раньше даты начала")
+	}
+	f.From = from
+	f.To = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	label := from.Format(filterDateLayout)
+	if len(dates) == 2 {
+		label += "_" + to.Format(filterDateLayout)
+	}
+	f.labels = append([]string{label}, f.labels...)
+	return nil
+}
+
+// IsEmpty сообщает, что фильтр не накладывает никаких ограничений
+func (f Filter) IsEmpty() bool {
+	return len(f.labels) == 0
+}
+
+// FileSuffix возвращает часть имени файла, описывающую фильтр, например "month_Продукты_expenses"
+func (f Filter) FileSuffix() string {
+	replacer := strings.NewReplacer(" ", "_", "/", "_", "\\", "_", "\"", "", "#", "")
+	parts := make([]string, len(f.labels))
+	for i, label := range f.labels {
+		parts[i] = replacer.Replace(label)
+	}
+	return strings.Join(parts, "_")
+}
+
+// splitArgs делит строку аргументов по пробелам с учётом двойных кавычек
+func splitArgs(args string) ([]string, error) {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+		started bool
+	)
+	for _, r := range args {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case (r == ' ' || r == '\t' || r == '\n') && !quoted:
+			if started {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("не закрыта кавычка")
+	}
+	if started {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+// Description описывает фильтр для заголовков: "month, Продукты, #командировка"
+func (f Filter) Description() string {
+	return strings.Join(f.labels, ", ")
+}
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// CallbackFind - префикс данных кнопок результатов поиска:
+// fd:p:<страница>, fd:e:<ID транзакции>, fd:d:<ID>:<страница>, fd:y:<ID>:<страница>
+const CallbackFind = "fd"
+
+// findPageSize - сколько транзакций показывать на одной странице результатов поиска
+const findPageSize = 5
+
+// amountRangeRe разбирает ограничения суммы в поиске: 1000-5000, >1000, <5000
+var amountRangeRe = regexp.MustCompile(`^(?:(\d+(?:[.,]\d+)?)-(\d+(?:[.,]\d+)?)|([<>])(\d+(?:[.,]\d+)?))$`)
+
+// ParseSearch разбирает аргументы /find: слова для поиска, ограничения суммы и общую грамматику фильтров.
+// "/find сантехник 1000-5000 year" ищет транзакции со словом "сантехник" на сумму от 1000 до 5000 за год.
+// Категория приводится к написанию из списка categories, как в ParseFilter.
+func ParseSearch(args string, categories []string) (storage.SearchQuery, error) {
+	var query storage.SearchQuery
+	tokens, err := splitArgs(args)
+	if err != nil {
+		return query, err
+	}
+
+	var (
+		f     Filter
+		dates []time.Time
+		words []string
+	)
+	for _, token := range tokens {
+		if matches := amountRangeRe.FindStringSubmatch(token); matches != nil {
+			if err := setAmountRange(&query, matches); err != nil {
+				return query, err
+			}
+			continue
+		}
+		ok, err := f.parseToken(token, categories, &dates)
+		if err != nil {
+			return query, err
+		}
+		if !ok {
+			words = append(words, token)
+		}
+	}
+	if len(dates) > 0 {
+		if err := f.setDates(dates); err != nil {
+			return query, err
+		}
+	}
+	if query.MaxAmount > 0 && query.MinAmount > query.MaxAmount {
+		return query, errors.New("нижняя граница суммы больше верхней")
+	}
+
+	query.TransactionFilter = f.TransactionFilter
+	query.Text = strings.Join(words, " ")
+	if query.Text == "" && f.IsEmpty() && query.MinAmount == 0 && query.MaxAmount == 0 {
+		return query, errors.New("не указано, что искать")
+	}
+	return query, nil
+}
+
+// setAmountRange записывает в запрос ограничение суммы, разобранное amountRangeRe
+func setAmountRange(query *storage.SearchQuery, matches []string) error {
+	parse := func(value string) float64 {
+		amount, _ := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		return amount
+	}
+	switch {
+	case matches[1] != "":
+		if query.MinAmount > 0 || query.MaxAmount > 0 {
+			return errors.New("сумма указана несколько раз")
+		}
+		query.MinAmount, query.MaxAmount = parse(matches[1]), parse(matches[2])
+	case matches[3] == ">":
+		if query.MinAmount > 0 {
+			return errors.New("нижняя граница суммы указана несколько раз")
+		}
+		query.MinAmount = parse(matches[4])
+	default:
+		if query.MaxAmount > 0 {
+			return errors.New("верхняя граница суммы указана несколько раз")
+		}
+		query.MaxAmount = parse(matches[4])
+	}
+	return nil
+}
+
+// HandleFind ищет транзакции по комментарию: /find сантехник, /find такси 500-2000 month.
+// Результаты показываются по страницам, у каждой транзакции есть кнопки изменения и удаления.
+func HandleFind(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string) {
+	args := update.Message.CommandArguments()
+	log.Printf("Обработка команды /find от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, update.Message.From.ID, args)
+	query, err := ParseSearch(args, categories)
+	if err != nil {
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("Не удалось разобрать запрос: %v.\nПример: /find сантехник 1000-5000 year", err))
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	text, markup, err := findPage(s, scope, query, 0)
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакций: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при поиске транзакций.")
+		return
+	}
+	// Результаты отправляются ответом на команду: по ней кнопки страниц восстанавливают запрос
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	msg.ReplyToMessageID = update.Message.MessageID
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке результатов поиска: %v", err)
+	}
+}
+
+// findPage формирует страницу результатов поиска с кнопками
+func findPage(s *storage.Storage, scope storage.Scope, query storage.SearchQuery, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	transactions, total, err := s.SearchTransactions(scope, query, page*findPageSize, findPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "🔎 Ничего не найдено.", nil, nil
+	}
+	pages := (total + findPageSize - 1) / findPageSize
+	if page >= pages {
+		// Пока пользователь листал, часть транзакций удалили
+		return findPage(s, scope, query, pages-1)
+	}
+
+	var names memberNames
+	if scope.IsLedger() {
+		names = ledgerMemberNames(s, scope.LedgerID)
+	}
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🔎 Найдено: %d", total))
+	if pages > 1 {
+		text.WriteString(fmt.Sprintf(", страница %d из %d", page+1, pages))
+	}
+	text.WriteString("\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := range transactions {
+		number := page*findPageSize + i + 1
+		text.WriteString(fmt.Sprintf("\n%d. %s", number, transactionLine(&transactions[i])))
+		if names != nil {
+			text.WriteString(" - " + names.of(transactions[i].UserID))
+		}
+		id := transactions[i].ID
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✏️ %d", number), fmt.Sprintf("%s:e:%d", CallbackFind, id)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %d", number), fmt.Sprintf("%s:d:%d:%d", CallbackFind, id, page)),
+		))
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️ Назад", fmt.Sprintf("%s:p:%d", CallbackFind, page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("Вперёд ▶️", fmt.Sprintf("%s:p:%d", CallbackFind, page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text.String(), &markup, nil
+}
+
+// transactionLine описывает транзакцию одной строкой: "12.03.2026 -3500.00 Дом: сантехник #ремонт"
+func transactionLine(transaction *storage.Transaction) string {
+	line := fmt.Sprintf("%s %.2f %s", transaction.TransactionDate.Format("02.01.2006"), transaction.Amount, transaction.Category)
+	if transaction.Comment != "" {
+		line += ": " + transaction.Comment
+	}
+	if len(transaction.Tags) > 0 {
+		line += " " + FormatTags(transaction)
+	}
+	return line
+}
+
+// HandleFindCallback обрабатывает кнопки результатов поиска: листание страниц, изменение и удаление транзакций
+func HandleFindCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, args string, categories []string) {
+	parts := strings.Split(args, ":")
+	numbers := make([]int, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			numbers = nil
+			break
+		}
+		numbers = append(numbers, number)
+	}
+	action := parts[0]
+	valid := map[string]int{"p": 1, "e": 1, "d": 2, "y": 2}
+	if count, ok := valid[action]; !ok || len(numbers) != count {
+		log.Printf("Некорректные данные кнопки поиска: %s", args)
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+		return
+	}
+
+	switch action {
+	case "p":
+		showFindPage(bot, query, s, categories, numbers[0], "")
+	case "e":
+		startTransactionEdit(bot, query, s, uint(numbers[0]))
+	case "d":
+		confirmTransactionDelete(bot, query, s, uint(numbers[0]), numbers[1])
+	case "y":
+		deleteFoundTransaction(bot, query, s, categories, uint(numbers[0]), numbers[1])
+	}
+}
+
+// showFindPage заново выполняет поиск из команды, на которую отвечает сообщение с результатами, и показывает страницу
+func showFindPage(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, categories []string, page int, notice string) {
+	command := query.Message.ReplyToMessage
+	if command == nil || !command.IsCommand() {
+		answerCallback(bot, query, "Запрос не найден, повторите поиск командой /find.")
+		return
+	}
+	search, err := ParseSearch(command.CommandArguments(), categories)
+	if err != nil {
+		answerCallback(bot, query, "Запрос не найден, повторите поиск командой /find.")
+		return
+	}
+	scope, ok := CallbackScope(bot, query, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	text, markup, err := findPage(s, scope, search, max(page, 0))
+	if err != nil {
+		log.Printf("Ошибка при поиске транзакций: %v", err)
+		answerCallback(bot, query, "Ошибка при поиске транзакций.")
+		return
+	}
+	answerCallback(bot, query, notice)
+	editText(bot, query.Message.Chat.ID, query.Message.MessageID, text, markup)
+}
+
+// foundTransaction возвращает транзакцию, которую нажавший кнопку может изменить или удалить.
+// В общей книге редактор меняет только свои транзакции, владелец - любые.
+func foundTransaction(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, id uint) (*storage.Transaction, storage.Scope, bool) {
+	scope, ok := CallbackScope(bot, query, s, storage.RoleEditor)
+	if !ok {
+		return nil, scope, false
+	}
+	transaction, err := s.GetScopedTransaction(scope, id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ошибка при получении транзакции %d: %v", id, err)
+		}
+		answerCallback(bot, query, "Транзакция не найдена, возможно, она уже удалена.")
+		return nil, scope, false
+	}
+	if !CanModifyTransaction(s, scope, query.From.ID, transaction) {
+		answerCallback(bot, query, "Изменять чужие транзакции может только владелец общего бюджета.")
+		return nil, scope, false
+	}
+	return transaction, scope, true
+}
+
+// CanModifyTransaction сообщает, может ли пользователь изменить или удалить транзакцию области scope:
+// личные транзакции - всегда, в общей книге - свои или любые, если он владелец
+func CanModifyTransaction(s *storage.Storage, scope storage.Scope, userID int64, transaction *storage.Transaction) bool {
+	return transaction.UserID == userID || canModifyAll(s, scope, userID)
+}
+
+// canModifyAll сообщает, может ли пользователь менять любые транзакции области:
+// свои личные или все транзакции общей книги, если он её владелец
+func canModifyAll(s *storage.Storage, scope storage.Scope, userID int64) bool {
+	if !scope.IsLedger() {
+		return true
+	}
+	member, err := s.GetLedgerMember(scope.LedgerID, userID)
+	if err != nil {
+		log.Printf("Ошибка при проверке участника книги %d: %v", scope.LedgerID, err)
+		return false
+	}
+	return member != nil && member.Role == storage.RoleOwner
+}
+
+// startTransactionEdit просит прислать новые сумму и комментарий ответом на сообщение
+func startTransactionEdit(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, id uint) {
+	transaction, _, ok := foundTransaction(bot, query, s, id)
+	if !ok {
+		return
+	}
+
+	example := strings.TrimSpace(strconv.FormatFloat(transaction.Amount, 'f', -1, 64) + " " + transaction.Comment)
+	msg := tgbotapi.NewMessage(query.Message.Chat.ID, fmt.Sprintf("✏️ %s\n\nОтветьте на это сообщение новой суммой и комментарием, например: %s",
+		transactionLine(transaction), example))
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("Ошибка при отправке запроса на изменение транзакции %d: %v", id, err)
+		answerCallback(bot, query, "Не удалось начать изменение.")
+		return
+	}
+	prompt := &storage.EditPrompt{ChatID: sent.Chat.ID, MessageID: sent.MessageID, UserID: query.From.ID, TransactionID: transaction.ID}
+	if err := s.SaveEditPrompt(prompt); err != nil {
+		log.Printf("Ошибка при сохранении запроса на изменение транзакции %d: %v", id, err)
+		answerCallback(bot, query, "Не удалось начать изменение.")
+		return
+	}
+	answerCallback(bot, query, "")
+}
+
+// confirmTransactionDelete показывает транзакцию и просит подтвердить удаление
+func confirmTransactionDelete(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, id uint, page int) {
+	transaction, _, ok := foundTransaction(bot, query, s, id)
+	if !ok {
+		return
+	}
+	answerCallback(bot, query, "")
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", fmt.Sprintf("%s:y:%d:%d", CallbackFind, id, page)),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", fmt.Sprintf("%s:p:%d", CallbackFind, page)),
+	))
+	editText(bot, query.Message.Chat.ID, query.Message.MessageID, "Удалить транзакцию?\n\n"+transactionLine(transaction), &markup)
+}
+
+// deleteFoundTransaction удаляет транзакцию и возвращает к странице результатов
+func deleteFoundTransaction(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, categories []string, id uint, page int) {
+	_, scope, ok := foundTransaction(bot, query, s, id)
+	if !ok {
+		return
+	}
+	if _, err := s.DeleteTransaction(scope, query.From.ID, id); err != nil {
+		log.Printf("Ошибка при удалении транзакции %d: %v", id, err)
+		answerCallback(bot, query, "Не удалось удалить транзакцию.")
+		return
+	}
+	log.Printf("Транзакция %d удалена из результатов поиска", id)
+	showFindPage(bot, query, s, categories, page, "Транзакция удалена, вернуть: /undo")
+}
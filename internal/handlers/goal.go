@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// goalProgressWidth - длина полоски прогресса в символах
+const goalProgressWidth = 10
+
+// HandleGoal создаёт цели накоплений и показывает прогресс:
+//
+//	/goal                          - прогресс по всем целям
+//	/goal Отпуск 150000 2026-07-01 - новая цель с суммой и сроком
+//	/goal remove Отпуск            - удалить цель
+func HandleGoal(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	log.Printf("Обработка команды /goal от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, userID, args)
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	if args == "" {
+		sendGoalsProgress(bot, chatID, s, userID)
+		return
+	}
+	action, name, _ := strings.Cut(args, " ")
+	switch strings.ToLower(action) {
+	case "remove", "delete", "удалить":
+		removeGoal(bot, chatID, s, userID, name)
+		return
+	}
+
+	goal, err := parseGoal(args)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("Не удалось разобрать цель: %v.\nПример: /goal Отпуск 150000 2026-07-01", err))
+		return
+	}
+	goal.UserID = userID
+	if err := s.CreateGoal(goal); err != nil {
+		if errors.Is(err, storage.ErrGoalExists) {
+			sendText(bot, chatID, fmt.Sprintf("Цель «%s» уже есть. Прогресс: /goal", goal.Name))
+			return
+		}
+		log.Printf("Ошибка при создании цели: %v", err)
+		sendText(bot, chatID, "Произошла ошибка при создании цели. Попробуйте еще раз.")
+		return
+	}
+	log.Printf("Создана цель %d «%s» на %.2f", goal.ID, goal.Name, goal.Target)
+
+	text := fmt.Sprintf("🎯 Цель «%s» на %.2f создана.\nОткладывайте деньги сообщением вида «-10000 #%s», а забрать из цели можно так: «+5000 #%s».\nВзносы не считаются расходами.",
+		goal.Name, goal.Target, goal.Tag, goal.Tag)
+	if goal.Deadline != nil {
+		text += fmt.Sprintf("\nЧтобы успеть к %s, нужно откладывать %.2f в месяц.", goal.Deadline.Format("02.01.2006"), monthlyRequired(goal, time.Now()))
+	}
+	sendText(bot, chatID, text)
+}
+
+// parseGoal разбирает аргументы вида "Отпуск в Италии 150000 2026-07-01": название до суммы, затем срок
+func parseGoal(args string) (*storage.Goal, error) {
+	tokens, err := splitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	goal := &storage.Goal{}
+	var name []string
+	for _, token := range tokens {
+		switch {
+		case goal.Target == 0:
+			if amount, ok := parseAmount(token); ok {
+				goal.Target = amount
+			} else {
+				name = append(name, token)
+			}
+		case goal.Deadline == nil:
+			date, ok := parseDueDate(token)
+			if !ok {
+				return nil, fmt.Errorf("не удалось разобрать срок %q, используйте формат 2026-07-01", token)
+			}
+			if date.Before(time.Now()) {
+				return nil, errors.New("срок уже прошёл")
+			}
+			goal.Deadline = &date
+		default:
+			return nil, fmt.Errorf("лишний аргумент %q", token)
+		}
+	}
+	goal.Name = strings.TrimPrefix(strings.Join(name, " "), "#")
+	switch {
+	case goal.Name == "":
+		return nil, errors.New("не указано название")
+	case goal.Target == 0:
+		return nil, errors.New("не указана сумма")
+	}
+	return goal, nil
+}
+
+// removeGoal удаляет цель по названию или тегу
+func removeGoal(bot *tgbotapi.BotAPI, chatID int64, s *storage.Storage, userID int64, name string) {
+	goal, err := s.GetGoalByTag(userID, name)
+	if err != nil {
+		log.Printf("Ошибка при поиске цели «%s»: %v", name, err)
+		sendText(bot, chatID, "Ошибка при удалении цели.")
+		return
+	}
+	if goal == nil {
+		sendText(bot, chatID, fmt.Sprintf("Цели «%s» нет. Список целей: /goal", strings.TrimSpace(name)))
+		return
+	}
+	if err := s.DeleteGoal(userID, goal.ID); err != nil {
+		log.Printf("Ошибка при удалении цели %d: %v", goal.ID, err)
+		sendText(bot, chatID, "Ошибка при удалении цели.")
+		return
+	}
+	log.Printf("Цель %d удалена", goal.ID)
+	sendText(bot, chatID, fmt.Sprintf("🗑 Цель «%s» удалена.", goal.Name))
+}
+
+// sendGoalsProgress отправляет прогресс по всем целям пользователя
+func sendGoalsProgress(bot *tgbotapi.BotAPI, chatID int64, s *storage.Storage, userID int64) {
+	goals, err := s.GetGoals(userID)
+	if err != nil {
+		log.Printf("Ошибка при получении целей пользователя %d: %v", userID, err)
+		sendText(bot, chatID, "Ошибка при получении целей.")
+		return
+	}
+	if len(goals) == 0 {
+		sendText(bot, chatID, "Целей пока нет. Создайте первую: /goal Отпуск 150000 2026-07-01")
+		return
+	}
+
+	parts := make([]string, 0, len(goals))
+	for i := range goals {
+		contributions, err := s.GetGoalContributions(goals[i].ID)
+		if err != nil {
+			log.Printf("Ошибка при получении взносов в цель %d: %v", goals[i].ID, err)
+		}
+		parts = append(parts, goalProgress(&goals[i], contributions, time.Now()))
+	}
+	sendText(bot, chatID, strings.Join(parts, "\n\n"))
+}
+
+// goalProgress описывает прогресс цели: сколько накоплено, сколько нужно откладывать
+// в месяц, чтобы успеть к сроку, и когда цель будет достигнута при текущем темпе взносов
+func goalProgress(goal *storage.Goal, contributions []storage.GoalContribution, now time.Time) string {
+	percent := 0.0
+	if goal.Target > 0 {
+		percent = math.Min(goal.Saved/goal.Target*100, 100)
+	}
+	filled := int(math.Round(percent / 100 * goalProgressWidth))
+	bar := strings.Repeat("■", filled) + strings.Repeat("□", goalProgressWidth-filled)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🎯 %s (#%s)\n%s %.0f%%\nНакоплено %.2f из %.2f", goal.Name, goal.Tag, bar, math.Floor(percent), goal.Saved, goal.Target))
+	if goal.Deadline != nil {
+		text.WriteString(", срок " + goal.Deadline.Format("02.01.2006"))
+	}
+	if goal.Saved >= goal.Target {
+		text.WriteString("\n🎉 Цель достигнута!")
+		return text.String()
+	}
+
+	if goal.Deadline != nil {
+		if goal.Deadline.Before(now) {
+			text.WriteString("\n⚠️ Срок прошёл, осталось накопить " + fmt.Sprintf("%.2f", goal.Target-goal.Saved))
+		} else {
+			text.WriteString(fmt.Sprintf("\nНужно откладывать %.2f в месяц", monthlyRequired(goal, now)))
+		}
+	}
+
+	// Прогноз по среднему темпу взносов с момента первого взноса
+	if len(contributions) == 0 {
+		text.WriteString("\nВзносов пока не было")
+		return text.String()
+	}
+	months := math.Max(now.Sub(contributions[0].CreatedAt).Hours()/24/30, 1)
+	pace := goal.Saved / months
+	if pace <= 0 {
+		text.WriteString("\nПри текущем темпе цель не будет достигнута")
+		return text.String()
+	}
+	projected := now.AddDate(0, 0, int(math.Ceil((goal.Target-goal.Saved)/pace*30)))
+	text.WriteString(fmt.Sprintf("\nСейчас вы откладываете около %.2f в месяц, прогноз: %s", pace, projected.Format("01.2006")))
+	if goal.Deadline != nil && !goal.Deadline.Before(now) {
+		if projected.After(*goal.Deadline) {
+			text.WriteString(" - позже срока")
+		} else {
+			text.WriteString(" - успеваете")
+		}
+	}
+	return text.String()
+}
+
+// monthlyRequired возвращает, сколько нужно откладывать в месяц, чтобы успеть к сроку цели
+func monthlyRequired(goal *storage.Goal, now time.Time) float64 {
+	months := math.Max(math.Ceil(goal.Deadline.Sub(now).Hours()/24/30), 1)
+	return math.Max(goal.Target-goal.Saved, 0) / months
+}
+
+// HandleGoalContribution записывает взнос в цель, если комментарий к сумме содержит тег цели:
+// "-10000 #отпуск" откладывает деньги, "+5000 #отпуск" забирает их из цели.
+// Возвращает false, если тегов целей в комментарии нет и сообщение нужно обработать как транзакцию.
+func HandleGoalContribution(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, amount float64, comment string) bool {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	var goal *storage.Goal
+	for _, tag := range tagRe.FindAllString(comment, -1) {
+		found, err := s.GetGoalByTag(userID, tag)
+		if err != nil {
+			log.Printf("Ошибка при поиске цели по тегу %s: %v", tag, err)
+			return false
+		}
+		if found != nil {
+			goal = found
+			break
+		}
+	}
+	if goal == nil {
+		return false
+	}
+	log.Printf("Сумма %.2f с тегом цели #%s, записываем взнос", amount, goal.Tag)
+
+	wasAchieved := goal.AchievedAt != nil
+	goal, err := s.AddGoalContribution(goal.ID, -amount)
+	if err != nil {
+		if errors.Is(err, storage.ErrGoalOverdrawn) {
+			sendText(bot, chatID, "В цели отложено меньше этой суммы.")
+			return true
+		}
+		log.Printf("Ошибка при записи взноса в цель: %v", err)
+		sendText(bot, chatID, "Произошла ошибка при записи взноса. Попробуйте еще раз.")
+		return true
+	}
+
+	var text string
+	if amount < 0 {
+		text = fmt.Sprintf("💰 Отложено %.2f на цель «%s».", -amount, goal.Name)
+	} else {
+		text = fmt.Sprintf("💸 Из цели «%s» взято %.2f.", goal.Name, amount)
+	}
+	text += fmt.Sprintf(" Накоплено %.2f из %.2f.", goal.Saved, goal.Target)
+	if !wasAchieved && goal.AchievedAt != nil {
+		text += "\n🎉 Поздравляю, цель достигнута!"
+	}
+	sendText(bot, chatID, text)
+	return true
+}
@@ -32,3 +32,11 @@ func GetStartAndEndOfMonth() (time.Time, time.Time) {
 	endOfMonth = time.Date(endOfMonth.Year(), endOfMonth.Month(), endOfMonth.Day(), 23, 59, 59, 0, now.Location())
 	return startOfMonth, endOfMonth
 }
+
+// GetStartAndEndOfYear возвращает начало и конец текущего года
+func GetStartAndEndOfYear() (time.Time, time.Time) {
+	now := time.Now()
+	startOfYear := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+	endOfYear := startOfYear.AddDate(1, 0, 0).Add(-time.Nanosecond)
+	return startOfYear, endOfYear
+}
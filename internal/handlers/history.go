@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// historyLimit - сколько последних изменений транзакции показывать в /history
+const historyLimit = 20
+
+// auditActions - названия действий журнала изменений для сообщений и выгрузки
+var auditActions = map[string]string{
+	storage.AuditCreate:  "создана",
+	storage.AuditUpdate:  "изменена",
+	storage.AuditDelete:  "удалена в корзину",
+	storage.AuditRestore: "восстановлена",
+	storage.AuditPurge:   "удалена окончательно",
+}
+
+// historyFields - столбцы транзакции, изменения которых показывает /history, в порядке вывода
+var historyFields = []struct{ column, label string }{
+	{"amount", "сумма"},
+	{"category", "категория"},
+	{"comment", "комментарий"},
+	{"merchant", "продавец"},
+	{"transaction_date", "дата"},
+}
+
+// HandleHistory показывает, кто и когда создавал, изменял и удалял транзакцию.
+// Транзакция задаётся ответом командой /history на сообщение о ней или номером: /history 42.
+func HandleHistory(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	chatID := update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	log.Printf("Обработка команды /history от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, update.Message.From.ID, args)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var id uint
+	switch {
+	case args == "" && update.Message.ReplyToMessage != nil:
+		transaction, err := s.GetTransactionByMessage(scope, chatID, update.Message.ReplyToMessage.MessageID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Ошибка при поиске транзакции по сообщению: %v", err)
+			}
+			sendText(bot, chatID, "Это сообщение не относится к транзакции, или она удалена. Историю удалённой транзакции можно посмотреть по номеру: /history 42.")
+			return
+		}
+		id = transaction.ID
+	case args != "":
+		number, err := strconv.ParseUint(strings.TrimPrefix(args, "#"), 10, 64)
+		if err != nil {
+			sendText(bot, chatID, "Укажите номер транзакции, например: /history 42. Номера есть в выгрузке /export.")
+			return
+		}
+		id = uint(number)
+	default:
+		sendText(bot, chatID, "Ответьте командой /history на сообщение о транзакции или укажите её номер: /history 42.")
+		return
+	}
+
+	entries, err := s.GetTransactionHistory(scope, id)
+	if err != nil {
+		log.Printf("Ошибка при получении истории транзакции %d: %v", id, err)
+		sendText(bot, chatID, "Ошибка при получении истории транзакции.")
+		return
+	}
+	if len(entries) == 0 {
+		sendText(bot, chatID, fmt.Sprintf("История транзакции %d не найдена.", id))
+		return
+	}
+
+	var names memberNames
+	if scope.IsLedger() {
+		names = ledgerMemberNames(s, scope.LedgerID)
+	}
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📜 История транзакции %d", id))
+	if len(entries) > historyLimit {
+		text.WriteString(fmt.Sprintf(", последние %d изменений из %d", historyLimit, len(entries)))
+		entries = entries[len(entries)-historyLimit:]
+	}
+	text.WriteString("\n")
+	for i := range entries {
+		text.WriteString(fmt.Sprintf("\n%s %s: %s", entries[i].CreatedAt.Format("02.01.2006 15:04"),
+			auditActor(names, entries[i].ActorID), auditActions[entries[i].Action]))
+		if details := historyDetails(&entries[i]); details != "" {
+			text.WriteString(", " + details)
+		}
+	}
+	sendText(bot, chatID, text.String())
+}
+
+// historyDetails описывает, что изменилось в транзакции: при создании - её значения,
+// при изменении - старые и новые значения изменённых полей
+func historyDetails(entry *storage.AuditEntry) string {
+	if entry.Action != storage.AuditCreate && entry.Action != storage.AuditUpdate {
+		return ""
+	}
+	changes, err := entry.Changes()
+	if err != nil {
+		log.Printf("Ошибка разбора записи журнала %d: %v", entry.ID, err)
+		return ""
+	}
+	var parts []string
+	for _, field := range historyFields {
+		change, ok := changes[field.column]
+		if !ok {
+			continue
+		}
+		after := auditValue(field.column, change[1])
+		if entry.Action == storage.AuditCreate {
+			if after != "" {
+				parts = append(parts, fmt.Sprintf("%s %s", field.label, after))
+			}
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s → %s", field.label, orDash(auditValue(field.column, change[0])), orDash(after)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// auditValue форматирует значение столбца из журнала изменений для сообщения
+func auditValue(column string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		if column == "amount" {
+			return fmt.Sprintf("%.2f", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if date, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return date.Format("02.01.2006")
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// orDash заменяет пустое значение прочерком
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// auditActor возвращает имя автора изменения: участника книги, "вы" в личном чате или "бот"
+func auditActor(names memberNames, actorID int64) string {
+	switch {
+	case actorID == storage.SystemActor:
+		return "бот"
+	case names != nil:
+		return names.of(actorID)
+	}
+	return "вы"
+}
+
+// HandleAuditExport отправляет CSV-файл со всем журналом изменений: в личном чате - личных транзакций
+// и категорий, в группе - транзакций общей книги. В группе выгрузка доступна только владельцу.
+func HandleAuditExport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	chatID := update.Message.Chat.ID
+	log.Printf("Обработка команды /audit от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleOwner)
+	if !ok {
+		return
+	}
+
+	entries, err := s.GetAuditLog(scope)
+	if err != nil {
+		log.Printf("Ошибка при получении журнала изменений: %v", err)
+		sendText(bot, chatID, "Ошибка при получении журнала изменений.")
+		return
+	}
+	if len(entries) == 0 {
+		sendText(bot, chatID, "Журнал изменений пуст.")
+		return
+	}
+
+	var names memberNames
+	if scope.IsLedger() {
+		names = ledgerMemberNames(s, scope.LedgerID)
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write([]string{"Время", "Автор", "ID автора", "Действие", "Таблица", "Запись", "До", "После"}); err != nil {
+		log.Printf("Ошибка при записи заголовка журнала в CSV: %v", err)
+		sendText(bot, chatID, "Ошибка при создании CSV-файла.")
+		return
+	}
+	for _, entry := range entries {
+		record := []string{
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+			auditActor(names, entry.ActorID),
+			strconv.FormatInt(entry.ActorID, 10),
+			auditActions[entry.Action],
+			entry.Entity,
+			strconv.FormatUint(uint64(entry.RecordID), 10),
+			entry.Before,
+			entry.After,
+		}
+		if err := w.Write(record); err != nil {
+			log.Printf("Ошибка при записи строки журнала %d в CSV: %v", entry.ID, err)
+			sendText(bot, chatID, "Ошибка при создании CSV-файла.")
+			return
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Ошибка при сбросе буфера CSV журнала: %v", err)
+		sendText(bot, chatID, "Ошибка при создании CSV-файла.")
+		return
+	}
+
+	log.Printf("Отправка журнала изменений: %d записей", len(entries))
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("audit_%s.csv", time.Now().Format("2006-01-02")),
+		Bytes: b.Bytes(),
+	})
+	if _, err := bot.Send(doc); err != nil {
+		log.Printf("Ошибка при отправке журнала изменений: %v", err)
+	}
+}
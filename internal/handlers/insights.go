@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"money-bot/ai"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Параметры поиска необычных транзакций: расход считается необычным, если он
+// в unusualFactor раз больше среднего расхода в своей категории за прошлые месяцы
+const (
+	unusualFactor      = 2.5
+	unusualHistory     = 3 // Сколько прошлых месяцев учитывать
+	unusualMinSamples  = 3 // Минимум транзакций в категории для сравнения
+	insightTopExpenses = 5
+)
+
+// Названия месяцев в предложном падеже для заголовков
+var monthNames = [...]string{"январе", "феврале", "марте", "апреле", "мае", "июне", "июле", "августе", "сентябре", "октябре", "ноябре", "декабре"}
+
+// HandleInsights отправляет AI-обзор трат за текущий месяц.
+// С аргументом prev (или прошлый) обзор строится за прошлый месяц.
+func HandleInsights(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /insights от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+
+	monthStart, _ := GetStartAndEndOfMonth()
+	switch strings.ToLower(strings.TrimSpace(update.Message.CommandArguments())) {
+	case "":
+	case "prev", "прошлый":
+		monthStart = monthStart.AddDate(0, -1, 0)
+	default:
+		sendText(bot, update.Message.Chat.ID, "Используйте /insights для текущего месяца или /insights prev для прошлого.")
+		return
+	}
+
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiTimeout)
+	defer cancel()
+	text, err := BuildMonthlyInsights(ctx, s, scope, monthStart)
+	if err != nil {
+		log.Printf("Ошибка при построении обзора для UserID %d: %v", update.Message.From.ID, err)
+		sendText(bot, update.Message.Chat.ID, "Не удалось подготовить обзор трат. Попробуйте позже.")
+		return
+	}
+	sendText(bot, update.Message.Chat.ID, text)
+}
+
+// BuildMonthlyInsights готовит сводку трат области scope за месяц, начинающийся с monthStart,
+// и просит AI написать по ней обзор. Если расходов за месяц нет, возвращается
+// короткое сообщение без обращения к AI.
+func BuildMonthlyInsights(ctx context.Context, s *storage.Storage, scope storage.Scope, monthStart time.Time) (string, error) {
+	title := fmt.Sprintf("🧠 Обзор трат в %s %d", monthNames[monthStart.Month()-1], monthStart.Year())
+
+	summary, hasExpenses, err := buildMonthlySummary(s, scope, monthStart)
+	if err != nil {
+		return "", err
+	}
+	if !hasExpenses {
+		return title + "\n\nЗа этот месяц расходов не найдено.", nil
+	}
+	log.Printf("Сводка для обзора трат %+v:\n%s", scope, summary)
+
+	narrative, err := ai.GenerateInsights(ctx, summary)
+	if err != nil {
+		return "", err
+	}
+	return title + "\n\n" + narrative, nil
+}
+
+// buildMonthlySummary собирает агрегированные данные за месяц в текстовую сводку для AI
+func buildMonthlySummary(s *storage.Storage, scope storage.Scope, monthStart time.Time) (string, bool, error) {
+	monthEnd := monthStart.AddDate(0, 1, 0).Add(-time.Nanosecond)
+	prevStart := monthStart.AddDate(0, -1, 0)
+
+	current, err := s.GetExpenseTotalsByCategory(scope, monthStart, monthEnd)
+	if err != nil {
+		return "", false, err
+	}
+	if len(current) == 0 {
+		return "", false, nil
+	}
+	previous, err := s.GetExpenseTotalsByCategory(scope, prevStart, monthStart.Add(-time.Nanosecond))
+	if err != nil {
+		return "", false, err
+	}
+	expenses, err := s.GetTransactionsByFilter(scope, storage.TransactionFilter{From: monthStart, To: monthEnd, Type: storage.TypeExpense})
+	if err != nil {
+		return "", false, err
+	}
+	history, err := s.GetTransactionsByFilter(scope, storage.TransactionFilter{
+		From: monthStart.AddDate(0, -unusualHistory, 0),
+		To:   monthStart.Add(-time.Nanosecond),
+		Type: storage.TypeExpense,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Период: %s - %s\n", monthStart.Format("02.01.2006"), monthEnd.Format("02.01.2006")))
+
+	previousByCategory := make(map[string]float64, len(previous))
+	var currentTotal, previousTotal float64
+	for _, total := range previous {
+		previousByCategory[total.Category] = -total.Total
+		previousTotal -= total.Total
+	}
+	for _, total := range current {
+		currentTotal -= total.Total
+	}
+	text.WriteString(fmt.Sprintf("Расходы за месяц: %.2f руб., за прошлый месяц: %.2f руб. (%s)\n", currentTotal, previousTotal, percentChange(currentTotal, previousTotal)))
+
+	text.WriteString("\nРасходы по категориям (этот месяц / прошлый месяц, изменение):\n")
+	for _, total := range current {
+		spent := -total.Total
+		prev := previousByCategory[total.Category]
+		text.WriteString(fmt.Sprintf("- %s: %.2f / %.2f (%s), транзакций: %d\n", total.Category, spent, prev, percentChange(spent, prev), total.Count))
+		delete(previousByCategory, total.Category)
+	}
+	for category, prev := range previousByCategory {
+		text.WriteString(fmt.Sprintf("- %s: 0.00 / %.2f (в этом месяце трат не было)\n", category, prev))
+	}
+
+	// Крупнейшие расходы месяца
+	sort.Slice(expenses, func(i, j int) bool { return expenses[i].Amount < expenses[j].Amount })
+	text.WriteString("\nКрупнейшие расходы:\n")
+	for i, tr := range expenses {
+		if i == insightTopExpenses {
+			break
+		}
+		text.WriteString(fmt.Sprintf("- %s %.2f %s (%s)\n", tr.TransactionDate.Format("02.01"), -tr.Amount, tr.Comment, tr.Category))
+	}
+
+	// Необычные транзакции: сравниваем со средним расходом в категории за прошлые месяцы
+	type stats struct {
+		sum   float64
+		count int
+	}
+	historyByCategory := make(map[string]stats)
+	for _, tr := range history {
+		st := historyByCategory[tr.Category]
+		st.sum -= tr.Amount
+		st.count++
+		historyByCategory[tr.Category] = st
+	}
+	var unusual []string
+	for _, tr := range expenses {
+		st := historyByCategory[tr.Category]
+		if st.count < unusualMinSamples {
+			continue
+		}
+		average := st.sum / float64(st.count)
+		if -tr.Amount > average*unusualFactor {
+			unusual = append(unusual, fmt.Sprintf("- %s %.2f %s (%s), обычно около %.2f\n", tr.TransactionDate.Format("02.01"), -tr.Amount, tr.Comment, tr.Category, average))
+		}
+	}
+	if len(unusual) > 0 {
+		text.WriteString("\nНеобычно крупные для своей категории транзакции:\n")
+		text.WriteString(strings.Join(unusual, ""))
+	}
+
+	return text.String(), true, nil
+}
+
+// percentChange описывает изменение суммы в процентах
+func percentChange(current, previous float64) string {
+	if previous == 0 {
+		if current == 0 {
+			return "без изменений"
+		}
+		return "в прошлом месяце трат не было"
+	}
+	change := (current - previous) / previous * 100
+	return fmt.Sprintf("%+.0f%%", math.Round(change))
+}
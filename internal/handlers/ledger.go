@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Названия ролей для сообщений пользователю
+var roleNames = map[string]string{
+	storage.RoleOwner:  "владелец",
+	storage.RoleEditor: "редактор",
+	storage.RoleViewer: "зритель",
+}
+
+// roleAliases - написания ролей, которые принимают команды
+var roleAliases = map[string]string{
+	"owner": storage.RoleOwner, "владелец": storage.RoleOwner,
+	"editor": storage.RoleEditor, "редактор": storage.RoleEditor,
+	"viewer": storage.RoleViewer, "зритель": storage.RoleViewer,
+}
+
+// IsGroupChat сообщает, что сообщение пришло из группы, где ведётся общая книга
+func IsGroupChat(message *tgbotapi.Message) bool {
+	return message.Chat.IsGroup() || message.Chat.IsSuperGroup()
+}
+
+// ChatScope определяет, с чьими транзакциями работает команда: в личном чате - с личными
+// транзакциями автора, в группе - с общей книгой группы. В группе проверяется, что у автора
+// есть роль не ниже need; если прав нет, автор получает сообщение, а вторым значением возвращается false.
+func ChatScope(bot *tgbotapi.BotAPI, message *tgbotapi.Message, s *storage.Storage, need string) (storage.Scope, bool) {
+	scope, refusal := resolveScope(s, message.Chat, message.From, need)
+	if refusal != "" {
+		sendText(bot, message.Chat.ID, refusal)
+		return storage.Scope{}, false
+	}
+	return scope, true
+}
+
+// CallbackScope работает как ChatScope для нажатия на кнопку: права проверяются у нажавшего,
+// а отказ показывается всплывающим уведомлением
+func CallbackScope(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, need string) (storage.Scope, bool) {
+	scope, refusal := resolveScope(s, query.Message.Chat, query.From, need)
+	if refusal != "" {
+		answerCallback(bot, query, refusal)
+		return storage.Scope{}, false
+	}
+	return scope, true
+}
+
+// resolveScope возвращает область транзакций пользователя user в чате chat
+// или объяснение, почему у него нет роли need
+func resolveScope(s *storage.Storage, chat *tgbotapi.Chat, user *tgbotapi.User, need string) (storage.Scope, string) {
+	if !chat.IsGroup() && !chat.IsSuperGroup() {
+		return storage.PersonalScope(user.ID), ""
+	}
+
+	ledger, err := s.GetOrCreateLedger(chat.ID, chat.Title, user.ID, MemberName(user))
+	if err != nil {
+		log.Printf("Ошибка при получении общей книги чата %d: %v", chat.ID, err)
+		return storage.Scope{}, "Ошибка при обращении к общему бюджету группы."
+	}
+	member, err := s.GetLedgerMember(ledger.ID, user.ID)
+	if err != nil {
+		log.Printf("Ошибка при проверке участника книги %d: %v", ledger.ID, err)
+		return storage.Scope{}, "Ошибка при обращении к общему бюджету группы."
+	}
+	if member == nil {
+		log.Printf("Пользователь %d не участник книги %d", user.ID, ledger.ID)
+		return storage.Scope{}, fmt.Sprintf("%s, вы не участник общего бюджета этой группы. Попросите владельца ответить на ваше сообщение командой /invite.", MemberName(user))
+	}
+	if !storage.RoleAllows(member.Role, need) {
+		log.Printf("У пользователя %d роль %s, требуется %s", user.ID, member.Role, need)
+		return storage.Scope{}, fmt.Sprintf("Для этого нужна роль «%s», у вас «%s».", roleNames[need], roleNames[member.Role])
+	}
+	return storage.LedgerScope(ledger.ID), ""
+}
+
+// PersonalOnly отвечает, что команда доступна только в личном чате, если сообщение пришло из группы
+func PersonalOnly(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	if IsGroupChat(message) {
+		sendText(bot, message.Chat.ID, "Эта команда доступна только в личном чате с ботом.")
+		return false
+	}
+	return true
+}
+
+// HandleMembers показывает участников общей книги группы и их роли
+func HandleMembers(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /members от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !IsGroupChat(update.Message) {
+		sendText(bot, update.Message.Chat.ID, "Участники есть только у общего бюджета группы. Добавьте бота в группу.")
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := s.GetLedgerMembers(scope.LedgerID)
+	if err != nil {
+		log.Printf("Ошибка при получении участников книги %d: %v", scope.LedgerID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при получении списка участников.")
+		return
+	}
+	var text strings.Builder
+	text.WriteString("👥 Участники общего бюджета:\n")
+	for _, member := range members {
+		text.WriteString(fmt.Sprintf("• %s - %s\n", member.Name, roleNames[member.Role]))
+	}
+	text.WriteString("\nДобавить или сменить роль: ответьте на сообщение участника командой /invite [editor|viewer|owner].\nИсключить: /remove в ответ на сообщение или /remove @username.")
+	sendText(bot, update.Message.Chat.ID, text.String())
+}
+
+// HandleInvite добавляет участника в общую книгу группы или меняет его роль.
+// Участник указывается ответом на его сообщение или упоминанием; роль по умолчанию - редактор.
+func HandleInvite(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /invite от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !GroupOnly(bot, update.Message) {
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleOwner)
+	if !ok {
+		return
+	}
+
+	role := storage.RoleEditor
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		if alias, ok := roleAliases[strings.ToLower(arg)]; ok {
+			role = alias
+		}
+	}
+	userID, name, ok := targetMember(update.Message, s, scope.LedgerID)
+	if !ok {
+		sendText(bot, update.Message.Chat.ID, "Ответьте командой /invite на сообщение человека, которого нужно добавить, или упомяните участника.")
+		return
+	}
+
+	if err := s.SetLedgerMember(scope.LedgerID, userID, name, role); err != nil {
+		if errors.Is(err, storage.ErrLastOwner) {
+			sendText(bot, update.Message.Chat.ID, "Нельзя понизить единственного владельца: сначала назначьте другого.")
+			return
+		}
+		log.Printf("Ошибка при добавлении участника %d в книгу %d: %v", userID, scope.LedgerID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при добавлении участника.")
+		return
+	}
+	log.Printf("Пользователь %d добавлен в книгу %d с ролью %s", userID, scope.LedgerID, role)
+	sendText(bot, update.Message.Chat.ID, fmt.Sprintf("✅ %s теперь участник общего бюджета с ролью «%s».", name, roleNames[role]))
+}
+
+// HandleRemoveMember исключает участника из общей книги группы. Его транзакции остаются в книге.
+func HandleRemoveMember(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /remove от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !GroupOnly(bot, update.Message) {
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleOwner)
+	if !ok {
+		return
+	}
+
+	userID, name, ok := targetMember(update.Message, s, scope.LedgerID)
+	if !ok {
+		sendText(bot, update.Message.Chat.ID, "Ответьте командой /remove на сообщение участника или укажите его: /remove @username.")
+		return
+	}
+	removed, err := s.RemoveLedgerMember(scope.LedgerID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrLastOwner) {
+			sendText(bot, update.Message.Chat.ID, "Нельзя исключить единственного владельца.")
+			return
+		}
+		log.Printf("Ошибка при исключении участника %d из книги %d: %v", userID, scope.LedgerID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при исключении участника.")
+		return
+	}
+	if !removed {
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("%s не участник общего бюджета.", name))
+		return
+	}
+	log.Printf("Пользователь %d исключён из книги %d", userID, scope.LedgerID)
+	sendText(bot, update.Message.Chat.ID, fmt.Sprintf("🚪 %s исключён из общего бюджета. Его записи остались в истории.", name))
+}
+
+// GroupOnly отвечает, что команда доступна только в группе, если сообщение пришло из личного чата
+func GroupOnly(bot *tgbotapi.BotAPI, message *tgbotapi.Message) bool {
+	if !IsGroupChat(message) {
+		sendText(bot, message.Chat.ID, "Эта команда работает только в группе с общим бюджетом.")
+		return false
+	}
+	return true
+}
+
+// targetMember определяет пользователя, к которому относится команда: автора сообщения,
+// на которое ответили, упомянутого пользователя без username или участника книги по @username
+func targetMember(message *tgbotapi.Message, s *storage.Storage, ledgerID uint) (int64, string, bool) {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && !reply.From.IsBot {
+		return reply.From.ID, MemberName(reply.From), true
+	}
+	for _, entity := range message.Entities {
+		if entity.Type == "text_mention" && entity.User != nil && !entity.User.IsBot {
+			return entity.User.ID, MemberName(entity.User), true
+		}
+	}
+	// Bot API не позволяет узнать ID по @username, поэтому так можно указать только уже известного участника
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if !strings.HasPrefix(arg, "@") {
+			continue
+		}
+		members, err := s.GetLedgerMembers(ledgerID)
+		if err != nil {
+			log.Printf("Ошибка при получении участников книги %d: %v", ledgerID, err)
+			return 0, "", false
+		}
+		for _, member := range members {
+			if strings.EqualFold(member.Name, arg) {
+				return member.UserID, member.Name, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// memberNames - имена участников общей книги по их идентификаторам
+type memberNames map[int64]string
+
+// ledgerMemberNames загружает имена участников книги. При ошибке возвращается пустой
+// список: сообщение всё равно можно показать, просто без имён.
+func ledgerMemberNames(s *storage.Storage, ledgerID uint) memberNames {
+	members, err := s.GetLedgerMembers(ledgerID)
+	if err != nil {
+		log.Printf("Ошибка при получении участников книги %d: %v", ledgerID, err)
+	}
+	names := make(memberNames, len(members))
+	for _, member := range members {
+		names[member.UserID] = member.Name
+	}
+	return names
+}
+
+// of возвращает имя участника; участник мог покинуть книгу, но его записи в ней остаются
+func (names memberNames) of(userID int64) string {
+	if name, ok := names[userID]; ok {
+		return name
+	}
+	return fmt.Sprintf("бывший участник %d", userID)
+}
+
+// MemberName возвращает имя пользователя для отчётов: @username, а если его нет - имя в Telegram
+func MemberName(user *tgbotapi.User) string {
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
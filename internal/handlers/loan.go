@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// dueDateLayouts - форматы сроков в аргументах команд
+var dueDateLayouts = []string{filterDateLayout, "02.01.2006"}
+
+// HandleLend записывает деньги, данные в долг: /lend Иван 5000 до 2026-12-01 на ремонт
+func HandleLend(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	handleNewLoan(bot, update, s, storage.LoanLent)
+}
+
+// HandleBorrow записывает деньги, взятые в долг: /borrow Пётр 3000 до 01.12.2026
+func HandleBorrow(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	handleNewLoan(bot, update, s, storage.LoanBorrowed)
+}
+
+// handleNewLoan разбирает аргументы /lend и /borrow и сохраняет долг
+func handleNewLoan(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, direction string) {
+	command := "/" + update.Message.Command()
+	log.Printf("Обработка команды %s от пользователя %s (ID: %d), аргументы: \"%s\"", command, update.Message.From.UserName, update.Message.From.ID, update.Message.CommandArguments())
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	loan, err := parseLoan(update.Message.CommandArguments())
+	if err != nil {
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("Не удалось разобрать долг: %v.\nПример: %s Иван 5000 до 2026-12-01 на ремонт", err, command))
+		return
+	}
+	loan.UserID = update.Message.From.ID
+	loan.Direction = direction
+	if err := s.CreateLoan(loan); err != nil {
+		log.Printf("Ошибка при сохранении долга: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Произошла ошибка при сохранении долга. Попробуйте еще раз.")
+		return
+	}
+	log.Printf("Долг сохранён. ID: %d, направление: %s, сумма: %.2f", loan.ID, direction, loan.Amount)
+
+	text := fmt.Sprintf("✅ Записано: %s\nДолг не попадёт в расходы и доходы, но учитывается в деньгах на руках (/loans).", describeLoan(loan))
+	if loan.DueDate != nil {
+		text += "\nНапомню о сроке накануне."
+	}
+	sendText(bot, update.Message.Chat.ID, text)
+}
+
+// parseLoan разбирает аргументы вида "Иван 5000 до 2026-12-01 на ремонт": имя до суммы,
+// срок - дата после слова "до" или отдельной датой, всё остальное - комментарий
+func parseLoan(args string) (*storage.Loan, error) {
+	tokens, err := splitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	loan := &storage.Loan{}
+	var name, comment []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if loan.Amount == 0 {
+			if amount, ok := parseAmount(token); ok {
+				loan.Amount = amount
+				continue
+			}
+			name = append(name, token)
+			continue
+		}
+		if strings.EqualFold(token, "до") && i+1 < len(tokens) {
+			if date, ok := parseDueDate(tokens[i+1]); ok {
+				loan.DueDate = &date
+				i++
+				continue
+			}
+		}
+		if date, ok := parseDueDate(token); ok && loan.DueDate == nil {
+			loan.DueDate = &date
+			continue
+		}
+		comment = append(comment, token)
+	}
+
+	switch {
+	case len(name) == 0:
+		return nil, errors.New("не указано, с кем связан долг")
+	case loan.Amount == 0:
+		return nil, errors.New("не указана сумма")
+	}
+	loan.Counterparty = strings.Join(name, " ")
+	loan.Comment = strings.Join(comment, " ")
+	return loan, nil
+}
+
+// parseAmount разбирает положительную сумму; допускается запятая вместо точки
+func parseAmount(token string) (float64, bool) {
+	amount, err := strconv.ParseFloat(strings.Replace(token, ",", ".", 1), 64)
+	if err != nil || amount <= 0 || math.IsInf(amount, 0) {
+		return 0, false
+	}
+	return math.Round(amount*100) / 100, true
+}
+
+// parseDueDate разбирает срок; срок действует до конца указанного дня
+func parseDueDate(token string) (time.Time, bool) {
+	for _, layout := range dueDateLayouts {
+		if date, err := time.ParseInLocation(layout, token, time.Local); err == nil {
+			return date.Add(24*time.Hour - time.Second), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// HandleRepay записывает погашение долга: /repay Иван 2000 или /repay #3 2000.
+// Без суммы долг погашается полностью. Если с человеком несколько долгов,
+// погашение распределяется начиная с самого старого. Если имени соответствуют
+// долги с разными людьми ("Валя" и "Валера"), бот просит указать номер долга.
+func HandleRepay(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	log.Printf("Обработка команды /repay от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, userID, update.Message.CommandArguments())
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	tokens, err := splitArgs(update.Message.CommandArguments())
+	if err != nil || len(tokens) == 0 {
+		sendText(bot, chatID, "Укажите, чей долг погашен: /repay Иван 2000 или /repay #3 2000. Номера долгов - в /loans.")
+		return
+	}
+	var amount float64
+	if value, ok := parseAmount(tokens[len(tokens)-1]); ok && len(tokens) > 1 {
+		amount = value
+		tokens = tokens[:len(tokens)-1]
+	}
+	target := strings.Join(tokens, " ")
+
+	loans, err := s.GetOpenLoans(userID)
+	if err != nil {
+		log.Printf("Ошибка при получении долгов пользователя %d: %v", userID, err)
+		sendText(bot, chatID, "Ошибка при получении долгов.")
+		return
+	}
+	matching := matchLoans(loans, target)
+	if len(matching) == 0 {
+		sendText(bot, chatID, fmt.Sprintf("Непогашенных долгов «%s» не найдено. Список долгов: /loans", target))
+		return
+	}
+	if names := loanCounterparties(matching); len(names) > 1 {
+		sendText(bot, chatID, fmt.Sprintf("Имени «%s» соответствуют долги с разными людьми: %s. Укажите номер долга из /loans: /repay #%d 2000",
+			target, strings.Join(names, ", "), matching[0].ID))
+		return
+	}
+	for _, loan := range matching[1:] {
+		if loan.Direction != matching[0].Direction {
+			sendText(bot, chatID, fmt.Sprintf("С «%s» есть долги в обе стороны. Укажите номер долга из /loans: /repay #3 2000", target))
+			return
+		}
+	}
+
+	var remaining float64
+	for _, loan := range matching {
+		remaining += loan.Remaining()
+	}
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining+0.005 {
+		sendText(bot, chatID, fmt.Sprintf("Сумма больше остатка долга: осталось %.2f.", remaining))
+		return
+	}
+
+	var text strings.Builder
+	left := amount
+	for _, loan := range matching {
+		if left <= 0 {
+			break
+		}
+		part := math.Min(left, loan.Remaining())
+		updated, err := s.RepayLoan(userID, loan.ID, part)
+		if err != nil {
+			log.Printf("Ошибка при погашении долга %d: %v", loan.ID, err)
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, storage.ErrRepaymentTooLarge) {
+				sendText(bot, chatID, "Долг изменился, проверьте /loans и повторите.")
+			} else {
+				sendText(bot, chatID, "Ошибка при записи погашения.")
+			}
+			return
+		}
+		log.Printf("Долг %d погашен на %.2f, остаток %.2f", loan.ID, part, updated.Remaining())
+		left = math.Round((left-part)*100) / 100
+		if updated.ClosedAt != nil {
+			text.WriteString(fmt.Sprintf("✅ Долг #%d погашен полностью: %s\n", updated.ID, describeLoan(updated)))
+		} else {
+			text.WriteString(fmt.Sprintf("💸 По долгу #%d погашено %.2f, осталось %.2f: %s\n", updated.ID, part, updated.Remaining(), describeLoan(updated)))
+		}
+	}
+	sendText(bot, chatID, strings.TrimSpace(text.String()))
+}
+
+// matchLoans находит долги по номеру (#3) или имени. Точное совпадение имени без учёта
+// регистра важнее похожего: "Валя" не находит долги Валеры, если есть долг Вали.
+func matchLoans(loans []storage.Loan, target string) []storage.Loan {
+	var exact, similar []storage.Loan
+	for _, loan := range loans {
+		switch {
+		case target == fmt.Sprintf("#%d", loan.ID):
+			return []storage.Loan{loan}
+		case strings.EqualFold(strings.TrimSpace(loan.Counterparty), strings.TrimSpace(target)):
+			exact = append(exact, loan)
+		case sameCounterparty(loan.Counterparty, target):
+			similar = append(similar, loan)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return similar
+}
+
+// loanCounterparties возвращает разные имена в списке долгов без учёта регистра, в порядке появления
+func loanCounterparties(loans []storage.Loan) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, loan := range loans {
+		key := strings.ToLower(strings.TrimSpace(loan.Counterparty))
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, loan.Counterparty)
+		}
+	}
+	return names
+}
+
+// sameCounterparty сравнивает имена без учёта регистра и падежного окончания: "Иван" и "Ивану"
+func sameCounterparty(name, target string) bool {
+	name, target = strings.ToLower(strings.TrimSpace(name)), strings.ToLower(strings.TrimSpace(target))
+	if name == target {
+		return true
+	}
+	a, b := []rune(name), []rune(target)
+	n := min(len(a), len(b)) - 1
+	if n < 3 || absInt(len(a)-len(b)) > 2 {
+		return false
+	}
+	return string(a[:n]) == string(b[:n])
+}
+
+// absInt возвращает модуль целого числа
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// HandleLoans показывает непогашенные долги и деньги на руках с их учётом
+func HandleLoans(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	log.Printf("Обработка команды /loans от пользователя %s (ID: %d)", update.Message.From.UserName, userID)
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	loans, err := s.GetOpenLoans(userID)
+	if err != nil {
+		log.Printf("Ошибка при получении долгов пользователя %d: %v", userID, err)
+		sendText(bot, chatID, "Ошибка при получении долгов.")
+		return
+	}
+	if len(loans) == 0 {
+		sendText(bot, chatID, "Непогашенных долгов нет.\nЗаписать долг: /lend Иван 5000 или /borrow Пётр 3000 до 2026-12-01")
+		return
+	}
+
+	var text strings.Builder
+	var lent, borrowed float64
+	for _, direction := range []string{storage.LoanLent, storage.LoanBorrowed} {
+		header := false
+		for i := range loans {
+			loan := &loans[i]
+			if loan.Direction != direction {
+				continue
+			}
+			if !header {
+				if direction == storage.LoanLent {
+					text.WriteString("📤 Вам должны:\n")
+				} else {
+					text.WriteString("📥 Вы должны:\n")
+				}
+				header = true
+			}
+			text.WriteString(fmt.Sprintf("#%d %s - %.2f", loan.ID, loan.Counterparty, loan.Remaining()))
+			if loan.Repaid > 0 {
+				text.WriteString(fmt.Sprintf(" из %.2f", loan.Amount))
+			}
+			if loan.DueDate != nil {
+				text.WriteString(", до " + loan.DueDate.Format("02.01.2006"))
+				if loan.DueDate.Before(time.Now()) {
+					text.WriteString(" ⚠️ просрочен")
+				}
+			}
+			if loan.Comment != "" {
+				text.WriteString(" (" + loan.Comment + ")")
+			}
+			text.WriteString("\n")
+			if direction == storage.LoanLent {
+				lent += loan.Remaining()
+			} else {
+				borrowed += loan.Remaining()
+			}
+		}
+		if header {
+			text.WriteString("\n")
+		}
+	}
+
+	text.WriteString(fmt.Sprintf("Итого вам должны: %.2f, вы должны: %.2f\n", lent, borrowed))
+	if balance, err := s.GetAllTimeSummary(storage.PersonalScope(userID)); err != nil {
+		log.Printf("Ошибка при получении общего баланса для UserID %d: %v", userID, err)
+	} else {
+		// Выдача и получение долга не записываются транзакциями, поэтому баланс уже равен чистым активам,
+		// а деньги на руках отличаются от него на сумму долгов
+		text.WriteString(fmt.Sprintf("💼 Чистые активы: %.2f, долги их не меняют\n", balance))
+		text.WriteString(fmt.Sprintf("💵 На руках: %.2f (баланс − долги вам + ваши долги)\n", balance-lent+borrowed))
+	}
+	text.WriteString("\nОтметить погашение: /repay Иван 2000 или /repay #3")
+	sendText(bot, chatID, text.String())
+}
+
+// LoanReminder формирует напоминание о сроке возврата долга
+func LoanReminder(loan *storage.Loan) string {
+	when := "завтра"
+	if loan.DueDate.Before(time.Now()) {
+		when = "просрочен с " + loan.DueDate.Format("02.01.2006")
+	} else if sameDay(*loan.DueDate, time.Now()) {
+		when = "сегодня"
+	}
+	return fmt.Sprintf("⏰ Срок возврата долга #%d %s: %s\nКогда долг вернут, отметьте это: /repay #%d", loan.ID, when, describeLoan(loan), loan.ID)
+}
+
+// sameDay сообщает, приходятся ли моменты на один календарный день
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// describeLoan описывает долг одной строкой
+func describeLoan(loan *storage.Loan) string {
+	var text string
+	if loan.Direction == storage.LoanLent {
+		text = fmt.Sprintf("%s должен вам %.2f", loan.Counterparty, loan.Remaining())
+	} else {
+		text = fmt.Sprintf("вы должны %s %.2f", loan.Counterparty, loan.Remaining())
+	}
+	if loan.ClosedAt != nil {
+		text = fmt.Sprintf("%s, %.2f", loan.Counterparty, loan.Amount)
+	}
+	if loan.DueDate != nil && loan.ClosedAt == nil {
+		text += " до " + loan.DueDate.Format("02.01.2006")
+	}
+	if loan.Comment != "" && utf8.RuneCountInString(loan.Comment) <= 40 {
+		text += " (" + loan.Comment + ")"
+	}
+	return text
+}
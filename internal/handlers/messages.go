@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// aiTimeout - сколько хендлер готов ждать ответа AI с учётом повторных попыток
+const aiTimeout = 60 * time.Second
+
+// sendText отправляет простое текстовое сообщение и логирует ошибку отправки
+func sendText(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
+	}
+}
+
+// editText заменяет текст отправленного сообщения; markup задаёт новые кнопки, nil - убрать кнопки
+func editText(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = markup
+	if _, err := bot.Send(edit); err != nil {
+		log.Printf("Ошибка при изменении сообщения %d в чате %d: %v", messageID, chatID, err)
+	}
+}
+
+// answerCallback отвечает на нажатие кнопки всплывающим уведомлением
+func answerCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, text string) {
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Ошибка при ответе на нажатие кнопки: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"money-bot/ai"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// CallbackRecategorize - префикс данных кнопок перекатегоризации: rc:<действие>:<ID пакета>
+const CallbackRecategorize = "rc"
+
+const (
+	// recategorizeRate - пауза между запросами к AI, чтобы не упереться в лимиты OpenRouter
+	recategorizeRate = time.Second
+	// recategorizeLimit - максимум транзакций за один запуск
+	recategorizeLimit = 500
+	// recategorizeProgressEvery - как часто обновлять сообщение о ходе работы
+	recategorizeProgressEvery = 3 * time.Second
+	// recategorizePreviewLines - сколько изменений показывать в предпросмотре
+	recategorizePreviewLines = 20
+)
+
+// recategorizeRunning отмечает пользователей, у которых идёт перекатегоризация:
+// одновременно у пользователя может выполняться только один запуск
+var recategorizeRunning sync.Map
+
+// HandleRecategorize заново классифицирует расходы из истории и предлагает изменения категорий.
+// Аргументы - общая грамматика фильтров: /recategorize month category=Прочее.
+// Изменения не применяются сразу: пользователь видит предпросмотр и подтверждает его кнопкой.
+// /recategorize undo отменяет последний применённый пакет изменений.
+func HandleRecategorize(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	log.Printf("Обработка команды /recategorize от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, userID, args)
+	if !PersonalOnly(bot, update.Message) {
+		return
+	}
+
+	if lower := strings.ToLower(args); lower == "undo" || lower == "отмена" {
+		undoLastRecategorization(bot, chatID, userID, s)
+		return
+	}
+
+	filter, err := ParseFilter(args, categories)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("Не удалось разобрать фильтр: %v.\nПример: /recategorize month category=Прочее", err))
+		return
+	}
+	if filter.Type == storage.TypeIncome {
+		sendText(bot, chatID, "Перекатегоризация работает только с расходами.")
+		return
+	}
+	filter.Type = storage.TypeExpense
+
+	all, err := s.GetTransactionsByFilter(storage.PersonalScope(userID), filter.TransactionFilter)
+	if err != nil {
+		log.Printf("Ошибка при получении транзакций для перекатегоризации: %v", err)
+		sendText(bot, chatID, "Ошибка при получении транзакций.")
+		return
+	}
+	// Без комментария классифицировать нечего, а возвраты следуют категории своей покупки
+	var transactions []storage.Transaction
+	for _, tr := range all {
+		if strings.TrimSpace(tr.Comment) != "" && tr.RefundOfID == nil {
+			transactions = append(transactions, tr)
+		}
+	}
+	if len(transactions) == 0 {
+		sendText(bot, chatID, "Нет расходов с комментариями, подходящих под фильтр.")
+		return
+	}
+	if len(transactions) > recategorizeLimit {
+		sendText(bot, chatID, fmt.Sprintf("Под фильтр попадает %d расходов, за один раз можно обработать не больше %d. Уточните период или категорию.", len(transactions), recategorizeLimit))
+		return
+	}
+
+	if _, busy := recategorizeRunning.LoadOrStore(userID, struct{}{}); busy {
+		sendText(bot, chatID, "Перекатегоризация уже выполняется, дождитесь её окончания.")
+		return
+	}
+
+	progress, err := bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("🔄 Перекатегоризация: 0 из %d", len(transactions))))
+	if err != nil {
+		recategorizeRunning.Delete(userID)
+		log.Printf("Ошибка при отправке сообщения о ходе перекатегоризации: %v", err)
+		return
+	}
+
+	// Классификация сотен транзакций с паузами занимает минуты, поэтому выполняется
+	// в фоне и не задерживает обработку остальных сообщений чата
+	go func() {
+		defer recategorizeRunning.Delete(userID)
+		runRecategorization(bot, s, userID, progress, transactions, categories)
+	}()
+}
+
+// runRecategorization классифицирует транзакции и сохраняет предложенные изменения черновиком пакета
+func runRecategorization(bot *tgbotapi.BotAPI, s *storage.Storage, userID int64, progress tgbotapi.Message, transactions []storage.Transaction, categories []string) {
+	chatID, messageID := progress.Chat.ID, progress.MessageID
+	log.Printf("Начинаем перекатегоризацию %d транзакций для UserID %d", len(transactions), userID)
+
+	// Одинаковые комментарии классифицируем один раз: сравниваем их так же, как кеш категорий
+	results := make(map[string]string)
+	var (
+		changes      []storage.RecategorizationChange
+		failed       int
+		lastProgress = time.Now()
+		lastCall     time.Time
+	)
+	for i, tr := range transactions {
+		key := storage.NormalizeComment(tr.Comment)
+		category, known := results[key]
+		if !known {
+			if wait := recategorizeRate - time.Since(lastCall); wait > 0 {
+				time.Sleep(wait)
+			}
+			lastCall = time.Now()
+
+			ctx, cancel := context.WithTimeout(context.Background(), aiTimeout)
+			classification, err := ai.ClassifyTransaction(ctx, tr.Comment, categories)
+			cancel()
+			if errors.Is(err, ai.ErrCircuitOpen) {
+				log.Printf("AI отключен, перекатегоризация для UserID %d прервана", userID)
+				editText(bot, chatID, messageID, fmt.Sprintf("⚠️ AI недоступен, перекатегоризация прервана после %d из %d транзакций. Попробуйте позже.", i, len(transactions)), nil)
+				return
+			}
+			if err != nil {
+				log.Printf("Ошибка при классификации транзакции %d: %v", tr.ID, err)
+				failed++
+			} else {
+				category = classification.Category
+			}
+			results[key] = category
+		}
+
+		if category != "" && category != tr.Category {
+			changes = append(changes, storage.RecategorizationChange{
+				TransactionID: tr.ID,
+				Amount:        tr.Amount,
+				Comment:       tr.Comment,
+				OldCategory:   tr.Category,
+				NewCategory:   category,
+			})
+		}
+
+		if time.Since(lastProgress) >= recategorizeProgressEvery {
+			lastProgress = time.Now()
+			editText(bot, chatID, messageID, fmt.Sprintf("🔄 Перекатегоризация: %d из %d, изменений: %d", i+1, len(transactions), len(changes)), nil)
+		}
+	}
+
+	summary := fmt.Sprintf("Проверено транзакций: %d", len(transactions))
+	if failed > 0 {
+		summary += fmt.Sprintf(", не удалось классифицировать: %d", failed)
+	}
+	if len(changes) == 0 {
+		editText(bot, chatID, messageID, "✅ Категории менять не нужно.\n"+summary, nil)
+		return
+	}
+
+	batch, err := s.CreateRecategorizationBatch(userID, changes)
+	if err != nil {
+		log.Printf("Ошибка при сохранении пакета перекатегоризации: %v", err)
+		editText(bot, chatID, messageID, "Ошибка при сохранении предложенных изменений.", nil)
+		return
+	}
+	log.Printf("Перекатегоризация для UserID %d: предложено %d изменений, пакет %d", userID, len(changes), batch.ID)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🔍 Предлагаемые изменения (%d):\n", len(changes)))
+	for i, change := range changes {
+		if i == recategorizePreviewLines {
+			text.WriteString(fmt.Sprintf("… и ещё %d\n", len(changes)-recategorizePreviewLines))
+			break
+		}
+		text.WriteString(fmt.Sprintf("%.2f %s: %s → %s\n", change.Amount, change.Comment, change.OldCategory, change.NewCategory))
+	}
+	text.WriteString("\n" + summary)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Применить", recategorizeData("apply", batch.ID)),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", recategorizeData("cancel", batch.ID)),
+	))
+	editText(bot, chatID, messageID, text.String(), &keyboard)
+}
+
+// HandleRecategorizeCallback обрабатывает кнопки предпросмотра: применить, отказаться, отменить применённое
+func HandleRecategorizeCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, args string) {
+	action, idText, _ := strings.Cut(args, ":")
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+		return
+	}
+	userID, chatID, messageID := query.From.ID, query.Message.Chat.ID, query.Message.MessageID
+
+	switch action {
+	case "apply":
+		batch, changes, err := s.GetRecategorizationBatch(userID, uint(id))
+		if err != nil {
+			log.Printf("Ошибка при получении пакета перекатегоризации %d: %v", id, err)
+			answerCallback(bot, query, "Пакет изменений не найден.")
+			return
+		}
+		updated, err := s.ApplyRecategorizationBatch(userID, batch.ID)
+		if err != nil {
+			log.Printf("Ошибка при применении пакета перекатегоризации %d: %v", id, err)
+			answerCallback(bot, query, "Не удалось применить изменения.")
+			return
+		}
+		// Новые категории запоминаем, чтобы новые траты с такими же комментариями получали их же
+		for _, change := range changes {
+			if err := s.SaveCachedClassification(userID, change.Comment, change.NewCategory, "", 1); err != nil {
+				log.Printf("Ошибка при сохранении категории в кеш: %v", err)
+			}
+		}
+		log.Printf("Пакет перекатегоризации %d применён: изменено %d транзакций", id, updated)
+		answerCallback(bot, query, "Изменения применены")
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Отменить изменения", recategorizeData("undo", batch.ID)),
+		))
+		editText(bot, chatID, messageID, fmt.Sprintf("✅ Категории изменены у %d транзакций.\nОтменить можно кнопкой ниже или командой /recategorize undo.", updated), &keyboard)
+	case "cancel":
+		if err := s.DiscardRecategorizationBatch(userID, uint(id)); err != nil {
+			log.Printf("Ошибка при отказе от пакета перекатегоризации %d: %v", id, err)
+			answerCallback(bot, query, "Пакет изменений уже обработан.")
+			return
+		}
+		answerCallback(bot, query, "Отменено")
+		editText(bot, chatID, messageID, "Перекатегоризация отменена, категории не изменились.", nil)
+	case "undo":
+		updated, err := s.UndoRecategorizationBatch(userID, uint(id))
+		if err != nil {
+			log.Printf("Ошибка при отмене пакета перекатегоризации %d: %v", id, err)
+			answerCallback(bot, query, "Эти изменения уже отменены.")
+			return
+		}
+		answerCallback(bot, query, "Изменения отменены")
+		editText(bot, chatID, messageID, fmt.Sprintf("↩️ Изменения отменены, прежние категории возвращены %d транзакциям.", updated), nil)
+	default:
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+	}
+}
+
+// undoLastRecategorization отменяет последний применённый пакет изменений пользователя
+func undoLastRecategorization(bot *tgbotapi.BotAPI, chatID, userID int64, s *storage.Storage) {
+	batch, err := s.GetLastAppliedRecategorizationBatch(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		sendText(bot, chatID, "Нет применённых изменений, которые можно отменить.")
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске пакета перекатегоризации: %v", err)
+		sendText(bot, chatID, "Ошибка при отмене изменений.")
+		return
+	}
+	updated, err := s.UndoRecategorizationBatch(userID, batch.ID)
+	if err != nil {
+		log.Printf("Ошибка при отмене пакета перекатегоризации %d: %v", batch.ID, err)
+		sendText(bot, chatID, "Ошибка при отмене изменений.")
+		return
+	}
+	sendText(bot, chatID, fmt.Sprintf("↩️ Изменения от %s отменены, прежние категории возвращены %d транзакциям.", batch.AppliedAt.Format("02.01.2006 15:04"), updated))
+}
+
+// recategorizeData формирует данные кнопки перекатегоризации
+func recategorizeData(action string, batchID uint) string {
+	return fmt.Sprintf("%s:%s:%d", CallbackRecategorize, action, batchID)
+}
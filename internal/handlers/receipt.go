@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"money-bot/internal/receipt"
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxReceiptImageSize - максимальный размер изображения чека
+const maxReceiptImageSize = 10 << 20
+
+// receiptProviderTimeout - сколько ждать расшифровку чека, прежде чем сохранить его одной суммой
+const receiptProviderTimeout = 30 * time.Second
+
+// receiptClassifyWorkers - сколько позиций чека классифицируется одновременно
+const receiptClassifyWorkers = 4
+
+// IsReceiptImage сообщает, содержит ли сообщение изображение, на котором можно искать QR-код чека
+func IsReceiptImage(message *tgbotapi.Message) bool {
+	if len(message.Photo) > 0 {
+		return true
+	}
+	return message.Document != nil && strings.HasPrefix(message.Document.MimeType, "image/")
+}
+
+// HandleReceiptPhoto распознаёт QR-код чека на фото и сохраняет расход
+func HandleReceiptPhoto(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, provider receipt.Provider, categories []string) {
+	log.Printf("Обработка фото чека от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+
+	// Фото без сжатия (документом) распознаётся лучше, но принимаем и обычные фото.
+	// Из размеров фото берём самый большой - он последний в списке.
+	var fileID string
+	if len(update.Message.Photo) > 0 {
+		fileID = update.Message.Photo[len(update.Message.Photo)-1].FileID
+	} else {
+		fileID = update.Message.Document.FileID
+	}
+
+	data, err := DownloadFile(bot, fileID, maxReceiptImageSize)
+	if err != nil {
+		log.Printf("Ошибка при скачивании фото чека: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Не удалось скачать фото.")
+		return
+	}
+
+	payload, err := receipt.DecodeImage(data)
+	if err != nil {
+		log.Printf("Не удалось распознать QR-код: %v", err)
+		// В группе фото без чека - обычная переписка участников
+		if IsGroupChat(update.Message) {
+			return
+		}
+		sendText(bot, update.Message.Chat.ID, "Не удалось найти QR-код на фото. Попробуйте сфотографировать чек ближе или пришлите текст из QR-кода.")
+		return
+	}
+	log.Printf("Распознан QR-код: %s", payload)
+
+	HandleReceiptText(bot, update, s, payload, provider, categories)
+}
+
+// HandleReceiptText сохраняет расход по содержимому QR-кода чека.
+// Если задан провайдер расшифровки, покупка разбивается на позиции, и каждая
+// позиция сохраняется отдельной транзакцией со своей категорией.
+func HandleReceiptText(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, payload string, provider receipt.Provider, categories []string) {
+	qr, err := receipt.ParseQR(payload)
+	if err != nil {
+		log.Printf("Ошибка разбора QR-кода чека: %v", err)
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("QR-код не похож на кассовый чек: %v.", err))
+		return
+	}
+	if qr.Operation != receipt.OperationIncome {
+		log.Printf("Чек с типом операции %d не поддерживается", qr.Operation)
+		sendText(bot, update.Message.Chat.ID, "Поддерживаются только чеки покупок (приход).")
+		return
+	}
+	// В группе чек записывается в общую книгу, если у автора есть право её пополнять
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	rec := &storage.Receipt{
+		UserID:   update.Message.From.ID,
+		LedgerID: scope.LedgerID,
+		FN:       qr.FN,
+		FD:       qr.FD,
+		FP:       qr.FP,
+		Total:    qr.Sum,
+		IssuedAt: qr.Time,
+		Raw:      qr.Raw,
+	}
+	// Повторный чек отсекаем до расшифровки, чтобы не тратить запросы к сервису и AI
+	if exists, err := s.HasReceipt(rec); err != nil {
+		log.Printf("Ошибка при проверке повторной загрузки чека: %v", err)
+	} else if exists {
+		log.Printf("Чек ФН %s ФД %s уже загружен в книгу %d пользователя %d", qr.FN, qr.FD, scope.LedgerID, update.Message.From.ID)
+		sendText(bot, update.Message.Chat.ID, "Этот чек уже был загружен раньше.")
+		return
+	}
+	transactions := []*storage.Transaction{{
+		UserID:          update.Message.From.ID,
+		Amount:          -qr.Sum,
+		Comment:         fmt.Sprintf("Чек от %s", qr.Time.Format("02.01.2006 15:04")),
+		Category:        "Прочее",
+		TransactionDate: qr.Time,
+	}}
+	var pending []*storage.Transaction // Позиции, которые не удалось классифицировать
+	reply := func(text string) { sendText(bot, update.Message.Chat.ID, text) }
+	if provider != nil {
+		// Расшифровка и классификация позиций занимают заметное время, поэтому сразу
+		// показываем, что чек принят, а итог пишем в то же сообщение
+		if progress, err := bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "🧾 Разбираю чек по позициям…")); err != nil {
+			log.Printf("Ошибка при отправке сообщения о разборе чека: %v", err)
+		} else {
+			reply = func(text string) { editText(bot, progress.Chat.ID, progress.MessageID, text, nil) }
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), receiptProviderTimeout)
+		details, err := provider.FetchReceipt(ctx, qr)
+		cancel()
+		if err != nil {
+			// Без расшифровки чек всё равно сохраняется одной суммой
+			log.Printf("Не удалось получить расшифровку чека, сохраняем одной суммой: %v", err)
+		} else {
+			log.Printf("Получена расшифровка чека: %d позиций", len(details.Items))
+			transactions, pending = itemizeReceipt(s, update.Message.From.ID, qr, details, categories)
+		}
+	}
+
+	for _, tr := range transactions {
+		tr.LedgerID = scope.LedgerID
+	}
+	if err := s.SaveReceipt(rec, transactions); err != nil {
+		if errors.Is(err, storage.ErrDuplicateReceipt) {
+			log.Printf("Чек ФН %s ФД %s уже загружен в книгу %d пользователя %d", qr.FN, qr.FD, scope.LedgerID, update.Message.From.ID)
+			reply("Этот чек уже был загружен раньше.")
+			return
+		}
+		log.Printf("Ошибка при сохранении чека: %v", err)
+		reply("Произошла ошибка при сохранении чека. Попробуйте еще раз.")
+		return
+	}
+
+	log.Printf("Чек сохранён. ID чека: %d, транзакций: %d", rec.ID, len(transactions))
+	for _, tr := range pending {
+		if err := s.AddPendingClassification(tr.ID, tr.UserID, update.Message.Chat.ID); err != nil {
+			log.Printf("Ошибка при постановке транзакции %d в очередь классификации: %v", tr.ID, err)
+		}
+	}
+	text := receiptSummary(qr, transactions)
+	if len(pending) > 0 {
+		text += fmt.Sprintf("\n\n⏳ Категории для %d позиций определю позже, когда AI станет доступен.", len(pending))
+	}
+	reply(text)
+}
+
+// itemizeReceipt превращает позиции чека в отдельные расходы, классифицируя каждую позицию.
+// Если сумма позиций меньше итога чека (округление), разница сохраняется отдельной строкой,
+// а если больше (скидка на весь чек), расходы по позициям уменьшаются: общая сумма
+// расходов всегда совпадает с чеком.
+// Вторым значением возвращаются позиции, которые не удалось классифицировать.
+func itemizeReceipt(s *storage.Storage, userID int64, qr *receipt.QR, details *receipt.Details, categories []string) ([]*storage.Transaction, []*storage.Transaction) {
+	names := make([]string, 0, len(details.Items))
+	for _, item := range details.Items {
+		names = append(names, item.Name)
+	}
+	classified := classifyReceiptItems(s, userID, names, categories)
+
+	transactions := make([]*storage.Transaction, 0, len(details.Items)+1)
+	var pending []*storage.Transaction
+	var itemsTotal float64
+	for _, item := range details.Items {
+		category, ok := classified[storage.NormalizeComment(item.Name)]
+		if !ok {
+			category = "Прочее"
+		}
+		transaction := &storage.Transaction{
+			UserID:          userID,
+			Amount:          -item.Sum,
+			Comment:         item.Name,
+			Merchant:        details.Seller,
+			Category:        category,
+			TransactionDate: qr.Time,
+		}
+		transactions = append(transactions, transaction)
+		if !ok {
+			pending = append(pending, transaction)
+		}
+		itemsTotal += item.Sum
+	}
+
+	diff := math.Round((qr.Sum-itemsTotal)*100) / 100
+	switch {
+	case diff > 0:
+		log.Printf("Сумма позиций %.2f меньше итога чека %.2f, добавляем корректировку %.2f", itemsTotal, qr.Sum, diff)
+		transactions = append(transactions, &storage.Transaction{
+			UserID:          userID,
+			Amount:          -diff,
+			Comment:         "Скидки и округление по чеку",
+			Category:        "Прочее",
+			TransactionDate: qr.Time,
+		})
+	case diff < 0:
+		// Корректировка с плюсом стала бы доходом, поэтому скидку распределяем по позициям
+		log.Printf("Сумма позиций %.2f больше итога чека %.2f, распределяем скидку %.2f по позициям", itemsTotal, qr.Sum, -diff)
+		applyReceiptDiscount(transactions, itemsTotal, qr.Sum)
+	}
+	return transactions, pending
+}
+
+// classifyReceiptItems определяет категории позиций чека. Одинаковые названия классифицируются
+// один раз, а разные - параллельно, но не больше receiptClassifyWorkers запросов сразу.
+// На весь чек отводится один aiTimeout, чтобы длинный чек не задерживал очередь сообщений чата.
+// Результат - категории по нормализованным названиям; позиций с ошибкой классификации в нём нет.
+func classifyReceiptItems(s *storage.Storage, userID int64, names []string, categories []string) map[string]string {
+	unique := make(map[string]string) // нормализованное название -> исходное
+	for _, name := range names {
+		key := storage.NormalizeComment(name)
+		if _, ok := unique[key]; !ok {
+			unique[key] = name
+		}
+	}
+	log.Printf("Классификация позиций чека: %d позиций, %d уникальных названий", len(names), len(unique))
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		result  = make(map[string]string, len(unique))
+		workers = make(chan struct{}, receiptClassifyWorkers)
+	)
+	for key, name := range unique {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			classification, err := ClassifyComment(ctx, s, userID, name, categories)
+			if err != nil {
+				log.Printf("Ошибка при классификации позиции чека '%s': %v", name, err)
+				return
+			}
+			mu.Lock()
+			result[key] = classification.Category
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// applyReceiptDiscount уменьшает расходы по позициям пропорционально их стоимости так,
+// чтобы сумма позиций itemsTotal совпала с итогом чека total. Остаток от округления
+// до копеек достаётся самой дорогой позиции, чтобы ни один расход не стал доходом.
+func applyReceiptDiscount(transactions []*storage.Transaction, itemsTotal, total float64) {
+	var (
+		discounted float64
+		largest    *storage.Transaction
+	)
+	for _, transaction := range transactions {
+		transaction.Amount = math.Round(transaction.Amount*total/itemsTotal*100) / 100
+		discounted += transaction.Amount
+		if largest == nil || transaction.Amount < largest.Amount {
+			largest = transaction
+		}
+	}
+	if largest != nil {
+		largest.Amount = math.Round((largest.Amount-total-discounted)*100) / 100
+	}
+}
+
+// receiptSummary формирует подтверждение о сохранённом чеке
+func receiptSummary(qr *receipt.QR, transactions []*storage.Transaction) string {
+	var text strings.Builder
+	text.WriteString("✅ Расход по чеку сохранён!\n")
+	text.WriteString(fmt.Sprintf("Сумма: %.2f\nДата: %s\n", -qr.Sum, qr.Time.Format("02.01.2006 15:04")))
+	if len(transactions) == 1 {
+		text.WriteString("Категория: " + transactions[0].Category)
+		return text.String()
+	}
+
+	// Длинные чеки не выводим целиком, чтобы не упереться в лимит длины сообщения
+	const maxLines = 30
+	text.WriteString("\nПозиции:")
+	for i, tr := range transactions {
+		if i == maxLines {
+			text.WriteString(fmt.Sprintf("\n… и ещё %d", len(transactions)-maxLines))
+			break
+		}
+		text.WriteString(fmt.Sprintf("\n%.2f %s (%s)", tr.Amount, tr.Comment, tr.Category))
+	}
+	return text.String()
+}
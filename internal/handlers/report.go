@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,36 +12,37 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// HandleReport генерирует и отправляет отчет по транзакциям за определенный период
-func HandleReport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, period string) {
-	log.Printf("Начало обработки отчета за период '%s' для пользователя %s (ID: %d)", period, update.Message.From.UserName, update.Message.From.ID)
-	var (
-		from, to    time.Time
-		reportTitle string
-	)
-
-	switch period {
-	case "today":
-		from, to = GetStartAndEndOfDay()
-		reportTitle = "Итоги за сегодня"
-	case "week":
-		from, to = GetStartAndEndOfWeek()
-		reportTitle = "Итоги за неделю"
-	case "month":
-		from, to = GetStartAndEndOfMonth()
-		reportTitle = "Итоги за месяц"
-	default:
-		log.Printf("Неизвестный период для отчета: %s", period)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Неизвестный период для отчета.")
+// reportTitles - заголовки отчётов для периодов из общей грамматики фильтров
+var reportTitles = map[string]string{
+	"today": "Итоги за сегодня",
+	"week":  "Итоги за неделю",
+	"month": "Итоги за месяц",
+	"year":  "Итоги за год",
+}
+
+// HandleReport генерирует и отправляет отчет по транзакциям, отобранным фильтром.
+// Аргументы разбираются общей грамматикой фильтров: /report month #командировка
+func HandleReport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, args string, categories []string) {
+	log.Printf("Начало обработки отчета '%s' для пользователя %s (ID: %d)", args, update.Message.From.UserName, update.Message.From.ID)
+	filter, err := ParseFilter(args, categories)
+	if err != nil {
+		log.Printf("Ошибка разбора фильтра отчета '%s': %v", args, err)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Не удалось разобрать фильтр: %v.\nПример: /report month #командировка", err))
 		if _, err := bot.Send(msg); err != nil {
-			log.Printf("Ошибка при отправке сообщения о неизвестном периоде: %v", err)
+			log.Printf("Ошибка при отправке сообщения об ошибке фильтра: %v", err)
 		}
 		return
 	}
-	log.Printf("Рассчитан временной интервал для отчета: с %s по %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	reportTitle := reportTitleFor(filter)
+	log.Printf("Рассчитан временной интервал для отчета: с %s по %s", filter.From.Format(time.RFC3339), filter.To.Format(time.RFC3339))
+
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
 
-	log.Printf("Запрос транзакций из БД для UserID: %d", update.Message.From.ID)
-	transactions, err := s.GetTransactionsByPeriod(update.Message.From.ID, from, to)
+	log.Printf("Запрос транзакций из БД для %+v", scope)
+	transactions, err := s.GetTransactionsByFilter(scope, filter.TransactionFilter)
 	if err != nil {
 		log.Printf("Ошибка при получении транзакций из БД: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при получении данных.")
@@ -61,25 +63,47 @@ func HandleReport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 	log.Printf("Найдено %d транзакций. Начинаем формирование отчета.", len(transactions))
 
 	var responseText strings.Builder
-	// Заголовки отчетов не содержат спецсимволов, поэтому можно не экранировать.
+	// Заголовок может содержать даты и теги, поэтому экранируется.
 	// Звёздочки для жирного шрифта — это часть нашей разметки.
-	responseText.WriteString(fmt.Sprintf("📊 *%s* 📊\n\n", reportTitle))
+	responseText.WriteString(fmt.Sprintf("📊 *%s* 📊\n\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, reportTitle)))
 
 	var totalIncome, totalExpense float64
+	incomeBySource := make(map[string]float64)
+	// Итоги по участникам нужны только в общем бюджете группы
+	byMember := make(map[int64]*memberTotal)
 	for _, tr := range transactions {
-		if tr.Amount > 0 {
-			totalIncome += tr.Amount
+		member, ok := byMember[tr.UserID]
+		if !ok {
+			member = &memberTotal{}
+			byMember[tr.UserID] = member
+		}
+		if tr.Amount > 0 && tr.RefundOfID == nil {
+			member.income += tr.Amount
 		} else {
-			totalExpense += tr.Amount
+			member.expense += tr.Amount
 		}
+
 		sign := "➕"
-		if tr.Amount < 0 {
+		switch {
+		case tr.RefundOfID != nil:
+			// Возврат уменьшает расходы своей категории и не считается доходом
+			totalExpense += tr.Amount
+			sign = "↩️"
+		case tr.Amount > 0:
+			totalIncome += tr.Amount
+			incomeBySource[tr.Category] += tr.Amount
+		default:
+			totalExpense += tr.Amount
 			sign = "➖"
 		}
 		// Суммы в блоках `code` (обратные кавычки), их экранировать не нужно.
 		amountStr := fmt.Sprintf("%.2f", tr.Amount)
 		// Комментарий может содержать спецсимволы, его нужно экранировать.
-		escapedComment := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr.Comment)
+		comment := tr.Comment
+		if len(tr.Tags) > 0 {
+			comment = strings.TrimSpace(comment + " " + FormatTags(&tr))
+		}
+		escapedComment := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, comment)
 		// Добавляем категорию в отчет, чтобы было нагляднее
 		escapedCategory := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr.Category)
 		responseText.WriteString(fmt.Sprintf("%s `%s` руб\\. \\| %s \\(*%s*\\)\n", sign, amountStr, escapedComment, escapedCategory))
@@ -87,16 +111,39 @@ func HandleReport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 
 	responseText.WriteString("\n\\-\\-\\-\n")
 	responseText.WriteString(fmt.Sprintf("💰 *Доходы*: `%.2f` руб\\.\n", totalIncome))
+	// Разбивка доходов по источникам имеет смысл, только если источников несколько
+	if len(incomeBySource) > 1 {
+		sources := make([]string, 0, len(incomeBySource))
+		for source := range incomeBySource {
+			sources = append(sources, source)
+		}
+		sort.Slice(sources, func(i, j int) bool { return incomeBySource[sources[i]] > incomeBySource[sources[j]] })
+		for _, source := range sources {
+			responseText.WriteString(fmt.Sprintf("    • %s: `%.2f` руб\\.\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, source), incomeBySource[source]))
+		}
+	}
 	responseText.WriteString(fmt.Sprintf("💸 *Расходы*: `%.2f` руб\\.\n", totalExpense))
 	responseText.WriteString(fmt.Sprintf("📈 *Баланс*: `%.2f` руб\\.", totalIncome+totalExpense))
+	if scope.IsLedger() {
+		writeMemberTotals(&responseText, s, scope.LedgerID, byMember)
+	}
 
 	// Получаем и добавляем общий баланс за все время для контекста
-	overallBalance, err := s.GetAllTimeSummary(update.Message.From.ID)
+	overallBalance, err := s.GetAllTimeSummary(scope)
 	if err != nil {
 		log.Printf("Ошибка при получении общего баланса для UserID %d: %v", update.Message.From.ID, err)
 		// Не прерываем отчет, просто не показываем общий баланс
 	} else {
 		responseText.WriteString(fmt.Sprintf("\n\n🏦 *Общий баланс*: `%.2f` руб\\.", overallBalance))
+		// Долги не входят в доходы и расходы и не меняют баланс, но меняют деньги на руках
+		if !scope.IsLedger() {
+			lent, borrowed, err := s.GetLoanTotals(scope.UserID)
+			if err != nil {
+				log.Printf("Ошибка при получении долгов для UserID %d: %v", scope.UserID, err)
+			} else if lent != 0 || borrowed != 0 {
+				responseText.WriteString(fmt.Sprintf("\n💵 *На руках с учётом долгов*: `%.2f` руб\\.", overallBalance-lent+borrowed))
+			}
+		}
 	}
 
 	log.Printf("Отчет сформирован. Итоги: Доход=%.2f, Расход=%.2f, Баланс=%.2f", totalIncome, totalExpense, totalIncome+totalExpense)
@@ -107,3 +154,40 @@ func HandleReport(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Stora
 		log.Printf("Ошибка при отправке отчета: %v", err)
 	}
 }
+
+// reportTitleFor формирует заголовок отчёта: для периода без дополнительных условий -
+// привычное "Итоги за месяц", иначе - описание фильтра
+func reportTitleFor(filter Filter) string {
+	title, ok := reportTitles[filter.Period]
+	if ok && filter.Description() == filter.Period {
+		return title
+	}
+	if filter.IsEmpty() {
+		return "Итоги за всё время"
+	}
+	return "Отчёт: " + filter.Description()
+}
+
+// memberTotal - доходы и расходы одного участника общего бюджета за период
+type memberTotal struct {
+	income  float64
+	expense float64
+}
+
+// writeMemberTotals добавляет к отчёту итоги по участникам общей книги
+func writeMemberTotals(text *strings.Builder, s *storage.Storage, ledgerID uint, byMember map[int64]*memberTotal) {
+	names := ledgerMemberNames(s, ledgerID)
+
+	userIDs := make([]int64, 0, len(byMember))
+	for userID := range byMember {
+		userIDs = append(userIDs, userID)
+	}
+	// Сначала те, кто потратил больше
+	sort.Slice(userIDs, func(i, j int) bool { return byMember[userIDs[i]].expense < byMember[userIDs[j]].expense })
+
+	text.WriteString("\n\n👥 *По участникам*:")
+	for _, userID := range userIDs {
+		total := byMember[userID]
+		text.WriteString(fmt.Sprintf("\n    • %s: \\+`%.2f` / `%.2f` руб\\.", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, names.of(userID)), total.income, total.expense))
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// shareRe разбирает упоминание участника в расходе: @anna, @anna=1200 или @anna=40%
+var shareRe = regexp.MustCompile(`^@(\w+)(?:[=:](\d+(?:[.,]\d+)?)(%)?)?$`)
+
+// SplitShare - участник разделённого расхода и его доля, указанная в сообщении.
+// Если ни сумма, ни процент не указаны, участник делит остаток поровну с остальными.
+type SplitShare struct {
+	Name     string  // Упоминание участника: @username
+	Amount   float64 // Фиксированная доля в рублях
+	Percent  float64 // Доля в процентах от суммы расхода
+	Explicit bool    // Доля указана явно, в том числе нулевая: @anna=0
+}
+
+// ParseSplit отделяет упоминания участников от комментария к расходу:
+// "ужин @anna @oleg=1000" превращается в комментарий "ужин" и две доли.
+func ParseSplit(comment string) (string, []SplitShare) {
+	var words []string
+	var shares []SplitShare
+	for _, word := range strings.Fields(comment) {
+		matches := shareRe.FindStringSubmatch(strings.TrimRight(word, ",;"))
+		if matches == nil {
+			words = append(words, word)
+			continue
+		}
+		share := SplitShare{Name: "@" + matches[1]}
+		if matches[2] != "" {
+			share.Explicit = true
+			value, _ := strconv.ParseFloat(strings.Replace(matches[2], ",", ".", 1), 64)
+			if matches[3] != "" {
+				share.Percent = value
+			} else {
+				share.Amount = value
+			}
+		}
+		shares = append(shares, share)
+	}
+	return strings.Join(words, " "), shares
+}
+
+// ResolveSplit распределяет расход total между плательщиком и упомянутыми участниками книги.
+// Сначала вычитаются фиксированные и процентные доли, остаток делится поровну между
+// участниками без явной доли; плательщик делит остаток, если сам не упомянут с долей.
+// Ошибка содержит понятное пользователю объяснение.
+func ResolveSplit(s *storage.Storage, ledgerID uint, payerID int64, total float64, shares []SplitShare) ([]storage.Split, error) {
+	members, err := s.GetLedgerMembers(ledgerID)
+	if err != nil {
+		log.Printf("Ошибка при получении участников книги %d для разделения расхода: %v", ledgerID, err)
+		return nil, errors.New("не удалось получить список участников")
+	}
+	byName := make(map[string]int64, len(members))
+	for _, member := range members {
+		byName[strings.ToLower(member.Name)] = member.UserID
+	}
+
+	totalKopecks := int64(math.Round(total * 100))
+	seen := make(map[int64]bool)
+	var splits []storage.Split
+	var equal []int // Индексы долей, которые делят остаток поровну
+	var fixed int64
+	for _, share := range shares {
+		userID, ok := byName[strings.ToLower(share.Name)]
+		if !ok {
+			return nil, fmt.Errorf("%s не участник общего бюджета", share.Name)
+		}
+		if seen[userID] {
+			return nil, fmt.Errorf("%s упомянут дважды", share.Name)
+		}
+		seen[userID] = true
+
+		var amount int64
+		switch {
+		case !share.Explicit:
+			equal = append(equal, len(splits))
+		case share.Percent > 0:
+			amount = int64(math.Round(float64(totalKopecks) * share.Percent / 100))
+		default:
+			// Явная нулевая доля исключает участника из расхода
+			amount = int64(math.Round(share.Amount * 100))
+		}
+		fixed += amount
+		splits = append(splits, storage.Split{LedgerID: ledgerID, UserID: userID, Amount: float64(amount)})
+	}
+	if !seen[payerID] {
+		equal = append(equal, len(splits))
+		splits = append(splits, storage.Split{LedgerID: ledgerID, UserID: payerID})
+	}
+
+	if fixed > totalKopecks {
+		return nil, fmt.Errorf("доли в сумме %.2f больше расхода %.2f", float64(fixed)/100, total)
+	}
+	remainder := totalKopecks - fixed
+	if len(equal) == 0 && remainder != 0 {
+		return nil, fmt.Errorf("доли в сумме %.2f не совпадают с расходом %.2f", float64(fixed)/100, total)
+	}
+	// Копейки, которые не делятся поровну, достаются первым участникам
+	for i, index := range equal {
+		amount := remainder / int64(len(equal))
+		if int64(i) < remainder%int64(len(equal)) {
+			amount++
+		}
+		splits[index].Amount = float64(amount)
+	}
+
+	result := splits[:0]
+	for _, split := range splits {
+		if split.Amount == 0 {
+			continue
+		}
+		split.Amount /= 100
+		result = append(result, split)
+	}
+	return result, nil
+}
+
+// SplitNote описывает, как расход разделён между участниками
+func SplitNote(s *storage.Storage, ledgerID uint, splits []storage.Split) string {
+	names := ledgerMemberNames(s, ledgerID)
+	parts := make([]string, 0, len(splits))
+	for _, split := range splits {
+		parts = append(parts, fmt.Sprintf("%s %.2f", names.of(split.UserID), split.Amount))
+	}
+	return "👥 Разделено: " + strings.Join(parts, ", ")
+}
+
+// HandleDebts показывает, кто кому сколько должен в общем бюджете группы,
+// и короткий план переводов, чтобы рассчитаться
+func HandleDebts(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /debts от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	if !GroupOnly(bot, update.Message) {
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	balances, err := s.GetLedgerBalances(scope.LedgerID)
+	if err != nil {
+		log.Printf("Ошибка при расчёте долгов книги %d: %v", scope.LedgerID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при расчёте долгов.")
+		return
+	}
+	if len(balances) == 0 {
+		sendText(bot, update.Message.Chat.ID, "🤝 Все в расчёте.")
+		return
+	}
+
+	names := ledgerMemberNames(s, scope.LedgerID)
+	var text strings.Builder
+	text.WriteString("💳 Балансы:\n")
+	for _, userID := range sortedByBalance(balances) {
+		balance := float64(balances[userID]) / 100
+		if balance > 0 {
+			text.WriteString(fmt.Sprintf("• %s: должны %.2f\n", names.of(userID), balance))
+		} else {
+			text.WriteString(fmt.Sprintf("• %s: должен %.2f\n", names.of(userID), -balance))
+		}
+	}
+	text.WriteString("\n🔁 Чтобы рассчитаться:\n")
+	for _, transfer := range storage.SimplifyDebts(balances) {
+		text.WriteString(fmt.Sprintf("• %s → %s: %.2f\n", names.of(transfer.From), names.of(transfer.To), transfer.Amount))
+	}
+	text.WriteString("\nПосле перевода отметьте его: /settle @username сумма")
+	sendText(bot, update.Message.Chat.ID, text.String())
+}
+
+// HandleSettle записывает, что автор команды вернул деньги участнику:
+// /settle @oleg 500. Без суммы записывается перевод из плана погашения /debts.
+func HandleSettle(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /settle от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, update.Message.From.ID, update.Message.CommandArguments())
+	if !GroupOnly(bot, update.Message) {
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+	fromID := update.Message.From.ID
+
+	toID, name, ok := targetMember(update.Message, s, scope.LedgerID)
+	if !ok {
+		sendText(bot, update.Message.Chat.ID, "Укажите, кому вы вернули деньги: /settle @username сумма.")
+		return
+	}
+	if toID == fromID {
+		sendText(bot, update.Message.Chat.ID, "Нельзя вернуть долг самому себе.")
+		return
+	}
+
+	var amount float64
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		if value, err := strconv.ParseFloat(strings.Replace(arg, ",", ".", 1), 64); err == nil {
+			amount = value
+		}
+	}
+	if amount == 0 {
+		balances, err := s.GetLedgerBalances(scope.LedgerID)
+		if err != nil {
+			log.Printf("Ошибка при расчёте долгов книги %d: %v", scope.LedgerID, err)
+			sendText(bot, update.Message.Chat.ID, "Ошибка при расчёте долгов.")
+			return
+		}
+		for _, transfer := range storage.SimplifyDebts(balances) {
+			if transfer.From == fromID && transfer.To == toID {
+				amount = transfer.Amount
+			}
+		}
+		if amount == 0 {
+			sendText(bot, update.Message.Chat.ID, fmt.Sprintf("По плану погашения вы ничего не должны %s. Укажите сумму: /settle %s 500.", name, name))
+			return
+		}
+	}
+	if amount < 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		sendText(bot, update.Message.Chat.ID, "Сумма должна быть положительным числом.")
+		return
+	}
+
+	settlement := &storage.Settlement{LedgerID: scope.LedgerID, FromUserID: fromID, ToUserID: toID, Amount: amount}
+	if err := s.SaveSettlement(settlement); err != nil {
+		log.Printf("Ошибка при записи перевода в книге %d: %v", scope.LedgerID, err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при записи перевода.")
+		return
+	}
+	log.Printf("Записан перевод %.2f от %d к %d в книге %d", amount, fromID, toID, scope.LedgerID)
+	sendText(bot, update.Message.Chat.ID, fmt.Sprintf("✅ Записано: %s вернул %s %.2f. Текущие долги: /debts", MemberName(update.Message.From), name, amount))
+}
+
+// sortedByBalance упорядочивает участников от тех, кому должны больше всего, к главным должникам
+func sortedByBalance(balances map[int64]int64) []int64 {
+	userIDs := make([]int64, 0, len(balances))
+	for userID := range balances {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return balances[userIDs[i]] > balances[userIDs[j]] })
+	return userIDs
+}
@@ -15,15 +15,47 @@ func HandleStart(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 	text := "Привет\\! Я твой бот\\-помощник для учёта финансов\\.\n\n" +
 		"*Основные команды:*\n" +
 		"`1000`  \\- записать доход\n" +
-		"`-500 кофе`  \\- записать расход с комментарием\n\n" +
+		"`-500 кофе`  \\- записать расход с комментарием\n" +
+		"`-1200 такси #командировка`  \\- расход с тегом\n\n" +
 		"*Отчёты:*\n" +
 		"/today  \\- итоги за сегодня\n" +
 		"/week  \\- итоги за неделю\n" +
 		"/month  \\- итоги за месяц\n" +
-		"/export  \\- выгрузить всё в CSV\n\n" +
+		"/report month \\#командировка  \\- отчёт по фильтру\n" +
+		"/tags  \\- суммы по тегам\n" +
+		"/find сантехник  \\- поиск по комментариям\n" +
+		"/ask сколько я потратил на такси?  \\- вопрос о тратах\n" +
+		"/insights  \\- AI\\-обзор трат за месяц\n" +
+		"/export  \\- выгрузить всё в CSV\n" +
+		"/export month expenses  \\- выгрузить с фильтром\n\n" +
 		"*Управление данными:*\n" +
 		"/clearlast \\- удалить последнюю запись\n" +
-		"/cleartoday \\- удалить все записи за сегодня"
+		"/cleartoday \\- удалить все записи за сегодня\n" +
+		"/delete \\- удалить запись \\(ответом на сообщение о ней\\)\n" +
+		"/undo \\- вернуть последнее удаление\n" +
+		"/trash \\- корзина удалённых записей\n" +
+		"/history \\- история изменений записи \\(ответом на сообщение о ней\\)\n" +
+		"/audit \\- журнал всех изменений в CSV\n" +
+		"/sources \\- категории доходов\n" +
+		"/recategorize year category\\=Прочее \\- заново определить категории\n" +
+		"/backup \\- резервная копия в JSON\n" +
+		"/restore \\- восстановить из резервной копии\n\n" +
+		"*Цели накоплений:*\n" +
+		"/goal Отпуск 150000 2026\\-07\\-01 \\- новая цель\n" +
+		"`-10000 #отпуск`  \\- отложить на цель\n" +
+		"/goal \\- прогресс по целям\n\n" +
+		"*Долги:*\n" +
+		"/lend Иван 5000 до 2026\\-12\\-01 \\- дал в долг\n" +
+		"/borrow Пётр 3000 \\- взял в долг\n" +
+		"/repay Иван 2000 \\- отметить погашение\n" +
+		"/loans \\- непогашенные долги\n\n" +
+		"*Общий бюджет в группе:*\n" +
+		"/members \\- участники и роли\n" +
+		"/invite \\- добавить участника \\(ответом на его сообщение\\)\n" +
+		"/remove \\- исключить участника\n" +
+		"`-3000 ужин @anna @oleg`  \\- разделить расход\n" +
+		"/debts \\- кто кому должен\n" +
+		"/settle @anna 500 \\- отметить возврат долга"
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
 	msg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// tagRe находит теги в комментарии: #командировка, #новая_машина
+var tagRe = regexp.MustCompile(`#[\p{L}\p{N}_]+`)
+
+// ParseTags отделяет теги от комментария: "такси #командировка #проектX"
+// превращается в комментарий "такси" и теги "командировка" и "проектx"
+func ParseTags(comment string) (string, []storage.Tag) {
+	names := tagRe.FindAllString(comment, -1)
+	if len(names) == 0 {
+		return comment, nil
+	}
+	clean := strings.Join(strings.Fields(tagRe.ReplaceAllString(comment, "")), " ")
+	return clean, storage.TagsFromNames(names)
+}
+
+// formatTags записывает теги через пробел: "#командировка #проектx"
+func formatTags(names []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = "#" + name
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatTags записывает теги транзакции через пробел для сообщений пользователю
+func FormatTags(transaction *storage.Transaction) string {
+	return formatTags(transaction.TagNames())
+}
+
+// tagTotal - итоги по одному тегу
+type tagTotal struct {
+	name    string
+	income  float64
+	expense float64
+	count   int
+}
+
+// HandleTags показывает суммы по тегам. Аргументы разбираются общей грамматикой фильтров:
+// /tags month, /tags 2026-01-01 2026-03-31 expenses
+func HandleTags(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string) {
+	log.Printf("Обработка команды /tags от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, update.Message.From.ID, update.Message.CommandArguments())
+	filter, err := ParseFilter(update.Message.CommandArguments(), categories)
+	if err != nil {
+		sendText(bot, update.Message.Chat.ID, fmt.Sprintf("Не удалось разобрать фильтр: %v.\nПример: /tags month expenses", err))
+		return
+	}
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+
+	transactions, err := s.GetTransactionsByFilter(scope, filter.TransactionFilter)
+	if err != nil {
+		log.Printf("Ошибка при получении транзакций для итогов по тегам: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при получении данных.")
+		return
+	}
+	totals := make(map[string]*tagTotal)
+	for _, tr := range transactions {
+		for _, tag := range tr.Tags {
+			total, ok := totals[tag.Name]
+			if !ok {
+				total = &tagTotal{name: tag.Name}
+				totals[tag.Name] = total
+			}
+			if tr.Amount > 0 && tr.RefundOfID == nil {
+				total.income += tr.Amount
+			} else {
+				total.expense += tr.Amount
+			}
+			total.count++
+		}
+	}
+	if len(totals) == 0 {
+		sendText(bot, update.Message.Chat.ID, "Транзакций с тегами не найдено. Добавьте тег к сумме: -1200 такси #командировка")
+		return
+	}
+
+	list := make([]*tagTotal, 0, len(totals))
+	for _, total := range totals {
+		list = append(list, total)
+	}
+	// Сначала теги с наибольшими расходами
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].expense != list[j].expense {
+			return list[i].expense < list[j].expense
+		}
+		return list[i].name < list[j].name
+	})
+
+	var text strings.Builder
+	text.WriteString("🏷 Итоги по тегам")
+	if !filter.IsEmpty() {
+		text.WriteString(" (" + filter.Description() + ")")
+	}
+	text.WriteString(":\n")
+	for _, total := range list {
+		text.WriteString(fmt.Sprintf("• #%s: ", total.name))
+		var parts []string
+		if total.expense != 0 {
+			parts = append(parts, fmt.Sprintf("расходы %.2f", math.Abs(total.expense)))
+		}
+		if total.income != 0 {
+			parts = append(parts, fmt.Sprintf("доходы %.2f", total.income))
+		}
+		text.WriteString(fmt.Sprintf("%s, транзакций: %d\n", strings.Join(parts, ", "), total.count))
+	}
+	text.WriteString("\nОтчёт по тегу: /report month #тег")
+	sendText(bot, update.Message.Chat.ID, text.String())
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"money-bot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// CallbackDelete - префикс данных кнопок подтверждения удаления: dl:y:<число транзакций>, dl:n
+	CallbackDelete = "dl"
+	// CallbackTrash - префикс данных кнопок корзины: tr:r:<ID транзакции>
+	CallbackTrash = "tr"
+	// trashPageSize - сколько транзакций корзины показывать в одном сообщении
+	trashPageSize = 10
+	// deletePreviewLines - сколько транзакций перечислять при подтверждении удаления
+	deletePreviewLines = 10
+)
+
+// HandleDelete удаляет транзакции. Ответ командой /delete на сообщение о транзакции удаляет её сразу,
+// а /delete с фильтром ("/delete month category=Кофе") сначала показывает, что будет удалено, и ждёт подтверждения.
+// Удалённые транзакции попадают в корзину, последнее удаление отменяет /undo.
+func HandleDelete(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage, categories []string) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+	log.Printf("Обработка команды /delete от пользователя %s (ID: %d), аргументы: \"%s\"", update.Message.From.UserName, userID, args)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if args == "" && update.Message.ReplyToMessage != nil {
+		transaction, err := s.GetTransactionByMessage(scope, chatID, update.Message.ReplyToMessage.MessageID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Ошибка при поиске транзакции по сообщению: %v", err)
+			}
+			sendText(bot, chatID, "Это сообщение не относится к транзакции, или она уже удалена.")
+			return
+		}
+		if !CanModifyTransaction(s, scope, userID, transaction) {
+			sendText(bot, chatID, "Удалять чужие транзакции может только владелец общего бюджета.")
+			return
+		}
+		if _, err := s.DeleteTransaction(scope, userID, transaction.ID); err != nil {
+			log.Printf("Ошибка при удалении транзакции %d: %v", transaction.ID, err)
+			sendText(bot, chatID, "Произошла ошибка при удалении транзакции.")
+			return
+		}
+		log.Printf("Транзакция %d удалена по ответу на сообщение", transaction.ID)
+		sendText(bot, chatID, fmt.Sprintf("🗑 Удалено: %s\nВернуть: /undo", transactionLine(transaction)))
+		return
+	}
+	if args == "" {
+		sendText(bot, chatID, "Ответьте командой /delete на сообщение о транзакции или укажите фильтр: /delete month category=Кофе. Найти транзакцию можно командой /find.")
+		return
+	}
+	confirmDeletion(bot, update.Message, s, scope, categories)
+}
+
+// confirmDeletion показывает транзакции, которые удалит команда, и кнопки подтверждения.
+// Сообщение отправляется ответом на команду: по ней кнопка заново находит транзакции.
+func confirmDeletion(bot *tgbotapi.BotAPI, command *tgbotapi.Message, s *storage.Storage, scope storage.Scope, categories []string) {
+	transactions, description, err := deletionCandidates(s, scope, command.From.ID, command, categories)
+	if err != nil {
+		sendText(bot, command.Chat.ID, deletionError(err))
+		return
+	}
+	if len(transactions) == 0 {
+		sendText(bot, command.Chat.ID, "Нет транзакций для удаления.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(command.Chat.ID, deletionPreview(transactions, description))
+	msg.ReplyToMessageID = command.MessageID
+	msg.ReplyMarkup = deletionKeyboard(len(transactions))
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке подтверждения удаления: %v", err)
+	}
+}
+
+// deletionCandidates находит транзакции, которые удаляет команда: /cleartoday - свои транзакции за сегодня,
+// /delete - транзакции по фильтру. В общей книге редактор удаляет только свои транзакции.
+// Ошибка содержит понятное пользователю объяснение, см. deletionError.
+func deletionCandidates(s *storage.Storage, scope storage.Scope, userID int64, command *tgbotapi.Message, categories []string) ([]storage.Transaction, string, error) {
+	var (
+		filter   Filter
+		ownOnly  = !canModifyAll(s, scope, userID)
+		describe string
+	)
+	switch command.Command() {
+	case "clear_today", "cleartoday":
+		filter.From, filter.To = GetStartAndEndOfDay()
+		ownOnly = true
+		describe = "за сегодня"
+	default:
+		var err error
+		filter, err = ParseFilter(command.CommandArguments(), categories)
+		if err != nil {
+			return nil, "", err
+		}
+		if filter.IsEmpty() {
+			return nil, "", errors.New("укажите фильтр, чтобы не удалить всю историю")
+		}
+		describe = "по фильтру " + filter.Description()
+	}
+
+	all, err := s.GetTransactionsByFilter(scope, filter.TransactionFilter)
+	if err != nil {
+		log.Printf("Ошибка при получении транзакций для удаления: %v", err)
+		return nil, "", errors.New("ошибка при получении транзакций")
+	}
+	transactions := all[:0]
+	for _, transaction := range all {
+		if !ownOnly || transaction.UserID == userID {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, describe, nil
+}
+
+// deletionError - сообщение пользователю об ошибке deletionCandidates
+func deletionError(err error) string {
+	return fmt.Sprintf("Не удалось удалить транзакции: %v.\nПример: /delete month category=Кофе", err)
+}
+
+// deletionPreview описывает транзакции, которые будут удалены
+func deletionPreview(transactions []storage.Transaction, description string) string {
+	var total float64
+	for _, transaction := range transactions {
+		total += transaction.Amount
+	}
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Удалить транзакции %s? Всего: %d, на сумму %.2f\n", description, len(transactions), total))
+	for i, transaction := range transactions {
+		if i == deletePreviewLines {
+			text.WriteString(fmt.Sprintf("\n… и ещё %d", len(transactions)-deletePreviewLines))
+			break
+		}
+		text.WriteString("\n• " + transactionLine(&transaction))
+	}
+	text.WriteString("\n\nУдалённые транзакции можно будет вернуть командой /undo или из /trash.")
+	return text.String()
+}
+
+// deletionKeyboard - кнопки подтверждения удаления count транзакций
+func deletionKeyboard(count int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 Удалить (%d)", count), fmt.Sprintf("%s:y:%d", CallbackDelete, count)),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", CallbackDelete+":n"),
+	))
+}
+
+// HandleDeleteCallback обрабатывает кнопки подтверждения удаления
+func HandleDeleteCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, args string, categories []string) {
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	command := query.Message.ReplyToMessage
+	if command == nil || !command.IsCommand() {
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+		return
+	}
+	// Подтвердить удаление может только автор команды
+	if command.From == nil || command.From.ID != query.From.ID {
+		answerCallback(bot, query, "Подтвердить удаление может только автор команды.")
+		return
+	}
+
+	action, countText, _ := strings.Cut(args, ":")
+	if action == "n" {
+		answerCallback(bot, query, "Отменено")
+		editText(bot, chatID, messageID, "Удаление отменено.", nil)
+		return
+	}
+	expected, err := strconv.Atoi(countText)
+	if action != "y" || err != nil {
+		log.Printf("Некорректные данные кнопки удаления: %s", args)
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+		return
+	}
+	scope, ok := CallbackScope(bot, query, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	transactions, description, err := deletionCandidates(s, scope, query.From.ID, command, categories)
+	if err != nil {
+		answerCallback(bot, query, deletionError(err))
+		return
+	}
+	// Пока пользователь думал, транзакции могли добавить или удалить: показываем новый список
+	if len(transactions) != expected {
+		if len(transactions) == 0 {
+			answerCallback(bot, query, "")
+			editText(bot, chatID, messageID, "Нет транзакций для удаления.", nil)
+			return
+		}
+		answerCallback(bot, query, "Список транзакций изменился, проверьте его ещё раз.")
+		markup := deletionKeyboard(len(transactions))
+		editText(bot, chatID, messageID, deletionPreview(transactions, description), &markup)
+		return
+	}
+
+	ids := make([]uint, len(transactions))
+	for i := range transactions {
+		ids[i] = transactions[i].ID
+	}
+	deleted, err := s.DeleteTransactions(scope, query.From.ID, ids)
+	if err != nil {
+		log.Printf("Ошибка при удалении %d транзакций: %v", len(ids), err)
+		answerCallback(bot, query, "Не удалось удалить транзакции.")
+		return
+	}
+	log.Printf("Пользователь %d удалил %d транзакций %s", query.From.ID, deleted, description)
+	answerCallback(bot, query, "Удалено")
+	editText(bot, chatID, messageID, fmt.Sprintf("🗑 Удалено транзакций: %d. Вернуть: /undo", deleted), nil)
+}
+
+// HandleUndo восстанавливает транзакции, удалённые последней командой или кнопкой пользователя
+func HandleUndo(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	userID, chatID := update.Message.From.ID, update.Message.Chat.ID
+	log.Printf("Обработка команды /undo от пользователя %s (ID: %d)", update.Message.From.UserName, userID)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	transactions, err := s.UndoLastDeletion(scope, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			sendText(bot, chatID, "Нечего восстанавливать: в корзине нет ваших недавних удалений. Посмотреть корзину: /trash")
+			return
+		}
+		log.Printf("Ошибка при отмене удаления для UserID %d: %v", userID, err)
+		sendText(bot, chatID, "Произошла ошибка при восстановлении транзакций.")
+		return
+	}
+	log.Printf("Пользователь %d восстановил %d транзакций", userID, len(transactions))
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("♻️ Восстановлено транзакций: %d\n", len(transactions)))
+	for i := range transactions {
+		if i == deletePreviewLines {
+			text.WriteString(fmt.Sprintf("\n… и ещё %d", len(transactions)-deletePreviewLines))
+			break
+		}
+		text.WriteString("\n• " + transactionLine(&transactions[i]))
+	}
+	sendText(bot, chatID, text.String())
+}
+
+// HandleTrash показывает недавно удалённые транзакции с кнопками восстановления
+func HandleTrash(bot *tgbotapi.BotAPI, update tgbotapi.Update, s *storage.Storage) {
+	log.Printf("Обработка команды /trash от пользователя %s (ID: %d)", update.Message.From.UserName, update.Message.From.ID)
+	scope, ok := ChatScope(bot, update.Message, s, storage.RoleViewer)
+	if !ok {
+		return
+	}
+	text, markup, err := trashPage(s, scope)
+	if err != nil {
+		log.Printf("Ошибка при получении корзины: %v", err)
+		sendText(bot, update.Message.Chat.ID, "Ошибка при получении корзины.")
+		return
+	}
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("Ошибка при отправке корзины: %v", err)
+	}
+}
+
+// trashPage формирует список транзакций в корзине с кнопками восстановления
+func trashPage(s *storage.Storage, scope storage.Scope) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	transactions, total, err := s.GetTrash(scope, trashPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		return "🗑 Корзина пуста.", nil, nil
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🗑 В корзине: %d. Транзакции удаляются окончательно по истечении срока хранения.\n", total))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := range transactions {
+		transaction := &transactions[i]
+		purgeAt := transaction.DeletedAt.Time.Add(s.TrashRetention())
+		text.WriteString(fmt.Sprintf("\n%d. %s (хранится до %s)", i+1, transactionLine(transaction), purgeAt.Format("02.01.2006")))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("♻️ %d", i+1), fmt.Sprintf("%s:r:%d", CallbackTrash, transaction.ID))))
+	}
+	if int(total) > len(transactions) {
+		text.WriteString(fmt.Sprintf("\n\nПоказаны последние %d.", len(transactions)))
+	}
+	text.WriteString("\n\nВернуть последнее удаление целиком: /undo")
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text.String(), &markup, nil
+}
+
+// HandleTrashCallback восстанавливает транзакцию из корзины по кнопке и обновляет список
+func HandleTrashCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, s *storage.Storage, args string) {
+	action, idText, _ := strings.Cut(args, ":")
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if action != "r" || err != nil {
+		log.Printf("Некорректные данные кнопки корзины: %s", args)
+		answerCallback(bot, query, "Эта кнопка больше не работает.")
+		return
+	}
+	scope, ok := CallbackScope(bot, query, s, storage.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// В общей книге редактор возвращает только свои транзакции
+	var authorID int64
+	if !canModifyAll(s, scope, query.From.ID) {
+		authorID = query.From.ID
+	}
+	transaction, err := s.As(query.From.ID).RestoreTransaction(scope, uint(id), authorID)
+	notice := "Транзакция восстановлена"
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ошибка при восстановлении транзакции %d: %v", id, err)
+		}
+		notice = "Транзакции уже нет в корзине."
+	} else {
+		log.Printf("Транзакция %d восстановлена из корзины пользователем %d", transaction.ID, query.From.ID)
+	}
+
+	text, markup, err := trashPage(s, scope)
+	if err != nil {
+		log.Printf("Ошибка при получении корзины: %v", err)
+		answerCallback(bot, query, notice)
+		return
+	}
+	answerCallback(bot, query, notice)
+	editText(bot, query.Message.Chat.ID, query.Message.MessageID, text, markup)
+}
@@ -0,0 +1,176 @@
+// Package numwords переводит числа, записанные русскими словами, в числовые значения:
+// "триста пятьдесят" -> 350, "тысяча двести" -> 1200, "полторы тысячи" -> 1500,
+// "две с половиной" -> 2.5, "1,5 тыс" -> 1500.
+package numwords
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Значения слов до тысячи
+var values = map[string]float64{
+	"ноль": 0,
+	"один": 1, "одна": 1, "одно": 1,
+	"два": 2, "две": 2,
+	"три":          3,
+	"четыре":       4,
+	"пять":         5,
+	"шесть":        6,
+	"семь":         7,
+	"восемь":       8,
+	"девять":       9,
+	"десять":       10,
+	"одиннадцать":  11,
+	"двенадцать":   12,
+	"тринадцать":   13,
+	"четырнадцать": 14,
+	"пятнадцать":   15,
+	"шестнадцать":  16,
+	"семнадцать":   17,
+	"восемнадцать": 18,
+	"девятнадцать": 19,
+	"двадцать":     20,
+	"тридцать":     30,
+	"сорок":        40,
+	"пятьдесят":    50,
+	"шестьдесят":   60,
+	"семьдесят":    70,
+	"восемьдесят":  80,
+	"девяносто":    90,
+	"сто":          100,
+	"двести":       200,
+	"триста":       300,
+	"четыреста":    400,
+	"пятьсот":      500,
+	"шестьсот":     600,
+	"семьсот":      700,
+	"восемьсот":    800,
+	"девятьсот":    900,
+}
+
+// Множители разрядов во всех падежных формах и сокращениях
+var multipliers = map[string]float64{
+	"тысяча": 1e3, "тысячи": 1e3, "тысяч": 1e3, "тыс": 1e3,
+	"миллион": 1e6, "миллиона": 1e6, "миллионов": 1e6, "млн": 1e6,
+}
+
+// Слова, означающие полтора
+var oneAndHalf = map[string]bool{
+	"полтора": true, "полторы": true,
+}
+
+// digitsRe - число, записанное цифрами, с точкой или запятой в качестве разделителя дробной части
+var digitsRe = regexp.MustCompile(`^\d+([.,]\d+)?$`)
+
+// normalize приводит слово к виду, в котором оно хранится в словарях
+func normalize(word string) string {
+	word = strings.ToLower(strings.Trim(word, ".,!?;:"))
+	return strings.ReplaceAll(word, "ё", "е")
+}
+
+// ParseLeading разбирает число в начале текста. Поддерживаются числа словами
+// ("тысяча двести"), дроби ("полторы тысячи", "две с половиной") и смешанная
+// запись ("1,5 тыс"). Возвращает значение, остаток текста после числа
+// и признак того, что число найдено. Разряды должны убывать: "тысяча тысяча"
+// и "двести тысяч миллион" числом не считаются.
+func ParseLeading(text string) (float64, string, bool) {
+	words := strings.Fields(text)
+
+	var (
+		total, group   float64
+		lastMultiplier float64
+		// Наименьший множитель во всём числе: следующий множитель должен быть меньше него
+		smallestMultiplier = math.Inf(1)
+		consumed           int
+		// Наименьший разряд, добавленный в текущую группу: "двести пять" допустимо,
+		// а "пять двести" - это уже два разных числа, и разбор останавливается.
+		lastOrder = 1e9
+	)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		w := normalize(word)
+
+		// "с половиной" добавляет половину к числу перед ним: "две с половиной",
+		// "тысяча с половиной". Дробь завершает группу.
+		if w == "с" && i+1 < len(words) && normalize(words[i+1]) == "половиной" {
+			if group > 0 && group == math.Trunc(group) {
+				group += 0.5
+			} else if group == 0 && lastMultiplier > 0 {
+				total += lastMultiplier / 2
+				lastMultiplier = 0
+			} else {
+				break
+			}
+			lastOrder = 0
+			consumed += 2
+			i++
+			continue
+		}
+
+		if value, ok := values[w]; ok {
+			order := magnitude(value)
+			if order >= lastOrder {
+				break
+			}
+			group += value
+			lastOrder = order
+			consumed++
+			continue
+		}
+		if oneAndHalf[w] || digitsRe.MatchString(strings.TrimRight(word, ".")) {
+			// Полтора и числа цифрами начинают группу и не продолжаются другими числами
+			if group != 0 || lastOrder == 0 {
+				break
+			}
+			if oneAndHalf[w] {
+				group = 1.5
+			} else {
+				value, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimRight(word, "."), ",", "."), 64)
+				if err != nil {
+					break
+				}
+				group = value
+			}
+			lastOrder = 0
+			consumed++
+			continue
+		}
+		if multiplier, ok := multipliers[w]; ok {
+			if multiplier >= smallestMultiplier {
+				return 0, text, false
+			}
+			smallestMultiplier = multiplier
+			if group == 0 {
+				group = 1 // "тысяча" без числа перед ней
+			}
+			total += group * multiplier
+			group = 0
+			lastMultiplier = multiplier
+			lastOrder = 1e9
+			consumed++
+			continue
+		}
+		break
+	}
+
+	if consumed == 0 {
+		return 0, text, false
+	}
+	return total + group, strings.Join(words[consumed:], " "), true
+}
+
+// magnitude возвращает разряд слова: сотни, десятки или единицы.
+// Числа от 10 до 19 занимают разряд единиц, потому что после них единицы не ставятся.
+func magnitude(value float64) float64 {
+	switch {
+	case value >= 100:
+		return 100
+	case value >= 20:
+		return 10
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,75 @@
+package numwords
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseLeading(t *testing.T) {
+	tests := []struct {
+		text   string
+		value  float64
+		rest   string
+		wantOK bool
+	}{
+		// Целые числа словами
+		{"пять", 5, "", true},
+		{"триста пятьдесят", 350, "", true},
+		{"двести пять рублей", 205, "рублей", true},
+		{"девятнадцать кофе", 19, "кофе", true},
+		{"Тысяча", 1000, "", true},
+		{"тысяча двести за свет", 1200, "за свет", true},
+		{"двадцать одна тысяча", 21000, "", true},
+		{"два миллиона триста тысяч", 2300000, "", true},
+		{"миллион двести тысяч пятьсот", 1200500, "", true},
+		{"ноль", 0, "", true},
+		{"четырёхсот", 0, "четырёхсот", false},
+
+		// Дроби
+		{"полторы тысячи", 1500, "", true},
+		{"полтора миллиона квартира", 1500000, "квартира", true},
+		{"полтора", 1.5, "", true},
+		{"две с половиной", 2.5, "", true},
+		{"две с половиной тысячи ремонт", 2500, "ремонт", true},
+		{"тысяча с половиной", 1500, "", true},
+		{"сто с половиной", 100.5, "", true},
+
+		// Цифры и смешанная запись
+		{"500 такси", 500, "такси", true},
+		{"500. такси", 500, "такси", true},
+		{"1,5 тыс", 1500, "", true},
+		{"1.5 тыс продукты", 1500, "продукты", true},
+		{"2 млн", 2000000, "", true},
+		{"12,50 кофе", 12.5, "кофе", true},
+
+		// Разбор останавливается на втором числе
+		{"пять двести", 5, "двести", true},
+		{"двадцать тридцать", 20, "тридцать", true},
+		{"500 300", 500, "300", true},
+		{"полторы две", 1.5, "две", true},
+
+		// Повторные и возрастающие множители
+		{"тысяча тысяча", 0, "тысяча тысяча", false},
+		{"тысяча двести тысяч", 0, "тысяча двести тысяч", false},
+		{"пять тысяч миллион", 0, "пять тысяч миллион", false},
+		{"тысяча с половиной тысяч", 0, "тысяча с половиной тысяч", false},
+
+		// Не числа
+		{"", 0, "", false},
+		{"кофе 500", 0, "кофе 500", false},
+		{"1e5 кофе", 0, "1e5 кофе", false},
+		{"с половиной", 0, "с половиной", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			value, rest, ok := ParseLeading(tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseLeading(%q) ok = %v, ожидалось %v", tt.text, ok, tt.wantOK)
+			}
+			if math.Abs(value-tt.value) > 1e-9 || rest != tt.rest {
+				t.Errorf("ParseLeading(%q) = (%g, %q), ожидалось (%g, %q)", tt.text, value, rest, tt.value, tt.rest)
+			}
+		})
+	}
+}
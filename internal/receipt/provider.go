@@ -0,0 +1,130 @@
+package receipt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Item - позиция чека
+type Item struct {
+	Name     string
+	Price    float64 // Цена за единицу в рублях
+	Quantity float64
+	Sum      float64 // Стоимость позиции в рублях
+}
+
+// Details - расшифровка чека по позициям
+type Details struct {
+	Seller string // Продавец
+	Total  float64
+	Items  []Item
+}
+
+// Provider получает расшифровку чека по его фискальным реквизитам
+type Provider interface {
+	FetchReceipt(ctx context.Context, qr *QR) (*Details, error)
+}
+
+// HTTPProvider получает расшифровку чека у HTTP-сервиса.
+// Запрос: GET {BaseURL}/receipt?fn=...&i=...&fp=...&t=...&s=...&n=...
+// Ответ повторяет формат ФНС, суммы в копейках:
+//
+//	{"user": "ООО Ромашка", "totalSum": 123400,
+//	 "items": [{"name": "Молоко", "price": 8990, "quantity": 1, "sum": 8990}]}
+type HTTPProvider struct {
+	BaseURL string
+	Token   string // Необязательный токен, передаётся в заголовке Authorization
+	Client  *http.Client
+}
+
+// NewHTTPProvider создает провайдера для сервиса по адресу baseURL
+func NewHTTPProvider(baseURL, token string) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+// providerResponse - тело ответа сервиса расшифровки чеков
+type providerResponse struct {
+	User     string `json:"user"`
+	TotalSum int64  `json:"totalSum"`
+	Items    []struct {
+		Name     string  `json:"name"`
+		Price    int64   `json:"price"`
+		Quantity float64 `json:"quantity"`
+		Sum      int64   `json:"sum"`
+	} `json:"items"`
+}
+
+// FetchReceipt запрашивает расшифровку чека
+func (p *HTTPProvider) FetchReceipt(ctx context.Context, qr *QR) (*Details, error) {
+	query := url.Values{}
+	query.Set("fn", qr.FN)
+	query.Set("i", qr.FD)
+	query.Set("fp", qr.FP)
+	query.Set("t", qr.Time.Format(qrTimeLayouts[0]))
+	query.Set("s", strconv.FormatFloat(qr.Sum, 'f', 2, 64))
+	query.Set("n", strconv.Itoa(qr.Operation))
+	requestURL := p.BaseURL + "/receipt?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании запроса: %w", err)
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	log.Printf("Запрос расшифровки чека ФН %s ФД %s у %s", qr.FN, qr.FD, p.BaseURL)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при отправке запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении ответа: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервис вернул ошибку (статус %d): %s", resp.StatusCode, string(body))
+	}
+
+	var parsed providerResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("ошибка при демаршалинге JSON: %w", err)
+	}
+	if len(parsed.Items) == 0 {
+		return nil, fmt.Errorf("в ответе нет позиций чека")
+	}
+
+	details := &Details{
+		Seller: parsed.User,
+		Total:  kopecksToRubles(parsed.TotalSum),
+		Items:  make([]Item, 0, len(parsed.Items)),
+	}
+	for _, item := range parsed.Items {
+		details.Items = append(details.Items, Item{
+			Name:     strings.TrimSpace(item.Name),
+			Price:    kopecksToRubles(item.Price),
+			Quantity: item.Quantity,
+			Sum:      kopecksToRubles(item.Sum),
+		})
+	}
+	return details, nil
+}
+
+// kopecksToRubles переводит сумму из копеек в рубли
+func kopecksToRubles(kopecks int64) float64 {
+	return float64(kopecks) / 100
+}
@@ -0,0 +1,133 @@
+package receipt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderFetchReceipt(t *testing.T) {
+	qr, err := ParseQR("t=20260115T1230&s=1234.00&fn=7281440500123456&i=12345&fp=1234567890&n=1")
+	if err != nil {
+		t.Fatalf("ParseQR: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		body    string
+		want    *Details
+		wantErr string
+	}{
+		{
+			name:   "расшифровка в копейках",
+			token:  "secret",
+			status: http.StatusOK,
+			body: `{"user": "ООО Ромашка", "totalSum": 123400, "items": [
+				{"name": " Молоко ", "price": 8990, "quantity": 2, "sum": 17980},
+				{"name": "Хлеб", "price": 105420, "quantity": 1, "sum": 105420}]}`,
+			want: &Details{
+				Seller: "ООО Ромашка",
+				Total:  1234,
+				Items: []Item{
+					{Name: "Молоко", Price: 89.9, Quantity: 2, Sum: 179.8},
+					{Name: "Хлеб", Price: 1054.2, Quantity: 1, Sum: 1054.2},
+				},
+			},
+		},
+		{
+			name:   "без токена",
+			status: http.StatusOK,
+			body:   `{"user": "ИП Иванов", "totalSum": 100, "items": [{"name": "Спички", "price": 100, "quantity": 1, "sum": 100}]}`,
+			want: &Details{
+				Seller: "ИП Иванов",
+				Total:  1,
+				Items:  []Item{{Name: "Спички", Price: 1, Quantity: 1, Sum: 1}},
+			},
+		},
+		{
+			name:    "ошибка сервиса",
+			status:  http.StatusNotFound,
+			body:    "чек не найден",
+			wantErr: "статус 404",
+		},
+		{
+			name:    "нет позиций",
+			status:  http.StatusOK,
+			body:    `{"user": "ООО Ромашка", "totalSum": 123400, "items": []}`,
+			wantErr: "нет позиций",
+		},
+		{
+			name:    "неверный JSON",
+			status:  http.StatusOK,
+			body:    `{"items": `,
+			wantErr: "JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/receipt" {
+					t.Errorf("путь запроса %q, ожидался /receipt", r.URL.Path)
+				}
+				query := r.URL.Query()
+				wantQuery := map[string]string{
+					"fn": "7281440500123456", "i": "12345", "fp": "1234567890",
+					"t": "20260115T123000", "s": "1234.00", "n": "1",
+				}
+				for key, value := range wantQuery {
+					if got := query.Get(key); got != value {
+						t.Errorf("параметр %s = %q, ожидалось %q", key, got, value)
+					}
+				}
+				wantAuth := ""
+				if tt.token != "" {
+					wantAuth = "Bearer " + tt.token
+				}
+				if got := r.Header.Get("Authorization"); got != wantAuth {
+					t.Errorf("Authorization = %q, ожидалось %q", got, wantAuth)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			provider := NewHTTPProvider(server.URL+"/", tt.token)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			got, err := provider.FetchReceipt(ctx, qr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ошибка %v, ожидалась ошибка с %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchReceipt: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FetchReceipt = %+v, ожидалось %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProviderContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	qr := &QR{FN: "1", FD: "2", FP: "3", Sum: 1, Operation: OperationIncome}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := NewHTTPProvider(server.URL, "").FetchReceipt(ctx, qr); err == nil {
+		t.Fatal("ожидалась ошибка по истечении контекста")
+	}
+}
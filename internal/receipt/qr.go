@@ -0,0 +1,112 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Регистрируем декодеры форматов, в которых Telegram присылает фото
+	_ "image/png"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// QR - реквизиты фискального чека, закодированные в QR-коде:
+// t=20260115T1230&s=1234.00&fn=7281440500123456&i=12345&fp=1234567890&n=1
+type QR struct {
+	Time      time.Time // Дата и время покупки (t)
+	Sum       float64   // Итоговая сумма чека в рублях (s)
+	FN        string    // Номер фискального накопителя (fn)
+	FD        string    // Номер фискального документа (i)
+	FP        string    // Фискальный признак документа (fp)
+	Operation int       // Тип операции (n): 1 - приход, 2 - возврат прихода, 3 - расход, 4 - возврат расхода
+	Raw       string    // Исходная строка из QR-кода
+}
+
+// OperationIncome - тип операции "приход", то есть обычная покупка
+const OperationIncome = 1
+
+// Форматы времени в поле t: с секундами и без
+var qrTimeLayouts = []string{"20060102T150405", "20060102T1504"}
+
+// LooksLikeQR сообщает, похож ли текст на содержимое QR-кода фискального чека
+func LooksLikeQR(text string) bool {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, " \n") {
+		return false
+	}
+	for _, key := range []string{"t=", "s=", "fn=", "fp="} {
+		if !strings.Contains(text, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseQR разбирает строку из QR-кода фискального чека
+func ParseQR(payload string) (*QR, error) {
+	payload = strings.TrimSpace(payload)
+	values, err := url.ParseQuery(payload)
+	if err != nil {
+		return nil, fmt.Errorf("строка QR-кода не похожа на параметры чека: %w", err)
+	}
+
+	qr := &QR{
+		FN:  values.Get("fn"),
+		FD:  values.Get("i"),
+		FP:  values.Get("fp"),
+		Raw: payload,
+	}
+	if qr.FN == "" || qr.FD == "" || qr.FP == "" {
+		return nil, fmt.Errorf("в QR-коде нет фискальных реквизитов fn, i и fp")
+	}
+
+	rawTime := values.Get("t")
+	for _, layout := range qrTimeLayouts {
+		if qr.Time, err = time.ParseInLocation(layout, rawTime, time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось разобрать время чека %q", rawTime)
+	}
+
+	qr.Sum, err = strconv.ParseFloat(values.Get("s"), 64)
+	if err != nil || qr.Sum <= 0 {
+		return nil, fmt.Errorf("не удалось разобрать сумму чека %q", values.Get("s"))
+	}
+
+	qr.Operation = OperationIncome
+	if n := values.Get("n"); n != "" {
+		if qr.Operation, err = strconv.Atoi(n); err != nil {
+			return nil, fmt.Errorf("не удалось разобрать тип операции %q", n)
+		}
+	}
+	return qr, nil
+}
+
+// DecodeImage находит на изображении QR-код и возвращает его содержимое
+func DecodeImage(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("не удалось декодировать изображение: %w", err)
+	}
+
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("не удалось подготовить изображение: %w", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+	if err != nil {
+		return "", fmt.Errorf("QR-код на изображении не найден: %w", err)
+	}
+	return result.GetText(), nil
+}
@@ -0,0 +1,115 @@
+// Package speech распознаёт речь из голосовых сообщений.
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transcriber переводит аудиозапись в текст
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, fileName string) (string, error)
+}
+
+// DefaultWhisperURL - адрес OpenAI API; локальный whisper-сервер с совместимым API задаётся своим адресом
+const DefaultWhisperURL = "https://api.openai.com/v1"
+
+// WhisperTranscriber распознаёт речь через OpenAI-совместимый эндпоинт /audio/transcriptions
+type WhisperTranscriber struct {
+	BaseURL  string
+	APIKey   string // Для локального сервера ключ обычно не нужен
+	Model    string
+	Language string
+	Client   *http.Client
+}
+
+// NewWhisperTranscriber создает клиента для сервиса распознавания по адресу baseURL
+func NewWhisperTranscriber(baseURL, apiKey, model string) *WhisperTranscriber {
+	if baseURL == "" {
+		baseURL = DefaultWhisperURL
+	}
+	if model == "" {
+		model = "whisper-1"
+	}
+	return &WhisperTranscriber{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		APIKey:   apiKey,
+		Model:    model,
+		Language: "ru",
+		Client:   &http.Client{Timeout: time.Second * 60},
+	}
+}
+
+// transcriptionResponse - тело ответа эндпоинта распознавания
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// Transcribe отправляет аудио на распознавание и возвращает текст
+func (w *WhisperTranscriber) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при формировании запроса: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("ошибка при формировании запроса: %w", err)
+	}
+	fields := map[string]string{
+		"model":           w.Model,
+		"language":        w.Language,
+		"response_format": "json",
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("ошибка при формировании запроса: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("ошибка при формировании запроса: %w", err)
+	}
+
+	url := w.BaseURL + "/audio/transcriptions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при создании запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if w.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+w.APIKey)
+	}
+
+	log.Printf("Отправка аудио (%d байт) на распознавание: %s", len(audio), url)
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при отправке запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при чтении ответа: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("сервис распознавания вернул ошибку (статус %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var parsed transcriptionResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", fmt.Errorf("ошибка при демаршалинге JSON: %w", err)
+	}
+	text := strings.TrimSpace(parsed.Text)
+	if text == "" {
+		return "", fmt.Errorf("речь не распознана")
+	}
+	return text, nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Статусы доступа пользователя к боту
+const (
+	AccessPending  = "pending"  // Писал боту, но доступа ещё нет
+	AccessApproved = "approved" // Допущен администратором или по коду приглашения
+	AccessBlocked  = "blocked"  // Заблокирован администратором, бот его игнорирует
+)
+
+// BotUser - решение о доступе пользователя к боту. Пользователи, о которых решения нет,
+// допускаются или нет в зависимости от режима доступа бота.
+type BotUser struct {
+	UserID     int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name       string // Имя в Telegram на момент последнего обращения
+	Status     string `gorm:"index"`
+	DecidedBy  int64  // Администратор, принявший решение; 0 - вход по коду приглашения
+	InviteCode string // Код приглашения, по которому пользователь получил доступ
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// GetBotUser возвращает решение о доступе пользователя или nil, если его нет
+func (s *Storage) GetBotUser(userID int64) (*BotUser, error) {
+	var users []BotUser
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return &users[0], nil
+}
+
+// RequestAccess запоминает пользователя, которому ещё не открыт доступ, чтобы администратор
+// увидел его в списке. Возвращает true, если пользователь обратился к боту впервые.
+func (s *Storage) RequestAccess(userID int64, name string) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&BotUser{UserID: userID, Name: name, Status: AccessPending})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetAccess сохраняет решение о доступе пользователя. Пустое имя не затирает известное.
+func (s *Storage) SetAccess(user *BotUser) error {
+	columns := []string{"status", "decided_by", "invite_code", "updated_at"}
+	if user.Name != "" {
+		columns = append(columns, "name")
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(user).Error
+}
+
+// GetBotUsers возвращает пользователей со статусом status (все, если он пуст), недавние первыми
+func (s *Storage) GetBotUsers(status string) ([]BotUser, error) {
+	var users []BotUser
+	q := s.db.Order("updated_at desc")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	result := q.Find(&users)
+	return users, result.Error
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DailyCount - число записей за один день
+type DailyCount struct {
+	Day   string // Дата в формате 2006-01-02
+	Count int64
+}
+
+// AdminStats - сводка по боту для администратора
+type AdminStats struct {
+	Users        int64            // Пользователи, у которых есть хотя бы одна транзакция
+	ActiveUsers  int64            // Пользователи, добавлявшие транзакции начиная с since
+	Ledgers      int64            // Общие книги групп
+	Transactions int64            // Транзакции без учёта корзины
+	Trash        int64            // Транзакции в корзине
+	PerDay       []DailyCount     // Добавленные транзакции по дням начиная с since
+	Access       map[string]int64 // Пользователи по статусам доступа
+	DBSize       int64            // Размер базы данных в байтах
+}
+
+// GetAdminStats собирает сводку по боту; активность считается начиная с since
+func (s *Storage) GetAdminStats(since time.Time) (*AdminStats, error) {
+	stats := &AdminStats{Access: make(map[string]int64)}
+	all := s.db.Unscoped().Model(&Transaction{})
+	counts := []struct {
+		q    *gorm.DB
+		dest *int64
+	}{
+		{all.Session(&gorm.Session{}).Distinct("user_id"), &stats.Users},
+		{all.Session(&gorm.Session{}).Distinct("user_id").Where("created_at >= ?", since), &stats.ActiveUsers},
+		{s.db.Model(&Transaction{}), &stats.Transactions},
+		{all.Session(&gorm.Session{}).Where("deleted_at IS NOT NULL"), &stats.Trash},
+		{s.db.Model(&Ledger{}), &stats.Ledgers},
+	}
+	for _, count := range counts {
+		if err := count.q.Count(count.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Дата берётся из сохранённого значения как есть, то есть в часовом поясе сервера
+	if err := all.Session(&gorm.Session{}).Select("substr(created_at, 1, 10) AS day, COUNT(*) AS count").
+		Where("created_at >= ?", since).Group("day").Order("day").Scan(&stats.PerDay).Error; err != nil {
+		return nil, err
+	}
+
+	var access []struct {
+		Status string
+		Count  int64
+	}
+	if err := s.db.Model(&BotUser{}).Select("status, COUNT(*) AS count").Group("status").Scan(&access).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range access {
+		stats.Access[row.Status] = row.Count
+	}
+
+	var pageCount, pageSize int64
+	if err := s.db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return nil, err
+	}
+	stats.DBSize = pageCount * pageSize
+	return stats, nil
+}
+
+// GetBroadcastRecipients возвращает пользователей для рассылки: всех, кто записывал транзакции,
+// состоит в общих книгах или допущен администратором, кроме заблокированных.
+// Режим доступа бота здесь не учитывается: его проверяет вызывающий код.
+func (s *Storage) GetBroadcastRecipients() ([]int64, error) {
+	var userIDs []int64
+	result := s.db.Raw(`SELECT user_id FROM transactions
+		UNION SELECT user_id FROM ledger_members
+		UNION SELECT user_id FROM bot_users WHERE status = ?
+		EXCEPT SELECT user_id FROM bot_users WHERE status = ?
+		ORDER BY user_id`, AccessApproved, AccessBlocked).Scan(&userIDs)
+	return userIDs, result.Error
+}
+
+// UserSummary - сведения о пользователе для администратора
+type UserSummary struct {
+	Access             *BotUser   // Решение о доступе; nil - решения нет
+	Transactions       int64      // Личные транзакции без учёта корзины
+	Trash              int64      // Личные транзакции в корзине
+	LedgerTransactions int64      // Транзакции пользователя в общих книгах
+	Ledgers            int64      // Общие книги, в которых он состоит
+	Categories         int64      // Свои категории доходов
+	Goals              int64      // Цели накоплений
+	Loans              int64      // Долги, включая погашенные
+	FirstTransaction   *time.Time // Когда добавлена первая транзакция
+	LastTransaction    *time.Time // Когда добавлена последняя транзакция
+}
+
+// GetUserSummary собирает сведения о пользователе
+func (s *Storage) GetUserSummary(userID int64) (*UserSummary, error) {
+	var summary UserSummary
+	var err error
+	if summary.Access, err = s.GetBotUser(userID); err != nil {
+		return nil, err
+	}
+	personal := s.db.Unscoped().Model(&Transaction{}).Where("user_id = ? AND ledger_id = 0", userID)
+	counts := []struct {
+		q    *gorm.DB
+		dest *int64
+	}{
+		{personal.Session(&gorm.Session{}).Where("deleted_at IS NULL"), &summary.Transactions},
+		{personal.Session(&gorm.Session{}).Where("deleted_at IS NOT NULL"), &summary.Trash},
+		{s.db.Model(&Transaction{}).Where("user_id = ? AND ledger_id <> 0", userID), &summary.LedgerTransactions},
+		{s.db.Model(&LedgerMember{}).Where("user_id = ?", userID), &summary.Ledgers},
+		{s.db.Model(&Category{}).Where("user_id = ?", userID), &summary.Categories},
+		{s.db.Model(&Goal{}).Where("user_id = ?", userID), &summary.Goals},
+		{s.db.Model(&Loan{}).Where("user_id = ?", userID), &summary.Loans},
+	}
+	for _, count := range counts {
+		if err := count.q.Count(count.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var first, last []Transaction
+	if err := s.db.Unscoped().Where("user_id = ?", userID).Order("created_at").Limit(1).Find(&first).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Unscoped().Where("user_id = ?", userID).Order("created_at desc").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	if len(first) > 0 {
+		summary.FirstTransaction = &first[0].CreatedAt
+		summary.LastTransaction = &last[0].CreatedAt
+	}
+	return &summary, nil
+}
+
+// PurgeUser окончательно удаляет личные данные пользователя: транзакции вместе с корзиной,
+// чеки, категории, цели, долги и служебные записи. Из журнала изменений личных данных
+// стирается содержимое, в том числе записей о самом удалении. Транзакции в общих книгах
+// и участие в них остаются: от них зависят балансы других участников. Решение о доступе
+// тоже остаётся, чтобы заблокированный пользователь не получил доступ снова.
+// Возвращает число удалённых транзакций.
+func (s *Storage) PurgeUser(userID int64) (int64, error) {
+	var purged int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&Transaction{}).Where("user_id = ? AND ledger_id = 0", userID).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		var err error
+		if purged, err = purgeTransactions(tx, ids); err != nil {
+			return err
+		}
+
+		// Зависимые записи удаляются раньше тех, на которые они ссылаются
+		deletions := []struct {
+			model interface{}
+			query string
+			arg   interface{}
+		}{
+			{&RecategorizationChange{}, "batch_id IN (?)", tx.Model(&RecategorizationBatch{}).Select("id").Where("user_id = ?", userID)},
+			{&RecategorizationBatch{}, "user_id = ?", userID},
+			{&GoalContribution{}, "goal_id IN (?)", tx.Model(&Goal{}).Select("id").Where("user_id = ?", userID)},
+			{&Goal{}, "user_id = ?", userID},
+			{&LoanRepayment{}, "loan_id IN (?)", tx.Model(&Loan{}).Select("id").Where("user_id = ?", userID)},
+			{&Loan{}, "user_id = ?", userID},
+			{&Category{}, "user_id = ?", userID},
+			{&ClassificationCache{}, "user_id = ?", userID},
+			{&PendingClassification{}, "user_id = ?", userID},
+			{&InsightDelivery{}, "user_id = ?", userID},
+			{&EditPrompt{}, "user_id = ?", userID},
+			{&DeletionBatch{}, "user_id = ? AND ledger_id = 0", userID},
+		}
+		for _, deletion := range deletions {
+			if err := tx.Where(deletion.query, deletion.arg).Delete(deletion.model).Error; err != nil {
+				return err
+			}
+		}
+		// Чеки, по которым есть транзакции в общих книгах, нужны этим транзакциям
+		err = tx.Unscoped().Where("user_id = ?", userID).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&Transaction{}).Select("receipt_id").Where("receipt_id IS NOT NULL")).
+			Delete(&Receipt{}).Error
+		if err != nil {
+			return err
+		}
+		// Стираем содержимое журнала последним: удаления выше тоже записали в него прежние состояния
+		return redactAuditLog(tx, userID)
+	})
+	return purged, err
+}
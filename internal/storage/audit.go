@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Действия в журнале изменений
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge" // Окончательное удаление из корзины
+)
+
+// SystemActor - автор изменений, которые бот делает сам, например очистки корзины
+const SystemActor int64 = 0
+
+// auditBeforeKey - ключ, под которым хук Before* сохраняет состояние записей до изменения
+const auditBeforeKey = "audit:before"
+
+// auditIgnoredColumns - столбцы, изменение которых само по себе не попадает в журнал
+var auditIgnoredColumns = map[string]bool{"updated_at": true}
+
+// AuditEntry - запись журнала изменений: кто, когда и как изменил транзакцию или категорию.
+// Журнал только пополняется: изменить или удалить записи не дают триггеры базы данных.
+// Единственное исключение - стирание содержимого записи при удалении данных пользователя,
+// см. redactAuditLog: факт изменения остаётся, а суммы и комментарии - нет.
+type AuditEntry struct {
+	ID        uint   `gorm:"primarykey"`
+	ActorID   int64  `gorm:"index"` // Кто внёс изменение; SystemActor - бот
+	Action    string // Одна из констант Audit*
+	Entity    string `gorm:"index:idx_audit_record"` // Таблица изменённой записи
+	RecordID  uint   `gorm:"index:idx_audit_record"`
+	UserID    int64  `gorm:"index"` // Владелец записи
+	LedgerID  uint   `gorm:"index"` // Общая книга записи; 0 - личная
+	Before    string // Состояние записи до изменения в JSON; пусто при создании
+	After     string // Состояние после изменения в JSON; пусто при окончательном удалении
+	CreatedAt time.Time
+}
+
+// Changes возвращает изменённые столбцы записи со значениями до и после изменения
+func (e *AuditEntry) Changes() (map[string][2]interface{}, error) {
+	var before, after map[string]interface{}
+	if e.Before != "" {
+		if err := json.Unmarshal([]byte(e.Before), &before); err != nil {
+			return nil, err
+		}
+	}
+	if e.After != "" {
+		if err := json.Unmarshal([]byte(e.After), &after); err != nil {
+			return nil, err
+		}
+	}
+	changes := make(map[string][2]interface{})
+	for column, value := range after {
+		if !reflect.DeepEqual(before[column], value) {
+			changes[column] = [2]interface{}{before[column], value}
+		}
+	}
+	for column, value := range before {
+		if _, ok := after[column]; !ok {
+			changes[column] = [2]interface{}{value, nil}
+		}
+	}
+	return changes, nil
+}
+
+// actorKey - ключ контекста запроса, в котором передаётся автор изменения
+type actorKey struct{}
+
+// As возвращает хранилище, изменения через которое записываются в журнал от имени actorID.
+// Без него автором считается владелец изменённой записи.
+func (s *Storage) As(actorID int64) *Storage {
+	clone := *s
+	clone.db = s.db.WithContext(context.WithValue(s.db.Statement.Context, actorKey{}, actorID))
+	return &clone
+}
+
+// initAuditLog запрещает изменять и удалять записи журнала на уровне базы данных.
+// Изменение разрешено только одно: очистить состояния до и после, не трогая остальные столбцы.
+func initAuditLog(db *gorm.DB) error {
+	statements := []string{
+		// Триггер изменения пересоздаётся, чтобы базы с прежней, безусловной версией получили исключение
+		`DROP TRIGGER IF EXISTS audit_entries_no_UPDATE`,
+		`CREATE TRIGGER audit_entries_no_UPDATE BEFORE UPDATE ON audit_entries
+		WHEN NOT (NEW."before" = '' AND NEW."after" = '' AND NEW.id IS OLD.id AND NEW.actor_id IS OLD.actor_id
+			AND NEW.action IS OLD.action AND NEW.entity IS OLD.entity AND NEW.record_id IS OLD.record_id
+			AND NEW.user_id IS OLD.user_id AND NEW.ledger_id IS OLD.ledger_id AND NEW.created_at IS OLD.created_at)
+		BEGIN
+			SELECT RAISE(ABORT, 'журнал изменений нельзя изменять');
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_entries_no_DELETE BEFORE DELETE ON audit_entries BEGIN
+			SELECT RAISE(ABORT, 'журнал изменений нельзя изменять');
+		END`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactAuditLog стирает состояния записей в журнале изменений личных данных пользователя.
+// Остаются только действие, автор, время и номер записи; журнал общих книг не меняется.
+func redactAuditLog(tx *gorm.DB, userID int64) error {
+	return tx.Model(&AuditEntry{}).Where("user_id = ? AND ledger_id = 0", userID).
+		Where(`"before" <> '' OR "after" <> ''`).
+		Updates(map[string]interface{}{"before": "", "after": ""}).Error
+}
+
+// Хуки GORM записывают в журнал каждое изменение транзакций и категорий, в том числе
+// массовые изменения через Model(&Transaction{}).Where(...): затронутые записи
+// читаются по условиям запроса до и после его выполнения.
+
+func (t *Transaction) AfterCreate(tx *gorm.DB) error  { return auditCreated(tx, t.ID) }
+func (t *Transaction) BeforeUpdate(tx *gorm.DB) error { return auditBefore(tx) }
+func (t *Transaction) AfterUpdate(tx *gorm.DB) error  { return auditAfter(tx) }
+func (t *Transaction) BeforeDelete(tx *gorm.DB) error { return auditBefore(tx) }
+func (t *Transaction) AfterDelete(tx *gorm.DB) error  { return auditAfter(tx) }
+
+func (c *Category) AfterCreate(tx *gorm.DB) error  { return auditCreated(tx, c.ID) }
+func (c *Category) BeforeUpdate(tx *gorm.DB) error { return auditBefore(tx) }
+func (c *Category) AfterUpdate(tx *gorm.DB) error  { return auditAfter(tx) }
+func (c *Category) BeforeDelete(tx *gorm.DB) error { return auditBefore(tx) }
+func (c *Category) AfterDelete(tx *gorm.DB) error  { return auditAfter(tx) }
+
+// auditCreated записывает в журнал созданную запись
+func auditCreated(tx *gorm.DB, id uint) error {
+	// При ON CONFLICT DO NOTHING запись могла не создаться
+	if id == 0 {
+		return nil
+	}
+	rows, err := auditLoad(tx, func(q *gorm.DB) *gorm.DB { return q.Where("id = ?", id) })
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	return auditWrite(tx, []map[string]interface{}{nil}, rows)
+}
+
+// auditBefore запоминает состояние записей, которые затронет запрос
+func auditBefore(tx *gorm.DB) error {
+	stmt := tx.Statement
+	rows, err := auditLoad(tx, func(q *gorm.DB) *gorm.DB {
+		if where, ok := stmt.Clauses["WHERE"]; ok {
+			if expression, ok := where.Expression.(clause.Where); ok {
+				q = q.Clauses(expression)
+			}
+		}
+		// Условие по первичному ключу модели GORM добавляет позже, при выполнении запроса
+		if stmt.Schema.PrioritizedPrimaryField != nil && stmt.ReflectValue.Kind() == reflect.Struct {
+			if id, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+				q = q.Where("id = ?", id)
+			}
+		}
+		// Удалённые транзакции изменяются, только если запрос выполняется без учёта удаления
+		if stmt.Schema.LookUpField("DeletedAt") != nil && !stmt.Unscoped {
+			q = q.Where("deleted_at IS NULL")
+		}
+		return q
+	})
+	if err != nil {
+		return err
+	}
+	// InstanceSet здесь не подходит: хук получает сессию, которая создаст для него новый Statement
+	stmt.Settings.Store(auditBeforeKey, rows)
+	return nil
+}
+
+// auditAfter записывает в журнал изменения записей, запомненных в auditBefore
+func auditAfter(tx *gorm.DB) error {
+	value, ok := tx.Statement.Settings.Load(auditBeforeKey)
+	if !ok {
+		return nil
+	}
+	before := value.([]map[string]interface{})
+	if len(before) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, len(before))
+	for i, row := range before {
+		ids[i] = row["id"]
+	}
+	current, err := auditLoad(tx, func(q *gorm.DB) *gorm.DB { return q.Where("id IN ?", ids) })
+	if err != nil {
+		return err
+	}
+	byID := make(map[interface{}]map[string]interface{}, len(current))
+	for _, row := range current {
+		byID[row["id"]] = row
+	}
+	after := make([]map[string]interface{}, len(before))
+	for i, row := range before {
+		after[i] = byID[row["id"]] // nil, если запись удалена окончательно
+	}
+	return auditWrite(tx, before, after)
+}
+
+// auditLoad читает записи таблицы запроса tx с условиями where в виде столбец - значение
+func auditLoad(tx *gorm.DB, where func(*gorm.DB) *gorm.DB) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	q := tx.Session(&gorm.Session{NewDB: true}).Table(tx.Statement.Table)
+	if err := where(q).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// auditWrite сохраняет записи журнала для пар состояний до и после изменения
+func auditWrite(tx *gorm.DB, before, after []map[string]interface{}) error {
+	actorID, hasActor := tx.Statement.Context.Value(actorKey{}).(int64)
+	var entries []AuditEntry
+	for i := range before {
+		entry := AuditEntry{Entity: tx.Statement.Table}
+		row := after[i]
+		if row == nil {
+			row = before[i]
+		}
+		entry.RecordID = uint(toInt64(row["id"]))
+		entry.UserID = toInt64(row["user_id"])
+		entry.LedgerID = uint(toInt64(row["ledger_id"]))
+		entry.ActorID = entry.UserID
+		if hasActor {
+			entry.ActorID = actorID
+		}
+
+		switch {
+		case before[i] == nil:
+			entry.Action = AuditCreate
+		case after[i] == nil && before[i]["deleted_at"] != nil:
+			entry.Action = AuditPurge
+		case after[i] == nil:
+			entry.Action = AuditDelete
+		case before[i]["deleted_at"] == nil && after[i]["deleted_at"] != nil:
+			entry.Action = AuditDelete
+		case before[i]["deleted_at"] != nil && after[i]["deleted_at"] == nil:
+			entry.Action = AuditRestore
+		default:
+			entry.Action = AuditUpdate
+			if !auditChanged(before[i], after[i]) {
+				continue
+			}
+		}
+
+		var err error
+		if entry.Before, err = auditJSON(before[i]); err != nil {
+			return err
+		}
+		if entry.After, err = auditJSON(after[i]); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&entries).Error
+}
+
+// auditChanged сообщает, изменилось ли что-то, кроме служебных столбцов
+func auditChanged(before, after map[string]interface{}) bool {
+	for column, value := range after {
+		if !auditIgnoredColumns[column] && !reflect.DeepEqual(before[column], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditJSON записывает состояние записи в JSON; nil - пустая строка
+func auditJSON(row map[string]interface{}) (string, error) {
+	if row == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(row)
+	return string(data), err
+}
+
+// toInt64 приводит целое значение столбца, прочитанное драйвером, к int64
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// GetTransactionHistory возвращает записи журнала об изменениях транзакции области scope в хронологическом порядке
+func (s *Storage) GetTransactionHistory(scope Scope, transactionID uint) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	result := auditScope(s.db, scope).Where("entity = ? AND record_id = ?", "transactions", transactionID).
+		Order("id").Find(&entries)
+	return entries, result.Error
+}
+
+// GetAuditLog возвращает весь журнал изменений области scope в хронологическом порядке:
+// в общей книге - изменения её транзакций, в личном чате - личных транзакций и категорий пользователя
+func (s *Storage) GetAuditLog(scope Scope) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	result := auditScope(s.db, scope).Order("id").Find(&entries)
+	return entries, result.Error
+}
+
+// auditScope добавляет к запросу журнала условие области
+func auditScope(db *gorm.DB, scope Scope) *gorm.DB {
+	if scope.IsLedger() {
+		return db.Where("ledger_id = ?", scope.LedgerID)
+	}
+	return db.Where("user_id = ? AND ledger_id = 0", scope.UserID)
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestStorage создаёт хранилище во временной базе SQLite
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := NewStorage(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	return s
+}
+
+func TestAuditLogTransactionLifecycle(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Now()
+	purchase := &Transaction{UserID: 1, Amount: -500, Comment: "такси", Category: "Прочее", TransactionDate: now}
+	other := &Transaction{UserID: 1, Amount: -300, Comment: "кофе", Category: "Прочее", TransactionDate: now}
+
+	// Шаги выполняются по порядку; после каждого проверяется вся история покупки
+	steps := []struct {
+		name    string
+		do      func() error
+		actions []string
+		actor   int64  // Автор последней записи
+		changed string // Столбец, изменение которого должна показать последняя запись
+	}{
+		{
+			name: "создание",
+			do: func() error {
+				if err := s.SaveTransaction(other); err != nil {
+					return err
+				}
+				return s.SaveTransaction(purchase)
+			},
+			actions: []string{AuditCreate},
+			actor:   1,
+			changed: "amount",
+		},
+		{
+			name: "изменение одной транзакции",
+			do: func() error {
+				_, err := s.UpdateTransactionCategory(1, purchase.ID, "Транспорт")
+				return err
+			},
+			actions: []string{AuditCreate, AuditUpdate},
+			actor:   1,
+			changed: "category",
+		},
+		{
+			name: "массовое изменение",
+			do: func() error {
+				return s.As(2).db.Model(&Transaction{}).Where("user_id = ?", 1).Update("merchant", "Яндекс").Error
+			},
+			actions: []string{AuditCreate, AuditUpdate, AuditUpdate},
+			actor:   2,
+			changed: "merchant",
+		},
+		{
+			name: "изменение без изменений",
+			do: func() error {
+				return s.db.Model(&Transaction{}).Where("id = ?", purchase.ID).Update("merchant", "Яндекс").Error
+			},
+			actions: []string{AuditCreate, AuditUpdate, AuditUpdate},
+			actor:   2,
+			changed: "merchant",
+		},
+		{
+			name: "удаление в корзину",
+			do: func() error {
+				_, err := s.DeleteTransactions(PersonalScope(1), 1, []uint{purchase.ID})
+				return err
+			},
+			actions: []string{AuditCreate, AuditUpdate, AuditUpdate, AuditDelete},
+			actor:   1,
+			changed: "deleted_at",
+		},
+		{
+			name: "восстановление из корзины",
+			do: func() error {
+				_, err := s.As(3).RestoreTransaction(PersonalScope(1), purchase.ID, 0)
+				return err
+			},
+			actions: []string{AuditCreate, AuditUpdate, AuditUpdate, AuditDelete, AuditRestore},
+			actor:   3,
+			changed: "deleted_at",
+		},
+		{
+			name: "окончательное удаление",
+			do: func() error {
+				if _, err := s.DeleteTransactions(PersonalScope(1), 1, []uint{purchase.ID}); err != nil {
+					return err
+				}
+				_, err := s.PurgeTrash(now.Add(s.TrashRetention() + time.Hour))
+				return err
+			},
+			actions: []string{AuditCreate, AuditUpdate, AuditUpdate, AuditDelete, AuditRestore, AuditDelete, AuditPurge},
+			actor:   SystemActor,
+			changed: "amount",
+		},
+	}
+
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		entries, err := s.GetTransactionHistory(PersonalScope(1), purchase.ID)
+		if err != nil {
+			t.Fatalf("%s: GetTransactionHistory: %v", step.name, err)
+		}
+		actions := make([]string, len(entries))
+		for i, entry := range entries {
+			actions[i] = entry.Action
+		}
+		if !reflect.DeepEqual(actions, step.actions) {
+			t.Fatalf("%s: действия в журнале %v, ожидалось %v", step.name, actions, step.actions)
+		}
+		last := entries[len(entries)-1]
+		if last.ActorID != step.actor {
+			t.Errorf("%s: автор %d, ожидался %d", step.name, last.ActorID, step.actor)
+		}
+		changes, err := last.Changes()
+		if err != nil {
+			t.Fatalf("%s: Changes: %v", step.name, err)
+		}
+		if _, ok := changes[step.changed]; !ok {
+			t.Errorf("%s: в изменениях %v нет столбца %s", step.name, changes, step.changed)
+		}
+	}
+
+	// Массовое изменение попадает в журнал каждой затронутой транзакции
+	entries, err := s.GetTransactionHistory(PersonalScope(1), other.ID)
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Action != AuditUpdate || entries[1].ActorID != 2 {
+		t.Errorf("журнал второй транзакции %+v, ожидались создание и изменение от автора 2", entries)
+	}
+}
+
+func TestAuditLogTriggers(t *testing.T) {
+	s := newTestStorage(t)
+	for _, userID := range []int64{1, 2} {
+		tr := &Transaction{UserID: userID, Amount: -100, Comment: "обед", Category: "Прочее", TransactionDate: time.Now()}
+		if err := s.SaveTransaction(tr); err != nil {
+			t.Fatalf("SaveTransaction: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"изменение действия", `UPDATE audit_entries SET action = 'delete'`, true},
+		{"изменение состояния", `UPDATE audit_entries SET "after" = '{}'`, true},
+		{"стирание вместе с автором", `UPDATE audit_entries SET "before" = '', "after" = '', actor_id = 5`, true},
+		{"удаление", `DELETE FROM audit_entries`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.db.Exec(tt.query).Error
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ошибка %v, ожидалась ошибка: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := redactAuditLog(s.db, 1); err != nil {
+		t.Fatalf("redactAuditLog: %v", err)
+	}
+	var entries []AuditEntry
+	if err := s.db.Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("чтение журнала: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("в журнале %d записей, ожидалось 2", len(entries))
+	}
+	for _, entry := range entries {
+		redacted := entry.Before == "" && entry.After == ""
+		if redacted != (entry.UserID == 1) {
+			t.Errorf("запись пользователя %d: before %q, after %q", entry.UserID, entry.Before, entry.After)
+		}
+		if entry.Action != AuditCreate || entry.ActorID != entry.UserID {
+			t.Errorf("запись пользователя %d: действие %s от %d, ожидалось create от владельца", entry.UserID, entry.Action, entry.ActorID)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BackupVersion - текущая версия схемы архива.
+// Новые разделы добавляются в Backup как новые поля с omitempty, поэтому архивы
+// старых версий остаются читаемыми. Версия повышается, только если меняется смысл
+// существующих полей; тогда в upgradeBackup добавляется шаг миграции.
+const BackupVersion = 1
+
+// Backup - архив всех данных пользователя для переноса между экземплярами бота
+type Backup struct {
+	Version      int                 `json:"version"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UserID       int64               `json:"user_id"`
+	Transactions []BackupTransaction `json:"transactions"`
+	// Собственные категории доходов пользователя; отсутствуют, если используется список по умолчанию
+	IncomeCategories []string `json:"income_categories,omitempty"`
+	// Личные долги, в том числе погашенные, вместе с историей погашений
+	Loans []BackupLoan `json:"loans,omitempty"`
+	// Цели накоплений вместе с историей взносов
+	Goals []BackupGoal `json:"goals,omitempty"`
+}
+
+// BackupTransaction - транзакция в архиве. Внутренние ID не переносятся,
+// при восстановлении записи получают новые идентификаторы.
+type BackupTransaction struct {
+	Amount          float64   `json:"amount"`
+	Category        string    `json:"category"`
+	Comment         string    `json:"comment"`
+	Merchant        string    `json:"merchant,omitempty"`
+	Tags            []string  `json:"tags,omitempty"`
+	RefundOf        *int      `json:"refund_of,omitempty"` // Номер покупки в списке транзакций архива, если это возврат
+	TransactionDate time.Time `json:"transaction_date"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// BackupLoan - долг в архиве. Погашенная сумма не хранится отдельно: она складывается из погашений.
+type BackupLoan struct {
+	Direction    string            `json:"direction"`
+	Counterparty string            `json:"counterparty"`
+	Amount       float64           `json:"amount"`
+	Comment      string            `json:"comment,omitempty"`
+	DueDate      *time.Time        `json:"due_date,omitempty"`
+	ClosedAt     *time.Time        `json:"closed_at,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Repayments   []BackupRepayment `json:"repayments,omitempty"`
+}
+
+// BackupRepayment - погашение долга в архиве
+type BackupRepayment struct {
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupGoal - цель накоплений в архиве. Отложенная сумма складывается из взносов.
+type BackupGoal struct {
+	Name          string               `json:"name"`
+	Target        float64              `json:"target"`
+	Deadline      *time.Time           `json:"deadline,omitempty"`
+	AchievedAt    *time.Time           `json:"achieved_at,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Contributions []BackupContribution `json:"contributions,omitempty"`
+}
+
+// BackupContribution - взнос в цель в архиве; отрицательная сумма - деньги забрали из цели
+type BackupContribution struct {
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RestoreResult описывает итог восстановления из архива
+type RestoreResult struct {
+	Deleted  int64 // Удалено существующих транзакций (в режиме замены)
+	Restored int   // Добавлено транзакций из архива
+	Skipped  int   // Пропущено транзакций, которые уже есть в базе (в режиме слияния)
+	Loans    int   // Добавлено долгов из архива
+	Goals    int   // Добавлено целей из архива
+}
+
+// CreateBackup собирает архив всех данных пользователя
+func (s *Storage) CreateBackup(userID int64) (*Backup, error) {
+	transactions, err := s.GetAllTransactions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		Version:      BackupVersion,
+		CreatedAt:    time.Now(),
+		UserID:       userID,
+		Transactions: make([]BackupTransaction, 0, len(transactions)),
+	}
+	// Связь возврата с покупкой сохраняется номером покупки в архиве, а не внутренним ID
+	indexByID := make(map[uint]int, len(transactions))
+	for i, tr := range transactions {
+		indexByID[tr.ID] = i
+	}
+	for _, tr := range transactions {
+		var refundOf *int
+		if tr.RefundOfID != nil {
+			if index, ok := indexByID[*tr.RefundOfID]; ok {
+				refundOf = &index
+			}
+		}
+		backup.Transactions = append(backup.Transactions, BackupTransaction{
+			Amount:          tr.Amount,
+			Category:        tr.Category,
+			Comment:         tr.Comment,
+			Merchant:        tr.Merchant,
+			Tags:            tr.TagNames(),
+			TransactionDate: tr.TransactionDate,
+			CreatedAt:       tr.CreatedAt,
+			RefundOf:        refundOf,
+		})
+	}
+	backup.IncomeCategories, err = s.GetCategories(userID, CategoryIncome)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Loans, err = s.backupLoans(userID); err != nil {
+		return nil, err
+	}
+	if backup.Goals, err = s.backupGoals(userID); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// backupGoals собирает цели пользователя со взносами для архива
+func (s *Storage) backupGoals(userID int64) ([]BackupGoal, error) {
+	goals, err := s.GetGoals(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BackupGoal, 0, len(goals))
+	for _, goal := range goals {
+		contributions, err := s.GetGoalContributions(goal.ID)
+		if err != nil {
+			return nil, err
+		}
+		item := BackupGoal{
+			Name:       goal.Name,
+			Target:     goal.Target,
+			Deadline:   goal.Deadline,
+			AchievedAt: goal.AchievedAt,
+			CreatedAt:  goal.CreatedAt,
+		}
+		for _, contribution := range contributions {
+			item.Contributions = append(item.Contributions, BackupContribution{Amount: contribution.Amount, CreatedAt: contribution.CreatedAt})
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// backupLoans собирает все долги пользователя с погашениями для архива
+func (s *Storage) backupLoans(userID int64) ([]BackupLoan, error) {
+	var loans []Loan
+	if err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	result := make([]BackupLoan, 0, len(loans))
+	for _, loan := range loans {
+		var repayments []LoanRepayment
+		if err := s.db.Where("loan_id = ?", loan.ID).Order("created_at, id").Find(&repayments).Error; err != nil {
+			return nil, err
+		}
+		item := BackupLoan{
+			Direction:    loan.Direction,
+			Counterparty: loan.Counterparty,
+			Amount:       loan.Amount,
+			Comment:      loan.Comment,
+			DueDate:      loan.DueDate,
+			ClosedAt:     loan.ClosedAt,
+			CreatedAt:    loan.CreatedAt,
+		}
+		for _, repayment := range repayments {
+			item.Repayments = append(item.Repayments, BackupRepayment{Amount: repayment.Amount, CreatedAt: repayment.CreatedAt})
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// ValidateBackup проверяет версию схемы архива и приводит его к текущей версии
+func ValidateBackup(backup *Backup) error {
+	if backup.Version < 1 {
+		return fmt.Errorf("в архиве не указана версия схемы")
+	}
+	if backup.Version > BackupVersion {
+		return fmt.Errorf("архив создан более новой версией бота (схема %d, поддерживается до %d)", backup.Version, BackupVersion)
+	}
+	upgradeBackup(backup)
+
+	for i, tr := range backup.Transactions {
+		if tr.TransactionDate.IsZero() {
+			return fmt.Errorf("транзакция №%d: не указана дата", i+1)
+		}
+		if tr.Amount == 0 {
+			return fmt.Errorf("транзакция №%d: нулевая сумма", i+1)
+		}
+		if tr.RefundOf != nil && (*tr.RefundOf < 0 || *tr.RefundOf >= len(backup.Transactions) || *tr.RefundOf == i) {
+			return fmt.Errorf("транзакция №%d: ссылка на несуществующую покупку", i+1)
+		}
+	}
+	for i, loan := range backup.Loans {
+		if loan.Direction != LoanLent && loan.Direction != LoanBorrowed {
+			return fmt.Errorf("долг №%d: неизвестное направление %q", i+1, loan.Direction)
+		}
+		if loan.Amount <= 0 {
+			return fmt.Errorf("долг №%d: сумма должна быть положительной", i+1)
+		}
+		var repaid float64
+		for _, repayment := range loan.Repayments {
+			if repayment.Amount <= 0 {
+				return fmt.Errorf("долг №%d: сумма погашения должна быть положительной", i+1)
+			}
+			repaid += repayment.Amount
+		}
+		if repaid > loan.Amount+0.005 {
+			return fmt.Errorf("долг №%d: погашено больше суммы долга", i+1)
+		}
+	}
+	tags := make(map[string]bool, len(backup.Goals))
+	for i, goal := range backup.Goals {
+		tag := NormalizeTag(goal.Name)
+		if tag == "" {
+			return fmt.Errorf("цель №%d: не указано название", i+1)
+		}
+		if tags[tag] {
+			return fmt.Errorf("цель №%d: цель «%s» указана дважды", i+1, goal.Name)
+		}
+		tags[tag] = true
+		if goal.Target <= 0 {
+			return fmt.Errorf("цель №%d: сумма цели должна быть положительной", i+1)
+		}
+		var saved float64
+		for _, contribution := range goal.Contributions {
+			saved += contribution.Amount
+		}
+		if saved < -0.005 {
+			return fmt.Errorf("цель №%d: из цели забрали больше, чем отложили", i+1)
+		}
+	}
+	return nil
+}
+
+// upgradeBackup последовательно применяет миграции схемы архива до BackupVersion
+func upgradeBackup(backup *Backup) {
+	// Пока существует только первая версия схемы, миграций нет.
+	backup.Version = BackupVersion
+}
+
+// RestoreBackup восстанавливает данные пользователя из архива в одной транзакции БД.
+// В режиме замены (replace) существующие личные транзакции пользователя, включая корзину,
+// удаляются безвозвратно: иначе их можно было бы вернуть из корзины поверх восстановленных.
+// В режиме слияния добавляются только записи, которых ещё нет в базе.
+func (s *Storage) RestoreBackup(userID int64, backup *Backup, replace bool) (RestoreResult, error) {
+	var result RestoreResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			var ids []uint
+			if err := PersonalScope(userID).apply(tx.Unscoped().Model(&Transaction{})).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			deleted, err := purgeTransactions(tx, ids)
+			if err != nil {
+				return err
+			}
+			result.Deleted = deleted
+			if len(backup.IncomeCategories) > 0 {
+				if err := tx.Where("user_id = ? AND kind = ?", userID, CategoryIncome).Delete(&Category{}).Error; err != nil {
+					return err
+				}
+			}
+			if len(backup.Loans) > 0 {
+				if err := tx.Where("loan_id IN (?)", tx.Model(&Loan{}).Select("id").Where("user_id = ?", userID)).Delete(&LoanRepayment{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("user_id = ?", userID).Delete(&Loan{}).Error; err != nil {
+					return err
+				}
+			}
+			if len(backup.Goals) > 0 {
+				if err := tx.Where("goal_id IN (?)", tx.Model(&Goal{}).Select("id").Where("user_id = ?", userID)).Delete(&GoalContribution{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("user_id = ?", userID).Delete(&Goal{}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := addCategories(tx, userID, CategoryIncome, backup.IncomeCategories); err != nil {
+			return err
+		}
+
+		// ID транзакций в базе по номерам в архиве, чтобы восстановить связи возвратов с покупками
+		ids := make([]uint, len(backup.Transactions))
+		for i, tr := range backup.Transactions {
+			if !replace {
+				var existing []uint
+				err := tx.Model(&Transaction{}).
+					Where("user_id = ? AND ledger_id = 0 AND transaction_date = ? AND amount = ? AND comment = ? AND category = ?",
+						userID, tr.TransactionDate, tr.Amount, tr.Comment, tr.Category).
+					Limit(1).Pluck("id", &existing).Error
+				if err != nil {
+					return err
+				}
+				if len(existing) > 0 {
+					ids[i] = existing[0]
+					result.Skipped++
+					continue
+				}
+			}
+
+			transaction := &Transaction{
+				UserID:          userID,
+				Amount:          tr.Amount,
+				Category:        tr.Category,
+				Comment:         tr.Comment,
+				Merchant:        tr.Merchant,
+				TransactionDate: tr.TransactionDate,
+				Tags:            TagsFromNames(tr.Tags),
+			}
+			if !tr.CreatedAt.IsZero() {
+				transaction.CreatedAt = tr.CreatedAt
+			}
+			if err := resolveTags(tx, transaction.Tags); err != nil {
+				return err
+			}
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+			ids[i] = transaction.ID
+			result.Restored++
+		}
+
+		for i, tr := range backup.Transactions {
+			if tr.RefundOf == nil {
+				continue
+			}
+			if err := tx.Model(&Transaction{}).Where("id = ?", ids[i]).Update("refund_of_id", ids[*tr.RefundOf]).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if result.Loans, err = restoreLoans(tx, userID, backup.Loans, replace); err != nil {
+			return err
+		}
+		result.Goals, err = restoreGoals(tx, userID, backup.Goals)
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка восстановления архива для UserID %d, изменения отменены: %v", userID, err)
+		return RestoreResult{}, err
+	}
+	return result, nil
+}
+
+// restoreLoans добавляет долги из архива вместе с погашениями. В режиме слияния долг,
+// который уже есть в базе (то же направление, человек, сумма и время записи), пропускается.
+// Возвращает число добавленных долгов.
+func restoreLoans(tx *gorm.DB, userID int64, loans []BackupLoan, replace bool) (int, error) {
+	restored := 0
+	for _, item := range loans {
+		if !replace {
+			var count int64
+			err := tx.Model(&Loan{}).
+				Where("user_id = ? AND direction = ? AND counterparty = ? AND amount = ? AND created_at = ?",
+					userID, item.Direction, item.Counterparty, item.Amount, item.CreatedAt).
+				Count(&count).Error
+			if err != nil {
+				return restored, err
+			}
+			if count > 0 {
+				continue
+			}
+		}
+
+		loan := &Loan{
+			UserID:       userID,
+			Direction:    item.Direction,
+			Counterparty: item.Counterparty,
+			Amount:       item.Amount,
+			Comment:      item.Comment,
+			DueDate:      item.DueDate,
+			ClosedAt:     item.ClosedAt,
+			CreatedAt:    item.CreatedAt,
+		}
+		for _, repayment := range item.Repayments {
+			loan.Repaid += repayment.Amount
+		}
+		loan.Repaid = math.Round(loan.Repaid*100) / 100
+		if err := tx.Create(loan).Error; err != nil {
+			return restored, err
+		}
+		for _, repaid := range item.Repayments {
+			repayment := &LoanRepayment{LoanID: loan.ID, Amount: repaid.Amount, CreatedAt: repaid.CreatedAt}
+			if err := tx.Create(repayment).Error; err != nil {
+				return restored, err
+			}
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// restoreGoals добавляет цели из архива вместе со взносами. Цель с тем же тегом,
+// которая уже есть у пользователя, пропускается: теги целей уникальны.
+// Возвращает число добавленных целей.
+func restoreGoals(tx *gorm.DB, userID int64, goals []BackupGoal) (int, error) {
+	restored := 0
+	for _, item := range goals {
+		tag := NormalizeTag(item.Name)
+		var count int64
+		if err := tx.Model(&Goal{}).Where("user_id = ? AND tag = ?", userID, tag).Count(&count).Error; err != nil {
+			return restored, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		goal := &Goal{
+			UserID:     userID,
+			Tag:        tag,
+			Name:       item.Name,
+			Target:     item.Target,
+			Deadline:   item.Deadline,
+			AchievedAt: item.AchievedAt,
+			CreatedAt:  item.CreatedAt,
+		}
+		for _, contribution := range item.Contributions {
+			goal.Saved += contribution.Amount
+		}
+		goal.Saved = math.Round(goal.Saved*100) / 100
+		if err := tx.Create(goal).Error; err != nil {
+			return restored, err
+		}
+		for _, contributed := range item.Contributions {
+			contribution := &GoalContribution{GoalID: goal.ID, Amount: contributed.Amount, CreatedAt: contributed.CreatedAt}
+			if err := tx.Create(contribution).Error; err != nil {
+				return restored, err
+			}
+		}
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Виды категорий
+const (
+	CategoryExpense = "expense"
+	CategoryIncome  = "income"
+)
+
+// ErrCategoryExists возвращается при добавлении категории, которая уже есть у пользователя
+var ErrCategoryExists = errors.New("такая категория уже есть")
+
+// Category - пользовательская категория. Пока у пользователя нет своих категорий
+// какого-либо вида, бот использует для этого вида список по умолчанию.
+type Category struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    int64  `gorm:"uniqueIndex:idx_category_user_kind_name"`
+	Kind      string `gorm:"uniqueIndex:idx_category_user_kind_name"` // CategoryExpense или CategoryIncome
+	Name      string `gorm:"uniqueIndex:idx_category_user_kind_name"`
+	CreatedAt time.Time
+}
+
+// GetCategories возвращает названия категорий пользователя указанного вида в порядке добавления
+func (s *Storage) GetCategories(userID int64, kind string) ([]string, error) {
+	var names []string
+	result := s.db.Model(&Category{}).Where("user_id = ? AND kind = ?", userID, kind).Order("id").Pluck("name", &names)
+	return names, result.Error
+}
+
+// AddCategories добавляет категории, пропуская уже существующие
+func (s *Storage) AddCategories(userID int64, kind string, names []string) error {
+	return addCategories(s.db, userID, kind, names)
+}
+
+// addCategories добавляет категории в рамках переданного соединения или транзакции БД
+func addCategories(db *gorm.DB, userID int64, kind string, names []string) error {
+	for _, name := range names {
+		category := Category{UserID: userID, Kind: kind, Name: name}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&category).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCategory добавляет одну категорию пользователю
+func (s *Storage) AddCategory(userID int64, kind, name string) error {
+	var count int64
+	if err := s.db.Model(&Category{}).Where("user_id = ? AND kind = ? AND name = ?", userID, kind, name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategoryExists
+	}
+	return s.db.Create(&Category{UserID: userID, Kind: kind, Name: name}).Error
+}
+
+// DeleteCategory удаляет категорию пользователя. Транзакции с этой категорией не изменяются.
+// Возвращает false, если такой категории не было.
+func (s *Storage) DeleteCategory(userID int64, kind, name string) (bool, error) {
+	result := s.db.Where("user_id = ? AND kind = ? AND name = ?", userID, kind, name).Delete(&Category{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultClassificationCacheTTL - сколько по умолчанию хранится категория, определённая для комментария
+const DefaultClassificationCacheTTL = 30 * 24 * time.Hour
+
+// ClassificationCache - категория, ранее определённая для комментария пользователя.
+// Комментарий хранится в нормализованном виде: "Кофе!" и "кофе" - одна запись.
+type ClassificationCache struct {
+	UserID     int64  `gorm:"primaryKey;autoIncrement:false"`
+	Comment    string `gorm:"primaryKey"`
+	Category   string
+	Merchant   string
+	Confidence float64
+	UpdatedAt  time.Time
+}
+
+// PendingClassification - транзакция, которую не удалось классифицировать из-за недоступности AI.
+// Фоновый обработчик повторяет классификацию и сообщает пользователю итоговую категорию в чат ChatID.
+type PendingClassification struct {
+	ID            uint `gorm:"primarykey"`
+	TransactionID uint `gorm:"uniqueIndex"`
+	UserID        int64
+	ChatID        int64
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// SetClassificationCacheTTL задаёт срок жизни записей кеша категорий
+func (s *Storage) SetClassificationCacheTTL(ttl time.Duration) {
+	s.cacheTTL = ttl
+}
+
+// GetCachedClassification возвращает категорию, ранее определённую для такого же комментария.
+// Если записи нет или она устарела, возвращается nil без ошибки.
+func (s *Storage) GetCachedClassification(userID int64, comment string) (*ClassificationCache, error) {
+	key := NormalizeComment(comment)
+	if key == "" {
+		return nil, nil
+	}
+	var entry ClassificationCache
+	err := s.db.Where("user_id = ? AND comment = ? AND updated_at > ?", userID, key, time.Now().Add(-s.cacheTTL)).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SaveCachedClassification запоминает категорию для комментария, заменяя прежнюю запись
+func (s *Storage) SaveCachedClassification(userID int64, comment, category, merchant string, confidence float64) error {
+	key := NormalizeComment(comment)
+	if key == "" {
+		return nil
+	}
+	entry := ClassificationCache{
+		UserID:     userID,
+		Comment:    key,
+		Category:   category,
+		Merchant:   merchant,
+		Confidence: confidence,
+		UpdatedAt:  time.Now(),
+	}
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+}
+
+// NormalizeComment приводит комментарий к виду для поиска в кеше и сравнения комментариев:
+// нижний регистр, ё заменена на е, без знаков препинания и лишних пробелов
+func NormalizeComment(comment string) string {
+	comment = strings.ReplaceAll(strings.ToLower(comment), "ё", "е")
+	words := strings.FieldsFunc(comment, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// AddPendingClassification ставит транзакцию в очередь на повторную классификацию
+func (s *Storage) AddPendingClassification(transactionID uint, userID, chatID int64) error {
+	pending := PendingClassification{
+		TransactionID: transactionID,
+		UserID:        userID,
+		ChatID:        chatID,
+		NextAttemptAt: time.Now(),
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&pending).Error
+}
+
+// GetDuePendingClassifications возвращает транзакции из очереди, для которых пришло время повторить классификацию
+func (s *Storage) GetDuePendingClassifications(now time.Time, limit int) ([]PendingClassification, error) {
+	var pending []PendingClassification
+	result := s.db.Where("next_attempt_at <= ?", now).Order("next_attempt_at").Limit(limit).Find(&pending)
+	return pending, result.Error
+}
+
+// PostponePendingClassification откладывает следующую попытку классификации
+func (s *Storage) PostponePendingClassification(pending *PendingClassification, next time.Time) error {
+	pending.Attempts++
+	pending.NextAttemptAt = next
+	return s.db.Model(pending).Updates(map[string]interface{}{"attempts": pending.Attempts, "next_attempt_at": next}).Error
+}
+
+// DeletePendingClassification убирает транзакцию из очереди
+func (s *Storage) DeletePendingClassification(pending *PendingClassification) error {
+	return s.db.Delete(pending).Error
+}
+
+// ResolvePendingClassification сохраняет категорию транзакции из очереди и убирает её из очереди.
+// Категорию назначает бот, поэтому в журнале изменений автор - SystemActor.
+func (s *Storage) ResolvePendingClassification(pending *PendingClassification, category, merchant string) error {
+	return s.As(SystemActor).db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Transaction{}).Where("id = ? AND user_id = ?", pending.TransactionID, pending.UserID).
+			Updates(map[string]interface{}{"category": category, "merchant": merchant}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(pending).Error
+	})
+}
+
+// GetTransaction возвращает транзакцию пользователя по ID
+func (s *Storage) GetTransaction(userID int64, id uint) (*Transaction, error) {
+	var transaction Transaction
+	if err := s.db.Where("user_id = ?", userID).First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EditPrompt - сообщение бота с просьбой прислать новые сумму и комментарий транзакции.
+// Ответ на это сообщение заменяет транзакцию; ответить может только тот, кто начал изменение.
+type EditPrompt struct {
+	ChatID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	MessageID     int   `gorm:"primaryKey;autoIncrement:false"`
+	UserID        int64
+	TransactionID uint
+	CreatedAt     time.Time
+}
+
+// SaveEditPrompt запоминает, что ответ на сообщение изменяет транзакцию
+func (s *Storage) SaveEditPrompt(prompt *EditPrompt) error {
+	return s.db.Create(prompt).Error
+}
+
+// GetEditPrompt возвращает запрос на изменение транзакции по сообщению бота или nil, если сообщение не такое
+func (s *Storage) GetEditPrompt(chatID int64, messageID int) (*EditPrompt, error) {
+	var prompts []EditPrompt
+	if err := s.db.Where("chat_id = ? AND message_id = ?", chatID, messageID).Limit(1).Find(&prompts).Error; err != nil {
+		return nil, err
+	}
+	if len(prompts) == 0 {
+		return nil, nil
+	}
+	return &prompts[0], nil
+}
+
+// GetScopedTransaction возвращает транзакцию области scope вместе с тегами и долями участников
+func (s *Storage) GetScopedTransaction(scope Scope, id uint) (*Transaction, error) {
+	var transaction Transaction
+	if err := scope.apply(s.db).Preload("Tags").Preload("Splits").First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// UpdateTransaction сохраняет новые сумму, комментарий, категорию, продавца и теги транзакции.
+// Автора изменения для журнала изменений задаёт As.
+func (s *Storage) UpdateTransaction(transaction *Transaction) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := resolveTags(tx, transaction.Tags); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"amount":   transaction.Amount,
+			"comment":  transaction.Comment,
+			"category": transaction.Category,
+			"merchant": transaction.Merchant,
+		}
+		if err := tx.Model(transaction).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Model(transaction).Association("Tags").Replace(transaction.Tags)
+	})
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TransactionType определяет, какие транзакции попадают в выборку: все, только расходы или только доходы
+type TransactionType string
+
+const (
+	TypeAll     TransactionType = ""
+	TypeExpense TransactionType = "expense"
+	TypeIncome  TransactionType = "income"
+)
+
+// TransactionFilter описывает условия выборки транзакций для отчётов и экспорта.
+// Нулевые значения полей означают отсутствие ограничения.
+type TransactionFilter struct {
+	From     time.Time       // Начало периода (включительно)
+	To       time.Time       // Конец периода (включительно)
+	Category string          // Точное название категории
+	Type     TransactionType // Тип транзакций
+	Tags     []string        // Теги, которые должны быть у транзакции одновременно
+}
+
+// apply добавляет условия фильтра к запросу
+func (f TransactionFilter) apply(q *gorm.DB) *gorm.DB {
+	if !f.From.IsZero() {
+		q = q.Where("transaction_date >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("transaction_date <= ?", f.To)
+	}
+	if f.Category != "" {
+		q = q.Where("category = ?", f.Category)
+	}
+	for _, tag := range f.Tags {
+		q = q.Where("id IN (SELECT transaction_tags.transaction_id FROM transaction_tags JOIN tags ON tags.id = transaction_tags.tag_id WHERE tags.name = ?)", NormalizeTag(tag))
+	}
+	switch f.Type {
+	case TypeExpense:
+		// Возвраты уменьшают расходы, поэтому входят в выборку расходов
+		q = q.Where("(amount < 0 OR refund_of_id IS NOT NULL)")
+	case TypeIncome:
+		q = q.Where("amount > 0 AND refund_of_id IS NULL")
+	}
+	return q
+}
+
+// GetTransactionsByFilter возвращает транзакции области scope, удовлетворяющие фильтру, в хронологическом порядке.
+// Теги транзакций загружаются вместе с ними.
+func (s *Storage) GetTransactionsByFilter(scope Scope, filter TransactionFilter) ([]Transaction, error) {
+	var transactions []Transaction
+	result := filter.apply(scope.apply(s.db)).Preload("Tags").Order("transaction_date").Find(&transactions)
+	return transactions, result.Error
+}
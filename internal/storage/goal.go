@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrGoalExists возвращается при создании цели с уже занятым тегом
+	ErrGoalExists = errors.New("цель с таким названием уже есть")
+	// ErrGoalOverdrawn возвращается, если из цели забирают больше, чем в ней отложено
+	ErrGoalOverdrawn = errors.New("в цели отложено меньше этой суммы")
+)
+
+// Goal - цель накоплений. Взносы в цель не являются расходами: деньги не тратятся,
+// а откладываются, поэтому хранятся отдельно от транзакций.
+type Goal struct {
+	ID         uint   `gorm:"primarykey"`
+	UserID     int64  `gorm:"uniqueIndex:idx_goal_user_tag"`
+	Tag        string `gorm:"uniqueIndex:idx_goal_user_tag"` // Тег для взносов: #отпуск
+	Name       string
+	Target     float64    // Сколько нужно накопить
+	Saved      float64    // Сколько уже отложено
+	Deadline   *time.Time // К какому сроку, если он указан
+	AchievedAt *time.Time // Когда цель достигнута
+	CreatedAt  time.Time
+}
+
+// GoalContribution - взнос в цель; отрицательная сумма означает, что деньги забрали из цели
+type GoalContribution struct {
+	ID        uint `gorm:"primarykey"`
+	GoalID    uint `gorm:"index"`
+	Amount    float64
+	CreatedAt time.Time
+}
+
+// NormalizeTag приводит тег к виду, в котором он хранится: без #, в нижнем регистре, пробелы заменены на _
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+	return strings.Join(strings.Fields(tag), "_")
+}
+
+// CreateGoal сохраняет новую цель; тег вычисляется из названия
+func (s *Storage) CreateGoal(goal *Goal) error {
+	goal.Tag = NormalizeTag(goal.Name)
+	var count int64
+	if err := s.db.Model(&Goal{}).Where("user_id = ? AND tag = ?", goal.UserID, goal.Tag).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrGoalExists
+	}
+	return s.db.Create(goal).Error
+}
+
+// GetGoals возвращает цели пользователя в порядке создания
+func (s *Storage) GetGoals(userID int64) ([]Goal, error) {
+	var goals []Goal
+	result := s.db.Where("user_id = ?", userID).Order("id").Find(&goals)
+	return goals, result.Error
+}
+
+// GetGoalByTag возвращает цель пользователя по тегу или nil, если такой цели нет
+func (s *Storage) GetGoalByTag(userID int64, tag string) (*Goal, error) {
+	var goal Goal
+	err := s.db.Where("user_id = ? AND tag = ?", userID, NormalizeTag(tag)).First(&goal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+// DeleteGoal удаляет цель пользователя вместе с историей взносов
+func (s *Storage) DeleteGoal(userID int64, goalID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ?", userID).Delete(&Goal{}, goalID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("goal_id = ?", goalID).Delete(&GoalContribution{}).Error
+	})
+}
+
+// AddGoalContribution записывает взнос в цель и возвращает цель после него.
+// Забрать из цели больше, чем в ней отложено, нельзя. Когда накопленная сумма впервые
+// достигает целевой, цель отмечается достигнутой.
+func (s *Storage) AddGoalContribution(goalID uint, amount float64) (*Goal, error) {
+	var goal Goal
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&goal, goalID).Error; err != nil {
+			return err
+		}
+		saved := math.Round((goal.Saved+amount)*100) / 100
+		if saved < 0 {
+			return ErrGoalOverdrawn
+		}
+		if err := tx.Create(&GoalContribution{GoalID: goal.ID, Amount: amount}).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"saved": saved}
+		goal.Saved = saved
+		if goal.AchievedAt == nil && saved >= goal.Target {
+			now := time.Now()
+			goal.AchievedAt = &now
+			updates["achieved_at"] = now
+		}
+		return tx.Model(&goal).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+// GetGoalContributions возвращает взносы в цель в хронологическом порядке
+func (s *Storage) GetGoalContributions(goalID uint) ([]GoalContribution, error) {
+	var contributions []GoalContribution
+	result := s.db.Where("goal_id = ?", goalID).Order("created_at, id").Find(&contributions)
+	return contributions, result.Error
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"time"
+)
+
+// CategoryTotal - сумма расходов в одной категории за период
+type CategoryTotal struct {
+	Category string
+	Total    float64 // Сумма расходов, отрицательное число
+	Count    int
+}
+
+// InsightDelivery отмечает, что обзор за месяц уже отправлен пользователю
+type InsightDelivery struct {
+	ID     uint   `gorm:"primarykey"`
+	UserID int64  `gorm:"uniqueIndex:idx_insight_user_month"`
+	Month  string `gorm:"uniqueIndex:idx_insight_user_month"` // Месяц в формате 2006-01
+	SentAt time.Time
+}
+
+// GetExpenseTotalsByCategory возвращает суммы расходов области scope по категориям за период за вычетом возвратов
+func (s *Storage) GetExpenseTotalsByCategory(scope Scope, from, to time.Time) ([]CategoryTotal, error) {
+	var totals []CategoryTotal
+	result := scope.apply(s.db.Model(&Transaction{})).
+		Select("category, SUM(amount) AS total, COUNT(*) AS count").
+		Where("(amount < 0 OR refund_of_id IS NOT NULL) AND transaction_date BETWEEN ? AND ?", from, to).
+		Group("category").
+		Order("total").
+		Scan(&totals)
+	return totals, result.Error
+}
+
+// GetUserIDs возвращает идентификаторы всех пользователей, у которых есть личные транзакции
+func (s *Storage) GetUserIDs() ([]int64, error) {
+	var userIDs []int64
+	result := s.db.Model(&Transaction{}).Where("ledger_id = 0").Distinct("user_id").Pluck("user_id", &userIDs)
+	return userIDs, result.Error
+}
+
+// IsInsightSent сообщает, отправлялся ли пользователю обзор за указанный месяц
+func (s *Storage) IsInsightSent(userID int64, month string) (bool, error) {
+	var count int64
+	result := s.db.Model(&InsightDelivery{}).Where("user_id = ? AND month = ?", userID, month).Count(&count)
+	return count > 0, result.Error
+}
+
+// MarkInsightSent отмечает, что обзор за месяц отправлен пользователю
+func (s *Storage) MarkInsightSent(userID int64, month string) error {
+	return s.db.Create(&InsightDelivery{UserID: userID, Month: month, SentAt: time.Now()}).Error
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Роли участников общей книги
+const (
+	RoleOwner  = "owner"  // Управляет участниками, добавляет и удаляет транзакции
+	RoleEditor = "editor" // Добавляет транзакции и смотрит отчёты
+	RoleViewer = "viewer" // Только смотрит отчёты
+)
+
+// roleRank упорядочивает роли по объёму прав
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// ErrLastOwner возвращается при попытке удалить или понизить единственного владельца книги
+var ErrLastOwner = errors.New("у книги должен остаться хотя бы один владелец")
+
+// ValidRole сообщает, существует ли роль
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAllows сообщает, достаточно ли роли role для действия, требующего роли need
+func RoleAllows(role, need string) bool {
+	return roleRank[role] >= roleRank[need]
+}
+
+// Ledger - общая книга учёта группового чата. Транзакции участников, отправленные в группе,
+// записываются в книгу группы, а автор транзакции сохраняется в её UserID.
+type Ledger struct {
+	ID        uint  `gorm:"primarykey"`
+	ChatID    int64 `gorm:"uniqueIndex"`
+	Title     string
+	CreatedAt time.Time
+}
+
+// LedgerMember - участник общей книги и его роль
+type LedgerMember struct {
+	ID        uint   `gorm:"primarykey"`
+	LedgerID  uint   `gorm:"uniqueIndex:idx_ledger_member"`
+	UserID    int64  `gorm:"uniqueIndex:idx_ledger_member"`
+	Name      string // Имя для отчётов: @username или имя в Telegram
+	Role      string
+	CreatedAt time.Time
+}
+
+// GetOrCreateLedger возвращает книгу группового чата. Если книги ещё нет, она создаётся,
+// а пользователь, первым обратившийся к боту в группе, становится её владельцем.
+func (s *Storage) GetOrCreateLedger(chatID int64, title string, creatorID int64, creatorName string) (*Ledger, error) {
+	var ledger Ledger
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("chat_id = ?", chatID).First(&ledger).Error
+		if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ledger = Ledger{ChatID: chatID, Title: title}
+		if err := tx.Create(&ledger).Error; err != nil {
+			return err
+		}
+		return tx.Create(&LedgerMember{LedgerID: ledger.ID, UserID: creatorID, Name: creatorName, Role: RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+// GetLedgerMember возвращает участника книги или nil, если пользователь в книге не состоит
+func (s *Storage) GetLedgerMember(ledgerID uint, userID int64) (*LedgerMember, error) {
+	var member LedgerMember
+	err := s.db.Where("ledger_id = ? AND user_id = ?", ledgerID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetLedgerMembers возвращает всех участников книги: сначала владельцы, затем редакторы и зрители
+func (s *Storage) GetLedgerMembers(ledgerID uint) ([]LedgerMember, error) {
+	var members []LedgerMember
+	result := s.db.Where("ledger_id = ?", ledgerID).
+		Order("CASE role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, id").
+		Find(&members)
+	return members, result.Error
+}
+
+// SetLedgerMember добавляет участника в книгу или меняет его роль
+func (s *Storage) SetLedgerMember(ledgerID uint, userID int64, name, role string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if role != RoleOwner {
+			if err := ensureAnotherOwner(tx, ledgerID, userID); err != nil {
+				return err
+			}
+		}
+		member := LedgerMember{LedgerID: ledgerID, UserID: userID, Name: name, Role: role}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "ledger_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "role"}),
+		}).Create(&member).Error
+	})
+}
+
+// RemoveLedgerMember исключает участника из книги. Его транзакции остаются в книге.
+// Возвращает false, если пользователь в книге не состоял.
+func (s *Storage) RemoveLedgerMember(ledgerID uint, userID int64) (bool, error) {
+	var removed bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureAnotherOwner(tx, ledgerID, userID); err != nil {
+			return err
+		}
+		result := tx.Where("ledger_id = ? AND user_id = ?", ledgerID, userID).Delete(&LedgerMember{})
+		removed = result.RowsAffected > 0
+		return result.Error
+	})
+	return removed, err
+}
+
+// ensureAnotherOwner проверяет, что после понижения или удаления пользователя у книги останется владелец
+func ensureAnotherOwner(tx *gorm.DB, ledgerID uint, userID int64) error {
+	var current LedgerMember
+	err := tx.Where("ledger_id = ? AND user_id = ?", ledgerID, userID).First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && current.Role != RoleOwner) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var owners int64
+	if err := tx.Model(&LedgerMember{}).Where("ledger_id = ? AND role = ?", ledgerID, RoleOwner).Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Направления долга
+const (
+	LoanLent     = "lent"     // Пользователь дал в долг, деньги должны вернуть ему
+	LoanBorrowed = "borrowed" // Пользователь взял в долг и должен вернуть сам
+)
+
+const (
+	// loanReminderLead - за сколько до срока напоминать о долге. Срок хранится как конец дня,
+	// поэтому напоминание приходит в течение дня накануне срока.
+	loanReminderLead = 48 * time.Hour
+	// loanReminderInterval - как часто повторять напоминание о просроченном долге
+	loanReminderInterval = 7 * 24 * time.Hour
+)
+
+// ErrRepaymentTooLarge возвращается, если погашение больше остатка долга
+var ErrRepaymentTooLarge = errors.New("сумма погашения больше остатка долга")
+
+// Loan - личный долг: деньги, данные или взятые в долг. Долги не являются доходами
+// или расходами и не меняют баланс, но учитываются в деньгах пользователя на руках.
+type Loan struct {
+	ID           uint  `gorm:"primarykey"`
+	UserID       int64 `gorm:"index"`
+	Direction    string
+	Counterparty string  // С кем связан долг
+	Amount       float64 // Исходная сумма долга, положительное число
+	Repaid       float64 // Сколько уже погашено
+	Comment      string
+	DueDate      *time.Time // Срок возврата, если он указан
+	RemindedAt   *time.Time // Когда последний раз напоминали о сроке
+	ClosedAt     *time.Time // Когда долг погашен полностью
+	CreatedAt    time.Time
+}
+
+// LoanRepayment - частичное или полное погашение долга
+type LoanRepayment struct {
+	ID        uint `gorm:"primarykey"`
+	LoanID    uint `gorm:"index"`
+	Amount    float64
+	CreatedAt time.Time
+}
+
+// Remaining возвращает непогашенный остаток долга
+func (l *Loan) Remaining() float64 {
+	return math.Round((l.Amount-l.Repaid)*100) / 100
+}
+
+// CreateLoan сохраняет новый долг
+func (s *Storage) CreateLoan(loan *Loan) error {
+	return s.db.Create(loan).Error
+}
+
+// GetOpenLoans возвращает непогашенные долги пользователя, старые первыми
+func (s *Storage) GetOpenLoans(userID int64) ([]Loan, error) {
+	var loans []Loan
+	result := s.db.Where("user_id = ? AND closed_at IS NULL", userID).Order("created_at, id").Find(&loans)
+	return loans, result.Error
+}
+
+// RepayLoan записывает погашение долга loanID. Когда остаток становится нулевым, долг закрывается.
+// Возвращает долг после погашения.
+func (s *Storage) RepayLoan(userID int64, loanID uint, amount float64) (*Loan, error) {
+	var loan Loan
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND closed_at IS NULL", userID).First(&loan, loanID).Error; err != nil {
+			return err
+		}
+		if amount > loan.Remaining()+0.005 {
+			return ErrRepaymentTooLarge
+		}
+		if err := tx.Create(&LoanRepayment{LoanID: loan.ID, Amount: amount}).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"repaid": loan.Repaid + amount}
+		loan.Repaid += amount
+		if loan.Remaining() <= 0 {
+			now := time.Now()
+			loan.ClosedAt = &now
+			updates["closed_at"] = now
+		}
+		return tx.Model(&loan).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// GetLoanTotals возвращает непогашенные суммы: сколько должны пользователю и сколько должен он
+func (s *Storage) GetLoanTotals(userID int64) (float64, float64, error) {
+	loans, err := s.GetOpenLoans(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var lent, borrowed float64
+	for _, loan := range loans {
+		if loan.Direction == LoanLent {
+			lent += loan.Remaining()
+		} else {
+			borrowed += loan.Remaining()
+		}
+	}
+	return lent, borrowed, nil
+}
+
+// GetLoansToRemind возвращает непогашенные долги, срок которых наступает завтра или уже прошёл,
+// если о них ещё не напоминали или последнее напоминание было больше недели назад
+func (s *Storage) GetLoansToRemind(now time.Time) ([]Loan, error) {
+	var loans []Loan
+	result := s.db.Where("closed_at IS NULL AND due_date IS NOT NULL AND due_date <= ?", now.Add(loanReminderLead)).
+		Where("reminded_at IS NULL OR reminded_at <= ?", now.Add(-loanReminderInterval)).
+		Order("due_date").
+		Find(&loans)
+	return loans, result.Error
+}
+
+// MarkLoanReminded отмечает, что пользователю напомнили о долге
+func (s *Storage) MarkLoanReminded(loanID uint, at time.Time) error {
+	return s.db.Model(&Loan{}).Where("id = ?", loanID).Update("reminded_at", at).Error
+}
@@ -13,5 +13,27 @@ type Transaction struct {
 	Amount          float64 // Сумма операции (положительная для дохода, отрицательная для расхода)
 	Category        string  // Категория (пока не используем, но оставим на будущее)
 	Comment         string  // Комментарий к операции
+	Merchant        string  // Продавец или сервис, распознанный классификатором
 	TransactionDate time.Time
+	ReceiptID       *uint   `gorm:"index"`                      // Чек, из которого создана транзакция
+	RefundOfID      *uint   `gorm:"index"`                      // Покупка, по которой получен этот возврат
+	LedgerID        uint    `gorm:"index;default:0"`            // Общая книга группы; 0 - личная транзакция UserID
+	Splits          []Split `gorm:"foreignKey:TransactionID"`   // Доли участников, если расход разделён
+	Tags            []Tag   `gorm:"many2many:transaction_tags"` // Теги из комментария
+	DeletionBatchID *uint   `gorm:"index"`                      // Удаление, которым транзакция отправлена в корзину
+}
+
+// Receipt - фискальный чек, по которому созданы транзакции.
+// Фискальные реквизиты уникальны для личных чеков пользователя и для чеков общей книги,
+// это защищает от повторной загрузки чека.
+type Receipt struct {
+	gorm.Model
+	UserID   int64  `gorm:"uniqueIndex:idx_receipt_owner"`
+	LedgerID uint   `gorm:"uniqueIndex:idx_receipt_owner;default:0"` // Общая книга группы; 0 - личный чек UserID
+	FN       string `gorm:"uniqueIndex:idx_receipt_owner"`           // Номер фискального накопителя
+	FD       string `gorm:"uniqueIndex:idx_receipt_owner"`           // Номер фискального документа
+	FP       string `gorm:"uniqueIndex:idx_receipt_owner"`           // Фискальный признак документа
+	Total    float64
+	IssuedAt time.Time
+	Raw      string // Исходная строка из QR-кода
 }
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Метрики, которые можно запросить через SpendingQuery
+const (
+	MetricSum      = "sum"
+	MetricCount    = "count"
+	MetricAverage  = "average"
+	MetricLargest  = "largest"
+	MetricSmallest = "smallest"
+	MetricList     = "list"
+)
+
+// Ограничения запросов, которые формирует модель
+const (
+	maxQueryLimit  = 20
+	maxSearchRunes = 100
+)
+
+// SpendingQuery - структурированный запрос к транзакциям пользователя.
+// Запрос формируется языковой моделью из вопроса пользователя, поэтому все поля
+// проверяются по белым спискам в Validate, а выполняется он без сырого SQL.
+type SpendingQuery struct {
+	Metric   string          `json:"metric"`
+	Type     TransactionType `json:"type"`
+	Category string          `json:"category"`
+	Search   string          `json:"search"`
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Limit    int             `json:"limit"`
+}
+
+// SpendingAnswer - результат выполнения SpendingQuery
+type SpendingAnswer struct {
+	Query        SpendingQuery
+	From, To     time.Time
+	Count        int
+	Total        float64 // Сумма с учётом знака: доходы плюс расходы
+	Income       float64 // Сумма доходов
+	Expense      float64 // Сумма расходов, отрицательная
+	Average      float64
+	Transactions []Transaction // Для largest, smallest и list
+}
+
+// Validate проверяет запрос и приводит его к допустимым значениям
+func (q *SpendingQuery) Validate(categories []string) error {
+	switch q.Metric {
+	case MetricSum, MetricCount, MetricAverage, MetricLargest, MetricSmallest, MetricList:
+	default:
+		return fmt.Errorf("неизвестная метрика %q", q.Metric)
+	}
+
+	switch q.Type {
+	case TypeAll, TypeExpense, TypeIncome:
+	default:
+		return fmt.Errorf("неизвестный тип транзакций %q", q.Type)
+	}
+
+	if q.Category != "" {
+		canonical := ""
+		for _, category := range categories {
+			if strings.EqualFold(category, q.Category) {
+				canonical = category
+				break
+			}
+		}
+		if canonical == "" {
+			return fmt.Errorf("неизвестная категория %q", q.Category)
+		}
+		q.Category = canonical
+	}
+
+	q.Search = strings.TrimSpace(q.Search)
+	if utf8.RuneCountInString(q.Search) > maxSearchRunes {
+		return fmt.Errorf("слишком длинная строка поиска")
+	}
+
+	for _, date := range []string{q.From, q.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.ParseInLocation("2006-01-02", date, time.Local); err != nil {
+			return fmt.Errorf("некорректная дата %q", date)
+		}
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = 5
+	}
+	if q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+	return nil
+}
+
+// RunSpendingQuery выполняет проверенный запрос по транзакциям пользователя
+func (s *Storage) RunSpendingQuery(scope Scope, q SpendingQuery) (*SpendingAnswer, error) {
+	answer := &SpendingAnswer{Query: q}
+	filter := TransactionFilter{Category: q.Category, Type: q.Type}
+	if q.From != "" {
+		filter.From, _ = time.ParseInLocation("2006-01-02", q.From, time.Local)
+		answer.From = filter.From
+	}
+	if q.To != "" {
+		to, _ := time.ParseInLocation("2006-01-02", q.To, time.Local)
+		filter.To = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		answer.To = filter.To
+	}
+
+	transactions, err := s.GetTransactionsByFilter(scope, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Поиск по комментарию выполняем в Go: LIKE в SQLite не учитывает регистр кириллицы
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		matched := transactions[:0]
+		for _, tr := range transactions {
+			if strings.Contains(strings.ToLower(tr.Comment), search) {
+				matched = append(matched, tr)
+			}
+		}
+		transactions = matched
+	}
+
+	answer.Count = len(transactions)
+	for _, tr := range transactions {
+		answer.Total += tr.Amount
+		if tr.Amount > 0 {
+			answer.Income += tr.Amount
+		} else {
+			answer.Expense += tr.Amount
+		}
+	}
+	if answer.Count > 0 {
+		answer.Average = answer.Total / float64(answer.Count)
+	}
+
+	switch q.Metric {
+	case MetricLargest, MetricSmallest:
+		sort.SliceStable(transactions, func(i, j int) bool {
+			if q.Metric == MetricLargest {
+				return math.Abs(transactions[i].Amount) > math.Abs(transactions[j].Amount)
+			}
+			return math.Abs(transactions[i].Amount) < math.Abs(transactions[j].Amount)
+		})
+		answer.Transactions = firstN(transactions, q.Limit)
+	case MetricList:
+		// Транзакции отсортированы по дате, последние - в конце
+		sort.SliceStable(transactions, func(i, j int) bool {
+			return transactions[i].TransactionDate.After(transactions[j].TransactionDate)
+		})
+		answer.Transactions = firstN(transactions, q.Limit)
+	}
+	return answer, nil
+}
+
+// firstN возвращает не больше n первых транзакций
+func firstN(transactions []Transaction, n int) []Transaction {
+	if len(transactions) > n {
+		return transactions[:n]
+	}
+	return transactions
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Состояния пакета перекатегоризации
+const (
+	BatchDraft     = "draft"     // Предложения подготовлены, но не применены
+	BatchApplied   = "applied"   // Категории изменены
+	BatchUndone    = "undone"    // Изменения отменены
+	BatchDiscarded = "discarded" // Пользователь отказался от предложений
+)
+
+// ErrBatchState возвращается, когда действие недоступно в текущем состоянии пакета
+var ErrBatchState = errors.New("действие недоступно для этого пакета изменений")
+
+// RecategorizationBatch - пакет предложенных изменений категорий по команде /recategorize.
+// Пакет применяется и отменяется целиком.
+type RecategorizationBatch struct {
+	ID        uint  `gorm:"primarykey"`
+	UserID    int64 `gorm:"index"`
+	Status    string
+	CreatedAt time.Time
+	AppliedAt *time.Time
+}
+
+// RecategorizationChange - предложенное изменение категории одной транзакции
+type RecategorizationChange struct {
+	ID            uint `gorm:"primarykey"`
+	BatchID       uint `gorm:"index"`
+	TransactionID uint
+	Amount        float64
+	Comment       string
+	OldCategory   string
+	NewCategory   string
+}
+
+// CreateRecategorizationBatch сохраняет подготовленные изменения как черновик пакета
+func (s *Storage) CreateRecategorizationBatch(userID int64, changes []RecategorizationChange) (*RecategorizationBatch, error) {
+	batch := &RecategorizationBatch{UserID: userID, Status: BatchDraft}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		for i := range changes {
+			changes[i].BatchID = batch.ID
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(changes, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// GetRecategorizationBatch возвращает пакет пользователя вместе с изменениями
+func (s *Storage) GetRecategorizationBatch(userID int64, id uint) (*RecategorizationBatch, []RecategorizationChange, error) {
+	var batch RecategorizationBatch
+	if err := s.db.Where("user_id = ?", userID).First(&batch, id).Error; err != nil {
+		return nil, nil, err
+	}
+	var changes []RecategorizationChange
+	if err := s.db.Where("batch_id = ?", batch.ID).Order("id").Find(&changes).Error; err != nil {
+		return nil, nil, err
+	}
+	return &batch, changes, nil
+}
+
+// GetLastAppliedRecategorizationBatch возвращает последний применённый пакет пользователя
+func (s *Storage) GetLastAppliedRecategorizationBatch(userID int64) (*RecategorizationBatch, error) {
+	var batch RecategorizationBatch
+	err := s.db.Where("user_id = ? AND status = ?", userID, BatchApplied).Order("applied_at desc").First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// ApplyRecategorizationBatch меняет категории транзакций на предложенные.
+// Транзакции, категорию которых уже изменили после подготовки пакета, не затрагиваются.
+// Возвращает количество изменённых транзакций.
+func (s *Storage) ApplyRecategorizationBatch(userID int64, id uint) (int64, error) {
+	return s.switchBatch(userID, id, BatchDraft, BatchApplied, func(change RecategorizationChange) (string, string) {
+		return change.OldCategory, change.NewCategory
+	})
+}
+
+// UndoRecategorizationBatch возвращает транзакциям пакета прежние категории.
+// Транзакции, категорию которых изменили после применения пакета, не затрагиваются.
+func (s *Storage) UndoRecategorizationBatch(userID int64, id uint) (int64, error) {
+	return s.switchBatch(userID, id, BatchApplied, BatchUndone, func(change RecategorizationChange) (string, string) {
+		return change.NewCategory, change.OldCategory
+	})
+}
+
+// DiscardRecategorizationBatch отменяет черновик пакета без изменения транзакций
+func (s *Storage) DiscardRecategorizationBatch(userID int64, id uint) error {
+	result := s.db.Model(&RecategorizationBatch{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, BatchDraft).
+		Update("status", BatchDiscarded)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBatchState
+	}
+	return nil
+}
+
+// switchBatch переводит пакет из состояния from в состояние to, меняя категории транзакций
+// с первой категории из pick на вторую. Всё выполняется в одной транзакции БД.
+func (s *Storage) switchBatch(userID int64, id uint, from, to string, pick func(RecategorizationChange) (string, string)) (int64, error) {
+	var updated int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var batch RecategorizationBatch
+		if err := tx.Where("user_id = ?", userID).First(&batch, id).Error; err != nil {
+			return err
+		}
+		if batch.Status != from {
+			return ErrBatchState
+		}
+
+		var changes []RecategorizationChange
+		if err := tx.Where("batch_id = ?", batch.ID).Find(&changes).Error; err != nil {
+			return err
+		}
+		for _, change := range changes {
+			current, next := pick(change)
+			result := tx.Model(&Transaction{}).
+				Where("id = ? AND user_id = ? AND category = ?", change.TransactionID, userID, current).
+				Update("category", next)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated += result.RowsAffected
+			if result.RowsAffected > 0 {
+				// Возвраты по покупке учитываются в её категории
+				if err := tx.Model(&Transaction{}).Where("refund_of_id = ?", change.TransactionID).Update("category", next).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		updates := map[string]interface{}{"status": to}
+		if to == BatchApplied {
+			updates["applied_at"] = time.Now()
+		}
+		return tx.Model(&batch).Updates(updates).Error
+	})
+	return updated, err
+}
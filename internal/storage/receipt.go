@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrDuplicateReceipt возвращается при попытке повторно загрузить уже сохранённый чек
+var ErrDuplicateReceipt = errors.New("чек уже был загружен")
+
+// SaveReceipt сохраняет чек и созданные по нему транзакции в одной транзакции БД
+func (s *Storage) SaveReceipt(receipt *Receipt, transactions []*Transaction) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		exists, err := receiptExists(tx, receipt)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateReceipt
+		}
+
+		if err := tx.Create(receipt).Error; err != nil {
+			return err
+		}
+		for _, transaction := range transactions {
+			transaction.ReceiptID = &receipt.ID
+			if err := tx.Create(transaction).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HasReceipt сообщает, загружен ли уже чек с теми же фискальными реквизитами
+// в ту же книгу: личную книгу пользователя или общую книгу группы.
+// Проверка нужна до расшифровки чека, чтобы не классифицировать позиции повторно;
+// SaveReceipt всё равно проверяет чек ещё раз внутри транзакции БД.
+func (s *Storage) HasReceipt(receipt *Receipt) (bool, error) {
+	return receiptExists(s.db, receipt)
+}
+
+// receiptExists ищет чек по фискальному накопителю, номеру и признаку документа.
+// Чек общей книги ищется среди чеков всех участников группы, личный - среди личных чеков пользователя.
+func receiptExists(db *gorm.DB, receipt *Receipt) (bool, error) {
+	query := db.Unscoped().Model(&Receipt{}).
+		Where("fn = ? AND fd = ? AND fp = ?", receipt.FN, receipt.FD, receipt.FP)
+	if receipt.LedgerID != 0 {
+		query = query.Where("ledger_id = ?", receipt.LedgerID)
+	} else {
+		query = query.Where("user_id = ? AND ledger_id = 0", receipt.UserID)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
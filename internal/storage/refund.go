@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ошибки привязки возврата к покупке
+var (
+	ErrNotRefundable  = errors.New("возврат можно привязать только к расходу")
+	ErrRefundTooLarge = errors.New("сумма возвратов превышает сумму покупки")
+)
+
+// MessageLink связывает сообщение в чате с транзакцией: сообщение пользователя, из которого
+// создана транзакция, и подтверждение бота. По нему находится транзакция при ответе на сообщение.
+type MessageLink struct {
+	ChatID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	MessageID     int   `gorm:"primaryKey;autoIncrement:false"`
+	TransactionID uint  `gorm:"index"`
+}
+
+// SaveMessageLink запоминает, что сообщение относится к транзакции
+func (s *Storage) SaveMessageLink(chatID int64, messageID int, transactionID uint) error {
+	link := MessageLink{ChatID: chatID, MessageID: messageID, TransactionID: transactionID}
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&link).Error
+}
+
+// GetTransactionByMessage возвращает транзакцию области scope, к которой относится сообщение.
+// В общей книге это может быть транзакция любого участника.
+func (s *Storage) GetTransactionByMessage(scope Scope, chatID int64, messageID int) (*Transaction, error) {
+	var link MessageLink
+	if err := s.db.Where("chat_id = ? AND message_id = ?", chatID, messageID).First(&link).Error; err != nil {
+		return nil, err
+	}
+	var transaction Transaction
+	if err := scope.apply(s.db).First(&transaction, link.TransactionID).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// GetRecentExpenses возвращает последние расходы области scope начиная с since, новые первыми.
+// Возвраты в выборку не попадают.
+func (s *Storage) GetRecentExpenses(scope Scope, since time.Time, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	result := scope.apply(s.db).Where("amount < 0 AND transaction_date >= ?", since).
+		Order("transaction_date desc").Limit(limit).Find(&transactions)
+	return transactions, result.Error
+}
+
+// SaveRefund сохраняет новый доход как возврат по покупке expenseID.
+// Возврат получает категорию покупки и в отчётах уменьшает её расходы, а не увеличивает доходы.
+func (s *Storage) SaveRefund(refund *Transaction, expenseID uint) (*Transaction, error) {
+	var expense *Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+		var err error
+		expense, err = linkRefund(tx, refund, expenseID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+// MarkRefund помечает уже сохранённый доход refundID как возврат по покупке expenseID
+func (s *Storage) MarkRefund(userID int64, refundID, expenseID uint) (*Transaction, *Transaction, error) {
+	var refund Transaction
+	var expense *Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).First(&refund, refundID).Error; err != nil {
+			return err
+		}
+		var err error
+		expense, err = linkRefund(tx, &refund, expenseID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &refund, expense, nil
+}
+
+// HasRefunds сообщает, есть ли возвраты по покупке, в том числе лежащие в корзине:
+// их можно восстановить, и тогда они снова будут ссылаться на покупку
+func (s *Storage) HasRefunds(expenseID uint) (bool, error) {
+	var count int64
+	err := s.db.Unscoped().Model(&Transaction{}).Where("refund_of_id = ?", expenseID).Count(&count).Error
+	return count > 0, err
+}
+
+// linkRefund связывает возврат с покупкой из той же книги: личной книги автора возврата или общей книги группы.
+// Сумма всех возвратов по покупке не может превышать её сумму.
+func linkRefund(tx *gorm.DB, refund *Transaction, expenseID uint) (*Transaction, error) {
+	var expense Transaction
+	if err := ScopeOf(refund).apply(tx).First(&expense, expenseID).Error; err != nil {
+		return nil, err
+	}
+	if refund.Amount <= 0 || expense.Amount >= 0 {
+		return nil, ErrNotRefundable
+	}
+
+	var refunded float64
+	if err := tx.Model(&Transaction{}).
+		Where("refund_of_id = ? AND id <> ?", expense.ID, refund.ID).
+		Select("COALESCE(SUM(amount), 0)").Row().Scan(&refunded); err != nil {
+		return nil, err
+	}
+	if refunded+refund.Amount > math.Abs(expense.Amount)+0.005 {
+		return nil, ErrRefundTooLarge
+	}
+
+	refund.RefundOfID = &expense.ID
+	refund.Category = expense.Category
+	err := tx.Model(refund).Updates(map[string]interface{}{
+		"refund_of_id": expense.ID,
+		"category":     expense.Category,
+	}).Error
+	return &expense, err
+}
@@ -0,0 +1,41 @@
+package storage
+
+import "gorm.io/gorm"
+
+// Scope определяет, чьи транзакции читаются: личные транзакции пользователя
+// или все транзакции общей книги группового чата
+type Scope struct {
+	UserID   int64 // Владелец личных транзакций
+	LedgerID uint  // Общая книга; 0 - личные транзакции UserID
+}
+
+// PersonalScope - личные транзакции пользователя, записанные не в общую книгу
+func PersonalScope(userID int64) Scope {
+	return Scope{UserID: userID}
+}
+
+// LedgerScope - транзакции всех участников общей книги
+func LedgerScope(ledgerID uint) Scope {
+	return Scope{LedgerID: ledgerID}
+}
+
+// ScopeOf возвращает область, к которой относится транзакция
+func ScopeOf(transaction *Transaction) Scope {
+	if transaction.LedgerID != 0 {
+		return LedgerScope(transaction.LedgerID)
+	}
+	return PersonalScope(transaction.UserID)
+}
+
+// IsLedger сообщает, относится ли область к общей книге
+func (sc Scope) IsLedger() bool {
+	return sc.LedgerID != 0
+}
+
+// apply добавляет к запросу условие области
+func (sc Scope) apply(q *gorm.DB) *gorm.DB {
+	if sc.IsLedger() {
+		return q.Where("ledger_id = ?", sc.LedgerID)
+	}
+	return q.Where("user_id = ? AND ledger_id = 0", sc.UserID)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SearchQuery - условия поиска транзакций по тексту, сумме и общей грамматике фильтров.
+// Нулевые значения полей означают отсутствие ограничения.
+type SearchQuery struct {
+	TransactionFilter
+	Text      string  // Слова, которые должны встретиться в комментарии или названии продавца
+	MinAmount float64 // Нижняя граница суммы по модулю
+	MaxAmount float64 // Верхняя граница суммы по модулю
+}
+
+// ftsTriggers - триггеры, которые поддерживают полнотекстовый индекс в актуальном состоянии
+var ftsTriggers = map[string]string{
+	"transactions_fts_insert": `CREATE TRIGGER transactions_fts_insert AFTER INSERT ON transactions BEGIN
+		INSERT INTO transactions_fts(rowid, comment, merchant) VALUES (new.id, new.comment, new.merchant);
+	END`,
+	"transactions_fts_delete": `CREATE TRIGGER transactions_fts_delete AFTER DELETE ON transactions BEGIN
+		INSERT INTO transactions_fts(transactions_fts, rowid, comment, merchant) VALUES ('delete', old.id, old.comment, old.merchant);
+	END`,
+	"transactions_fts_update": `CREATE TRIGGER transactions_fts_update AFTER UPDATE OF comment, merchant ON transactions BEGIN
+		INSERT INTO transactions_fts(transactions_fts, rowid, comment, merchant) VALUES ('delete', old.id, old.comment, old.merchant);
+		INSERT INTO transactions_fts(rowid, comment, merchant) VALUES (new.id, new.comment, new.merchant);
+	END`,
+}
+
+// initFullTextSearch создаёт полнотекстовый индекс FTS5 по комментариям и продавцам и триггеры,
+// которые его обновляют. Если SQLite собран без FTS5 (драйвер go-sqlite3 включает его только
+// с тегом сборки sqlite_fts5), триггеры удаляются, чтобы не мешать записи транзакций,
+// возвращается false и поиск выполняется без индекса.
+func initFullTextSearch(db *gorm.DB) bool {
+	var enabled int
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil || enabled == 0 {
+		log.Println("SQLite собран без FTS5, поиск будет работать без полнотекстового индекса")
+		for name := range ftsTriggers {
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				log.Printf("Ошибка при удалении триггера %s: %v", name, err)
+			}
+		}
+		return false
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS transactions_fts USING fts5(comment, merchant, content='transactions', content_rowid='id', tokenize='unicode61 remove_diacritics 2')`).Error; err != nil {
+			return err
+		}
+		var existing int64
+		if err := tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'transactions_fts_%'").Scan(&existing).Error; err != nil {
+			return err
+		}
+		if int(existing) == len(ftsTriggers) {
+			return nil
+		}
+		// Индекс новый или транзакции записывались без него: создаём триггеры и индексируем всё заново
+		for name, statement := range ftsTriggers {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		log.Println("Перестраиваем полнотекстовый индекс транзакций")
+		return tx.Exec(`INSERT INTO transactions_fts(transactions_fts) VALUES ('rebuild')`).Error
+	})
+	if err != nil {
+		log.Printf("Полнотекстовый индекс недоступен, поиск будет работать без него: %v", err)
+		return false
+	}
+	return true
+}
+
+// ftsMatch превращает слова поиска в запрос FTS5: каждое слово ищется как префикс,
+// чтобы "сантехник" находил и "сантехнику". Кавычки защищают от синтаксиса FTS5 в тексте.
+func ftsMatch(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// SearchTransactions ищет транзакции области scope, новые первыми. Возвращает не больше limit
+// транзакций начиная с offset и общее число найденных.
+func (s *Storage) SearchTransactions(scope Scope, query SearchQuery, offset, limit int) ([]Transaction, int, error) {
+	q := query.TransactionFilter.apply(scope.apply(s.db.Model(&Transaction{})))
+	if query.MinAmount > 0 {
+		q = q.Where("ABS(amount) >= ?", query.MinAmount)
+	}
+	if query.MaxAmount > 0 {
+		q = q.Where("ABS(amount) <= ?", query.MaxAmount)
+	}
+	q = q.Order("transaction_date desc, id desc")
+
+	text := strings.TrimSpace(query.Text)
+	if text != "" && s.fts {
+		q = q.Where("id IN (SELECT rowid FROM transactions_fts WHERE transactions_fts MATCH ?)", ftsMatch(text))
+		var total int64
+		if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, 0, err
+		}
+		var transactions []Transaction
+		err := q.Preload("Tags").Offset(offset).Limit(limit).Find(&transactions).Error
+		return transactions, int(total), err
+	}
+
+	// Без индекса сравниваем текст в Go: LIKE в SQLite не учитывает регистр кириллицы
+	var transactions []Transaction
+	if err := q.Preload("Tags").Find(&transactions).Error; err != nil {
+		return nil, 0, err
+	}
+	if text != "" {
+		words := strings.Fields(strings.ToLower(text))
+		matched := transactions[:0]
+		for _, tr := range transactions {
+			haystack := strings.ToLower(tr.Comment + " " + tr.Merchant)
+			if containsAll(haystack, words) {
+				matched = append(matched, tr)
+			}
+		}
+		transactions = matched
+	}
+	total := len(transactions)
+	if offset >= total {
+		return nil, total, nil
+	}
+	return transactions[offset:min(offset+limit, total)], total, nil
+}
+
+// containsAll сообщает, что в тексте встречаются все слова
+func containsAll(text string, words []string) bool {
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Split - доля участника в расходе общей книги, оплаченном одним человеком.
+// Плательщик - автор транзакции; каждый участник со своей долей должен ему её сумму.
+type Split struct {
+	ID            uint    `gorm:"primarykey"`
+	TransactionID uint    `gorm:"index"`
+	LedgerID      uint    `gorm:"index"`
+	UserID        int64   // Участник, на которого приходится доля
+	Amount        float64 // Сумма доли, положительное число
+}
+
+// Settlement - перевод между участниками общей книги в счёт долга
+type Settlement struct {
+	ID         uint  `gorm:"primarykey"`
+	LedgerID   uint  `gorm:"index"`
+	FromUserID int64 // Кто вернул деньги
+	ToUserID   int64 // Кому вернули
+	Amount     float64
+	CreatedAt  time.Time
+}
+
+// Transfer - один перевод в плане погашения долгов
+type Transfer struct {
+	From   int64
+	To     int64
+	Amount float64
+}
+
+// SaveSettlement записывает перевод в счёт долга
+func (s *Storage) SaveSettlement(settlement *Settlement) error {
+	return s.db.Create(settlement).Error
+}
+
+// GetLedgerBalances возвращает баланс каждого участника общей книги в копейках:
+// положительный - участнику должны, отрицательный - должен он.
+// Доли удалённых транзакций не учитываются.
+func (s *Storage) GetLedgerBalances(ledgerID uint) (map[int64]int64, error) {
+	type row struct {
+		PayerID int64
+		UserID  int64
+		Amount  float64
+	}
+	var splits []row
+	err := s.db.Table("splits").
+		Select("transactions.user_id AS payer_id, splits.user_id, splits.amount").
+		Joins("JOIN transactions ON transactions.id = splits.transaction_id").
+		Where("splits.ledger_id = ? AND splits.user_id <> transactions.user_id AND transactions.deleted_at IS NULL", ledgerID).
+		Scan(&splits).Error
+	if err != nil {
+		return nil, err
+	}
+	var settlements []Settlement
+	if err := s.db.Where("ledger_id = ?", ledgerID).Find(&settlements).Error; err != nil {
+		return nil, err
+	}
+
+	balances := make(map[int64]int64)
+	for _, split := range splits {
+		amount := toKopecks(split.Amount)
+		balances[split.PayerID] += amount
+		balances[split.UserID] -= amount
+	}
+	for _, settlement := range settlements {
+		amount := toKopecks(settlement.Amount)
+		balances[settlement.FromUserID] += amount
+		balances[settlement.ToUserID] -= amount
+	}
+	for userID, balance := range balances {
+		if balance == 0 {
+			delete(balances, userID)
+		}
+	}
+	return balances, nil
+}
+
+// SimplifyDebts строит план погашения долгов: самый крупный должник переводит самому
+// крупному кредитору, пока все балансы не обнулятся. Переводов получается не больше,
+// чем участников с ненулевым балансом без одного, но это жадная эвристика: точный
+// минимум числа переводов она не гарантирует.
+// Балансы задаются в копейках, как их возвращает GetLedgerBalances.
+func SimplifyDebts(balances map[int64]int64) []Transfer {
+	type party struct {
+		userID int64
+		amount int64
+	}
+	var debtors, creditors []party
+	for userID, balance := range balances {
+		switch {
+		case balance < 0:
+			debtors = append(debtors, party{userID, -balance})
+		case balance > 0:
+			creditors = append(creditors, party{userID, balance})
+		}
+	}
+	// Порядок не зависит от обхода map, чтобы план не менялся от запроса к запросу
+	byAmount := func(parties []party) {
+		sort.Slice(parties, func(i, j int) bool {
+			if parties[i].amount != parties[j].amount {
+				return parties[i].amount > parties[j].amount
+			}
+			return parties[i].userID < parties[j].userID
+		})
+	}
+
+	var transfers []Transfer
+	for len(debtors) > 0 && len(creditors) > 0 {
+		byAmount(debtors)
+		byAmount(creditors)
+		amount := min(debtors[0].amount, creditors[0].amount)
+		transfers = append(transfers, Transfer{From: debtors[0].userID, To: creditors[0].userID, Amount: float64(amount) / 100})
+		debtors[0].amount -= amount
+		creditors[0].amount -= amount
+		if debtors[0].amount == 0 {
+			debtors = debtors[1:]
+		}
+		if creditors[0].amount == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
+
+// toKopecks переводит сумму в целые копейки, чтобы балансы сходились без ошибок округления
+func toKopecks(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"gorm.io/driver/sqlite"
@@ -11,32 +12,82 @@ import (
 
 // Storage структура для работы с базой данных
 type Storage struct {
-	db *gorm.DB
+	db       *gorm.DB
+	cacheTTL time.Duration // Срок жизни записей кеша категорий
+	fts      bool          // Доступен ли полнотекстовый индекс для поиска
+	// Сколько удалённые транзакции хранятся в корзине
+	trashRetention time.Duration
 }
 
 // NewStorage подключается к базе данных и выполняет миграцию
 func NewStorage(dbPath string) (*Storage, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// Сообщения разных чатов обрабатываются параллельно, поэтому при одновременной
+	// записи SQLite должен дождаться освобождения блокировки, а не вернуть "database is locked"
+	dsn := dbPath
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_busy_timeout=5000"
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
 
 	// Автоматическая миграция (создание таблицы, если её нет)
-	err = db.AutoMigrate(&Transaction{})
+	err = db.AutoMigrate(&Transaction{}, &Receipt{}, &InsightDelivery{}, &ClassificationCache{}, &PendingClassification{}, &RecategorizationBatch{}, &RecategorizationChange{}, &Category{}, &MessageLink{}, &Ledger{}, &LedgerMember{}, &Split{}, &Settlement{}, &Loan{}, &LoanRepayment{}, &Goal{}, &GoalContribution{}, &Tag{}, &EditPrompt{}, &DeletionBatch{}, &AuditEntry{}, &BotUser{})
 	if err != nil {
 		return nil, err
 	}
+	// Уникальность чеков раньше проверялась только по пользователю, из-за старого индекса
+	// нельзя было загрузить один чек и в личную, и в общую книгу
+	if db.Migrator().HasIndex(&Receipt{}, "idx_receipt_fiscal") {
+		if err := db.Migrator().DropIndex(&Receipt{}, "idx_receipt_fiscal"); err != nil {
+			return nil, err
+		}
+	}
+	if err := initAuditLog(db); err != nil {
+		return nil, err
+	}
 
-	return &Storage{db: db}, nil
+	return &Storage{
+		db:             db,
+		cacheTTL:       DefaultClassificationCacheTTL,
+		fts:            initFullTextSearch(db),
+		trashRetention: DefaultTrashRetention,
+	}, nil
 }
 
-// SaveTransaction сохраняет новую транзакцию в базе данных
+// SaveTransaction сохраняет новую транзакцию в базе данных вместе с её тегами и долями
 func (s *Storage) SaveTransaction(transaction *Transaction) error {
-	result := s.db.Create(transaction)
-	if result.Error != nil {
-		log.Printf("Ошибка сохранения транзакции в базе данных: %v", result.Error)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := resolveTags(tx, transaction.Tags); err != nil {
+			return err
+		}
+		return tx.Create(transaction).Error
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения транзакции в базе данных: %v", err)
+	}
+	return err
+}
+
+// UpdateTransactionCategory меняет категорию транзакции пользователя.
+// Транзакция ищется только среди записей userID, чужую транзакцию изменить нельзя.
+func (s *Storage) UpdateTransactionCategory(userID int64, id uint, category string) (*Transaction, error) {
+	var transaction Transaction
+	if err := s.db.Where("user_id = ?", userID).Preload("Tags").First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&transaction).Update("category", category).Error; err != nil {
+			return err
+		}
+		// Возвраты по покупке учитываются в её категории
+		return tx.Model(&Transaction{}).Where("refund_of_id = ?", transaction.ID).Update("category", category).Error
+	})
+	if err != nil {
+		return nil, err
 	}
-	return result.Error
+	return &transaction, nil
 }
 
 // GetTransactionsByPeriod возвращает все транзакции пользователя за указанный период
@@ -53,53 +104,20 @@ func (s *Storage) GetPeriodSummary(userID int64, from, to time.Time) (float64, e
 	return total, result
 }
 
-// GetAllTransactions возвращает все транзакции пользователя
+// GetAllTransactions возвращает все личные транзакции пользователя, без транзакций общих книг
 func (s *Storage) GetAllTransactions(userID int64) ([]Transaction, error) {
 	var transactions []Transaction
-	result := s.db.Where("user_id = ?", userID).Find(&transactions)
+	result := PersonalScope(userID).apply(s.db).Preload("Tags").Find(&transactions)
 	return transactions, result.Error
 }
 
-// DeleteLastTransaction находит и удаляет последнюю транзакцию пользователя.
-// Возвращает удаленную транзакцию или ошибку, если транзакций нет.
-func (s *Storage) DeleteLastTransaction(userID int64) (*Transaction, error) {
-	var lastTransaction Transaction
-	// Ищем последнюю транзакцию по ID, так как это самый надежный способ найти последнюю запись
-	if err := s.db.Where("user_id = ?", userID).Order("id desc").First(&lastTransaction).Error; err != nil {
-		// Возвращаем ошибку, если ничего не найдено (gorm.ErrRecordNotFound)
-		return nil, err
-	}
-
-	// Удаляем найденную транзакцию
-	if err := s.db.Delete(&lastTransaction).Error; err != nil {
-		return nil, err
-	}
-
-	return &lastTransaction, nil
-}
-
-// DeleteTransactionsForToday удаляет все транзакции пользователя за сегодняшний день.
-// Возвращает количество удаленных транзакций.
-func (s *Storage) DeleteTransactionsForToday(userID int64) (int64, error) {
-	now := time.Now()
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour).Add(-time.Nanosecond) // Конец дня (23:59:59.999...)
-
-	result := s.db.Where("user_id = ? AND transaction_date BETWEEN ? AND ?", userID, startOfDay, endOfDay).Delete(&Transaction{})
-	if result.Error != nil {
-		return 0, result.Error
-	}
-
-	return result.RowsAffected, nil
-}
-
-// GetAllTimeSummary calculates the sum of all transactions for a user.
-func (s *Storage) GetAllTimeSummary(userID int64) (float64, error) {
+// GetAllTimeSummary calculates the sum of all transactions in the scope.
+func (s *Storage) GetAllTimeSummary(scope Scope) (float64, error) {
 	var total float64
 	// .Row().Scan() returns an error if no record is found.
 	// For SUM(), this happens when there are no transactions, and the result is NULL.
 	// We treat this as a total of 0 and no error.
-	err := s.db.Model(&Transaction{}).Where("user_id = ?", userID).Select("SUM(amount)").Row().Scan(&total)
+	err := scope.apply(s.db.Model(&Transaction{})).Select("SUM(amount)").Row().Scan(&total)
 	if err != nil {
 		// If no records are found, GORM might return ErrRecordNotFound or a SQL-level error for NULL sum.
 		// In either case, a total of 0 is the correct interpretation.
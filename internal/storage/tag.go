@@ -0,0 +1,45 @@
+package storage
+
+import "gorm.io/gorm"
+
+// Tag - произвольная метка транзакции: #командировка, #проектx.
+// В отличие от категории, у транзакции может быть несколько тегов.
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"uniqueIndex"` // Нормализованное название без #, см. NormalizeTag
+}
+
+// TagsFromNames создаёт список тегов по названиям, пропуская пустые и повторяющиеся
+func TagsFromNames(names []string) []Tag {
+	var tags []Tag
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, Tag{Name: name})
+	}
+	return tags
+}
+
+// TagNames возвращает названия тегов транзакции
+func (t *Transaction) TagNames() []string {
+	names := make([]string, len(t.Tags))
+	for i, tag := range t.Tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// resolveTags находит или создаёт теги по названию и заполняет их ID,
+// чтобы при сохранении транзакции связи ссылались на существующие записи
+func resolveTags(tx *gorm.DB, tags []Tag) error {
+	for i := range tags {
+		if err := tx.Where(Tag{Name: tags[i].Name}).FirstOrCreate(&tags[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTrashRetention - сколько по умолчанию удалённые транзакции хранятся в корзине до окончательного удаления
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// DeletionBatch - одно удаление: транзакции, удалённые одной командой или кнопкой.
+// /undo восстанавливает последнее удаление целиком.
+type DeletionBatch struct {
+	ID        uint  `gorm:"primarykey"`
+	UserID    int64 `gorm:"index"` // Кто удалил
+	LedgerID  uint  // Общая книга, из которой удалены транзакции; 0 - личные
+	CreatedAt time.Time
+}
+
+// SetTrashRetention задаёт, сколько удалённые транзакции хранятся в корзине
+func (s *Storage) SetTrashRetention(retention time.Duration) {
+	s.trashRetention = retention
+}
+
+// TrashRetention возвращает, сколько удалённые транзакции хранятся в корзине
+func (s *Storage) TrashRetention() time.Duration {
+	return s.trashRetention
+}
+
+// DeleteTransactions удаляет транзакции области scope одним удалением от имени userID.
+// Транзакции попадают в корзину: до окончательного удаления их можно восстановить.
+// Возвращает число удалённых транзакций.
+func (s *Storage) DeleteTransactions(scope Scope, userID int64, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	var deleted int64
+	err := s.As(userID).db.Transaction(func(tx *gorm.DB) error {
+		batch := DeletionBatch{UserID: userID, LedgerID: scope.LedgerID}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		result := scope.apply(tx.Model(&Transaction{})).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"deleted_at": time.Now(), "deletion_batch_id": batch.ID})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// DeleteTransaction удаляет одну транзакцию области scope и возвращает её
+func (s *Storage) DeleteTransaction(scope Scope, userID int64, id uint) (*Transaction, error) {
+	var transaction Transaction
+	if err := scope.apply(s.db).First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	if _, err := s.DeleteTransactions(scope, userID, []uint{transaction.ID}); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// DeleteLastTransaction находит и удаляет последнюю транзакцию, добавленную пользователем в области scope.
+// Возвращает удаленную транзакцию или ошибку, если транзакций нет.
+func (s *Storage) DeleteLastTransaction(scope Scope, userID int64) (*Transaction, error) {
+	var lastTransaction Transaction
+	// Ищем последнюю транзакцию по ID, так как это самый надежный способ найти последнюю запись
+	if err := scope.apply(s.db).Where("user_id = ?", userID).Order("id desc").First(&lastTransaction).Error; err != nil {
+		// Возвращаем ошибку, если ничего не найдено (gorm.ErrRecordNotFound)
+		return nil, err
+	}
+	if _, err := s.DeleteTransactions(scope, userID, []uint{lastTransaction.ID}); err != nil {
+		return nil, err
+	}
+	return &lastTransaction, nil
+}
+
+// GetTrash возвращает транзакции области scope, которые лежат в корзине, недавно удалённые первыми
+func (s *Storage) GetTrash(scope Scope, limit int) ([]Transaction, int64, error) {
+	q := scope.apply(s.db.Unscoped().Model(&Transaction{})).
+		Where("deleted_at IS NOT NULL AND deleted_at > ?", time.Now().Add(-s.trashRetention))
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var transactions []Transaction
+	err := q.Preload("Tags").Order("deleted_at desc, id desc").Limit(limit).Find(&transactions).Error
+	return transactions, total, err
+}
+
+// RestoreTransaction возвращает транзакцию области scope из корзины.
+// Если authorID не 0, восстановить можно только транзакцию этого пользователя.
+// Автора восстановления для журнала изменений задаёт As.
+func (s *Storage) RestoreTransaction(scope Scope, id uint, authorID int64) (*Transaction, error) {
+	var transaction Transaction
+	q := scope.apply(s.db.Unscoped()).
+		Where("deleted_at IS NOT NULL AND deleted_at > ?", time.Now().Add(-s.trashRetention))
+	if authorID != 0 {
+		q = q.Where("user_id = ?", authorID)
+	}
+	if err := q.First(&transaction, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.restore(s.db, []uint{transaction.ID}); err != nil {
+		return nil, err
+	}
+	transaction.DeletedAt = gorm.DeletedAt{}
+	transaction.DeletionBatchID = nil
+	return &transaction, nil
+}
+
+// UndoLastDeletion восстанавливает транзакции последнего удаления пользователя в области scope,
+// которые ещё лежат в корзине. Возвращает восстановленные транзакции или gorm.ErrRecordNotFound,
+// если восстанавливать нечего.
+func (s *Storage) UndoLastDeletion(scope Scope, userID int64) ([]Transaction, error) {
+	var transactions []Transaction
+	err := s.As(userID).db.Transaction(func(tx *gorm.DB) error {
+		var batch DeletionBatch
+		err := tx.Where("user_id = ? AND ledger_id = ?", userID, scope.LedgerID).
+			Where("id IN (?)", scope.apply(tx.Unscoped().Model(&Transaction{})).
+				Select("deletion_batch_id").
+				Where("deleted_at IS NOT NULL AND deleted_at > ?", time.Now().Add(-s.trashRetention))).
+			Order("id desc").First(&batch).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("deletion_batch_id = ? AND deleted_at IS NOT NULL", batch.ID).Find(&transactions).Error; err != nil {
+			return err
+		}
+		ids := make([]uint, len(transactions))
+		for i := range transactions {
+			ids[i] = transactions[i].ID
+			transactions[i].DeletedAt = gorm.DeletedAt{}
+			transactions[i].DeletionBatchID = nil
+		}
+		return s.restore(tx, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// restore снимает с транзакций отметку об удалении
+func (s *Storage) restore(tx *gorm.DB, ids []uint) error {
+	return tx.Unscoped().Model(&Transaction{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"deleted_at": nil, "deletion_batch_id": nil}).Error
+}
+
+// PurgeTrash окончательно удаляет транзакции, пролежавшие в корзине дольше срока хранения,
+// вместе с их долями, тегами, связями с сообщениями и чеками. Возвращает число удалённых транзакций.
+func (s *Storage) PurgeTrash(now time.Time) (int64, error) {
+	var purged int64
+	err := s.As(SystemActor).db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&Transaction{}).
+			Where("deleted_at IS NOT NULL AND deleted_at <= ?", now.Add(-s.trashRetention)).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		var err error
+		purged, err = purgeTransactions(tx, ids)
+		return err
+	})
+	return purged, err
+}
+
+// purgeTransactions безвозвратно удаляет транзакции и всё, что без них теряет смысл:
+// доли, теги, связи с сообщениями, запросы правки, отложенные классификации, чеки,
+// по которым не осталось транзакций, и удаления, от которых в корзине ничего не осталось.
+// Возвраты по удалённым покупкам остаются, но теряют ссылку на покупку.
+// Возвращает число удалённых транзакций.
+func purgeTransactions(tx *gorm.DB, ids []uint) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	for _, model := range []interface{}{&Split{}, &MessageLink{}, &EditPrompt{}, &PendingClassification{}} {
+		if err := tx.Where("transaction_id IN ?", ids).Delete(model).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Exec("DELETE FROM transaction_tags WHERE transaction_id IN ?", ids).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Unscoped().Model(&Transaction{}).Where("refund_of_id IN ? AND id NOT IN ?", ids, ids).
+		Update("refund_of_id", nil).Error; err != nil {
+		return 0, err
+	}
+	var receiptIDs []uint
+	if err := tx.Unscoped().Model(&Transaction{}).Where("id IN ? AND receipt_id IS NOT NULL", ids).
+		Distinct().Pluck("receipt_id", &receiptIDs).Error; err != nil {
+		return 0, err
+	}
+
+	result := tx.Unscoped().Where("id IN ?", ids).Delete(&Transaction{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	// Чек без транзакций иначе навсегда запретил бы загрузить его повторно
+	if len(receiptIDs) > 0 {
+		err := tx.Unscoped().Where("id IN ?", receiptIDs).
+			Where("id NOT IN (?)", tx.Unscoped().Model(&Transaction{}).Select("receipt_id").Where("receipt_id IS NOT NULL")).
+			Delete(&Receipt{}).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	// Удаления, от которых в корзине ничего не осталось, больше не нужны для /undo
+	err := tx.Where("id NOT IN (?)", tx.Unscoped().Model(&Transaction{}).
+		Select("deletion_batch_id").Where("deletion_batch_id IS NOT NULL")).
+		Delete(&DeletionBatch{}).Error
+	return result.RowsAffected, err
+}